@@ -15,6 +15,14 @@ import (
 const (
 	// MEMORY defined cache provider.
 	MEMORY = "memory"
+	// REDIS defined cache provider.
+	REDIS = "redis"
+	// FILE defined cache provider.
+	FILE = "file"
+	// DB defined cache provider.
+	DB = "db"
+	// TIERED defined cache provider.
+	TIERED = "tiered"
 	// INFINITY should be used by the cache providers to identify
 	// that the value should not get deleted by the garbage collector.
 	INFINITY = 0
@@ -25,6 +33,7 @@ var (
 	ErrUnknownProvider       = errors.New("cache: unknown cache-provider %q")
 	ErrNoProvider            = errors.New("cache: empty cache-name or cache-provider is nil")
 	ErrProviderAlreadyExists = errors.New("cache: cache-provider %#v is already registered")
+	ErrNotInteger            = errors.New("cache: value of key %v is not an integer")
 )
 
 // registry for all cache providers.
@@ -37,21 +46,64 @@ type Interface interface {
 	Get(key string) (Valuer, error)
 	// GetAll returns all existing Valuer as map.
 	GetAll() map[string]Valuer
-	// GetAll returns all existing Valuer as map.
+	// GetPrefixed returns all existing Valuer with the given key prefix as map.
 	GetPrefixed(string) map[string]Valuer
 	// Set a value by its key and lifetime.
 	// If a value should not get deleted, cache.INFINITY can be used as time.Duration.
-	Set(key string, value interface{}, ttl time.Duration) error
+	// Optional tags can be added to invalidate a group of values with DeleteTagged.
+	Set(key string, value interface{}, ttl time.Duration, tags ...string) error
 	// Exist checks if a value is set by the given key.
 	Exist(key string) bool
 	// Delete a value by its key.
 	Delete(key string) error
 	// DeleteAll values of the cache provider.
 	DeleteAll() error
+	// DeletePrefixed values by the given key prefix.
 	DeletePrefixed(string) error
+	// DeleteTagged values which have at least one of the given tags.
+	DeleteTagged(tags ...string) error
+	// Increment the integer value of the key by delta and returns the new value.
+	// If the key does not exist, it will be created with the given ttl. The ttl of an existing key is not changed.
+	// Error will return if the value is not an integer.
+	Increment(key string, delta int64, ttl time.Duration) (int64, error)
+	// Decrement the integer value of the key by delta and returns the new value.
+	// See Increment for more details.
+	Decrement(key string, delta int64, ttl time.Duration) (int64, error)
+	// SetIfNotExists sets the value only if the key does not exist.
+	// True will return if the value was set.
+	SetIfNotExists(key string, value interface{}, ttl time.Duration) (bool, error)
+	// CompareAndSwap sets the new value only if the key exists and its value is equal to old.
+	// The ttl is set by the given ttl, the tags of the key are kept.
+	// True will return if the value was swapped.
+	CompareAndSwap(key string, old interface{}, new interface{}, ttl time.Duration) (bool, error)
+	// Stats returns the statistics of the cache.
+	// Counters which are not supported by the provider are 0.
+	Stats() Stats
 	// GC will spawn the garbage collector in a goroutine.
 	// If your cache provider has its own gc (redis, memcached, ...) just return void in this method.
+	// GC must return after the cache was closed.
 	GC()
+	// Close stops the garbage collector and releases the resources of the provider.
+	// The cache must not be used after it was closed. Close can be called multiple times.
+	Close() error
+}
+
+// Stats of a cache provider.
+type Stats struct {
+	// Hits of Get.
+	Hits uint64
+	// Misses of Get.
+	Misses uint64
+	// Evictions by the eviction policy of the provider.
+	Evictions uint64
+	// Expirations of items which were removed by the garbage collector.
+	Expirations uint64
+	// Items is the number of stored items.
+	Items int
+	// Size is the approximated size in bytes.
+	Size int64
+	// Prefixes can be used by the provider to return a breakdown by key prefix.
+	Prefixes map[string]Stats
 }
 
 // Valuer is an interface to get the value of a cache object.
@@ -66,6 +118,7 @@ type provider func(interface{}) Interface
 
 // New returns a specific cache provider by its name and given options.
 // The available options are defined in the provider.
+// The garbage collector is started in a goroutine, it is stopped by Close.
 // If the provider is not registered an error will return.
 func New(provider string, options interface{}) (Interface, error) {
 	instanceFn, ok := registry[provider]
@@ -94,3 +147,32 @@ func Register(provider string, fn provider) error {
 	registry[provider] = fn
 	return nil
 }
+
+// Int64 converts an integer value to int64.
+// It can be used by cache providers to implement Increment and Decrement.
+// Error will return if the value is not an integer.
+func Int64(key string, value interface{}) (int64, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return int64(v), nil
+	}
+	return 0, fmt.Errorf(ErrNotInteger.Error(), key)
+}
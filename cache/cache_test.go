@@ -6,6 +6,7 @@ package cache_test
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -52,7 +53,17 @@ func (mc *mockCache) GetAll() map[string]cm.Valuer {
 	return mc.items
 }
 
-func (mc *mockCache) Set(k string, v interface{}, ttl time.Duration) error {
+func (mc *mockCache) GetPrefixed(prefix string) map[string]cm.Valuer {
+	rv := make(map[string]cm.Valuer)
+	for k, v := range mc.items {
+		if strings.HasPrefix(k, prefix) {
+			rv[k] = v
+		}
+	}
+	return rv
+}
+
+func (mc *mockCache) Set(k string, v interface{}, ttl time.Duration, tags ...string) error {
 	mc.items[k] = &item{val: v, created: time.Now(), ttl: ttl}
 	return nil
 }
@@ -76,10 +87,45 @@ func (mc *mockCache) DeleteAll() error {
 	return nil
 }
 
+func (mc *mockCache) DeletePrefixed(prefix string) error {
+	for k := range mc.GetPrefixed(prefix) {
+		delete(mc.items, k)
+	}
+	return nil
+}
+
+func (mc *mockCache) DeleteTagged(tags ...string) error {
+	return nil
+}
+
+func (mc *mockCache) Increment(k string, delta int64, ttl time.Duration) (int64, error) {
+	return delta, nil
+}
+
+func (mc *mockCache) Decrement(k string, delta int64, ttl time.Duration) (int64, error) {
+	return -delta, nil
+}
+
+func (mc *mockCache) SetIfNotExists(k string, v interface{}, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (mc *mockCache) CompareAndSwap(k string, old interface{}, new interface{}, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (mc *mockCache) Stats() cm.Stats {
+	return cm.Stats{Items: len(mc.items)}
+}
+
 func (mc *mockCache) GC() {
 	mc.gcCounter = mc.gcCounter + 1
 }
 
+func (mc *mockCache) Close() error {
+	return nil
+}
+
 func TestRegister(t *testing.T) {
 	test := assert.New(t)
 
@@ -108,6 +154,23 @@ func TestRegister(t *testing.T) {
 	test.Equal(fmt.Sprintf(cm.ErrProviderAlreadyExists.Error(), "mock"), err.Error())
 }
 
+func TestInt64(t *testing.T) {
+	test := assert.New(t)
+
+	// ok
+	for _, v := range []interface{}{int(5), int8(5), int16(5), int32(5), int64(5), uint(5), uint8(5), uint16(5), uint32(5), uint64(5)} {
+		i, err := cm.Int64("key", v)
+		test.NoError(err)
+		test.Equal(int64(5), i)
+	}
+
+	// error: no integer
+	i, err := cm.Int64("key", "5")
+	test.Error(err)
+	test.Equal(fmt.Sprintf(cm.ErrNotInteger.Error(), "key"), err.Error())
+	test.Equal(int64(0), i)
+}
+
 func TestNew(t *testing.T) {
 	test := assert.New(t)
 
@@ -154,6 +217,12 @@ func Example() {
 	items := c.GetAll()
 	fmt.Println(items)
 
+	// Get a cache by key or load it on a miss.
+	v, err := cm.Remember(c, "answer", time.Hour, func() (interface{}, error) {
+		return 42, nil
+	})
+	fmt.Println(v)
+
 	// Check if an key exists
 	exists := c.Exist("foo")
 	fmt.Println(exists)
@@ -163,4 +232,7 @@ func Example() {
 
 	// Delete all items
 	err = c.DeleteAll()
+
+	// Stop the gc and release the cache
+	err = c.Close()
 }
@@ -0,0 +1,464 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Codecs which can be used by the out-of-process providers.
+var (
+	// Gob encodes the values with encoding/gob.
+	// Gob does not distinguish between a pointer and its element, so the number of pointers is added to restore the original type.
+	// Nil pointers are decoded as nil.
+	Gob Codec = gobCodec{}
+	// JSON encodes the values as json, together with the registered type name.
+	JSON Codec = jsonCodec{}
+	// Binary encodes basic types in a compact binary format. All other types are gob encoded, together with the registered type name.
+	Binary Codec = binaryCodec{}
+)
+
+// Error messages
+var (
+	ErrUnregisteredType = errors.New("cache: type %v is not registered")
+	ErrTypeName         = errors.New("cache: type name %v is already registered for %v")
+	ErrCodecData        = errors.New("cache: invalid codec data")
+)
+
+// Codec is used by the providers to serialize the values.
+// Decode must return the value in its original Go type.
+type Codec interface {
+	Encode(value interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+// types holds the registered types by name and the name by type.
+var types = struct {
+	sync.RWMutex
+	byName map[string]reflect.Type
+	byType map[reflect.Type]string
+}{byName: make(map[string]reflect.Type), byType: make(map[reflect.Type]string)}
+
+// init registers the basic types.
+func init() {
+	for _, v := range []interface{}{
+		false, "", []byte(nil),
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0),
+		float32(0), float64(0),
+		time.Time{}, time.Duration(0),
+		[]string(nil), []int(nil), []interface{}(nil), map[string]string(nil), map[string]interface{}(nil),
+	} {
+		_ = RegisterType(v)
+	}
+}
+
+// RegisterType registers the type of the value.
+// The name is created like gob.Register does (e.g. github.com/user/app.User), so both registrations are compatible.
+// Custom types must be registered before they are set, so that the codecs can decode them into the original type.
+// A pointer and its element are different types.
+func RegisterType(value interface{}) error {
+	return RegisterTypeName(gobName(reflect.TypeOf(value)), value)
+}
+
+// RegisterTypeName registers the type of the value by the given name.
+// The type is also registered by gob.RegisterName.
+// Error will return if the name is already used by another type.
+func RegisterTypeName(name string, value interface{}) error {
+	t := reflect.TypeOf(value)
+
+	types.Lock()
+	defer types.Unlock()
+	if existing, ok := types.byName[name]; ok {
+		if existing != t {
+			return fmt.Errorf(ErrTypeName.Error(), name, existing)
+		}
+		return nil
+	}
+
+	// gob does not distinguish between a pointer and its element, so always the element is registered.
+	// gob panics if the element was registered differently (e.g. by gob.Register), this is ignored.
+	func() {
+		defer func() { _ = recover() }()
+		if t.Kind() == reflect.Ptr {
+			gob.RegisterName(strings.TrimPrefix(name, "*"), reflect.Zero(t.Elem()).Interface())
+			return
+		}
+		gob.RegisterName(name, value)
+	}()
+
+	types.byName[name] = t
+	types.byType[t] = name
+	return nil
+}
+
+// gobName returns the name which gob.Register uses for the type.
+func gobName(t reflect.Type) string {
+	name := t.String()
+	star := ""
+	if t.Name() == "" && t.Kind() == reflect.Ptr {
+		star = "*"
+		t = t.Elem()
+	}
+	if t.Name() != "" {
+		if t.PkgPath() == "" {
+			name = star + t.Name()
+		} else {
+			name = star + t.PkgPath() + "." + t.Name()
+		}
+	}
+	return name
+}
+
+// typeName returns the registered name of the value type.
+func typeName(value interface{}) (string, error) {
+	types.RLock()
+	defer types.RUnlock()
+	if name, ok := types.byType[reflect.TypeOf(value)]; ok {
+		return name, nil
+	}
+	return "", fmt.Errorf(ErrUnregisteredType.Error(), reflect.TypeOf(value))
+}
+
+// typeByName returns the registered type.
+func typeByName(name string) (reflect.Type, error) {
+	types.RLock()
+	defer types.RUnlock()
+	if t, ok := types.byName[name]; ok {
+		return t, nil
+	}
+	return nil, fmt.Errorf(ErrUnregisteredType.Error(), name)
+}
+
+// gobCodec encodes the value as interface, so gob adds the type information.
+type gobCodec struct{}
+
+// gobEntry is the gob encoded representation of a value.
+// Ptr is the number of pointers of the value type.
+type gobEntry struct {
+	Value interface{}
+	Ptr   int
+}
+
+// Encode the value with gob.
+// Custom types must be registered with RegisterType or gob.Register.
+func (gobCodec) Encode(value interface{}) ([]byte, error) {
+	e := gobEntry{Value: value}
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			e.Value = nil
+		} else {
+			e.Ptr = ptrDepth(v.Type())
+		}
+	}
+
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(e)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode the gob data.
+func (gobCodec) Decode(data []byte) (interface{}, error) {
+	e := gobEntry{}
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&e)
+	if err != nil {
+		return nil, err
+	}
+	if e.Value == nil {
+		return nil, nil
+	}
+
+	// gob returns the registered type, which can be the element or a pointer.
+	v := reflect.ValueOf(e.Value)
+	for d := ptrDepth(v.Type()); d != e.Ptr; {
+		if d > e.Ptr {
+			v = v.Elem()
+			d--
+			continue
+		}
+		p := reflect.New(v.Type())
+		p.Elem().Set(v)
+		v = p
+		d++
+	}
+	return v.Interface(), nil
+}
+
+// ptrDepth returns the number of pointers of the type.
+func ptrDepth(t reflect.Type) int {
+	d := 0
+	for ; t.Kind() == reflect.Ptr; t = t.Elem() {
+		d++
+	}
+	return d
+}
+
+// jsonCodec encodes the value together with its registered type name.
+type jsonCodec struct{}
+
+// jsonEntry is the json representation of a value.
+type jsonEntry struct {
+	Type  string          `json:"type,omitempty"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Encode the value as json.
+// Error will return if the type is not registered.
+func (jsonCodec) Encode(value interface{}) ([]byte, error) {
+	e := jsonEntry{}
+	if value != nil {
+		var err error
+		e.Type, err = typeName(value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	e.Value, err = json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(e)
+}
+
+// Decode the json data into the registered type.
+func (jsonCodec) Decode(data []byte) (interface{}, error) {
+	e := jsonEntry{}
+	err := json.Unmarshal(data, &e)
+	if err != nil {
+		return nil, err
+	}
+	if e.Type == "" {
+		return nil, nil
+	}
+	t, err := typeByName(e.Type)
+	if err != nil {
+		return nil, err
+	}
+	v := reflect.New(t)
+	err = json.Unmarshal(e.Value, v.Interface())
+	if err != nil {
+		return nil, err
+	}
+	return v.Elem().Interface(), nil
+}
+
+// binary type tags.
+const (
+	binNil byte = iota
+	binFalse
+	binTrue
+	binInt
+	binInt8
+	binInt16
+	binInt32
+	binInt64
+	binUint
+	binUint8
+	binUint16
+	binUint32
+	binUint64
+	binFloat32
+	binFloat64
+	binString
+	binBytes
+	binTime
+	binDuration
+	binRegistered
+)
+
+// binaryCodec encodes basic types with a one byte tag and varints.
+type binaryCodec struct{}
+
+// Encode the value in the binary format.
+// Error will return if the type is not a basic type and not registered.
+func (binaryCodec) Encode(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return []byte{binNil}, nil
+	case bool:
+		if v {
+			return []byte{binTrue}, nil
+		}
+		return []byte{binFalse}, nil
+	case int:
+		return appendVarint(binInt, int64(v)), nil
+	case int8:
+		return appendVarint(binInt8, int64(v)), nil
+	case int16:
+		return appendVarint(binInt16, int64(v)), nil
+	case int32:
+		return appendVarint(binInt32, int64(v)), nil
+	case int64:
+		return appendVarint(binInt64, v), nil
+	case uint:
+		return appendUvarint(binUint, uint64(v)), nil
+	case uint8:
+		return appendUvarint(binUint8, uint64(v)), nil
+	case uint16:
+		return appendUvarint(binUint16, uint64(v)), nil
+	case uint32:
+		return appendUvarint(binUint32, uint64(v)), nil
+	case uint64:
+		return appendUvarint(binUint64, v), nil
+	case float32:
+		return appendUint(binFloat32, uint64(math.Float32bits(v)), 4), nil
+	case float64:
+		return appendUint(binFloat64, math.Float64bits(v), 8), nil
+	case string:
+		return append([]byte{binString}, v...), nil
+	case []byte:
+		return append([]byte{binBytes}, v...), nil
+	case time.Time:
+		b, err := v.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{binTime}, b...), nil
+	case time.Duration:
+		return appendVarint(binDuration, int64(v)), nil
+	}
+
+	// registered types: tag, name length, name, gob data.
+	name, err := typeName(value)
+	if err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(appendUvarint(binRegistered, uint64(len(name))))
+	buf.WriteString(name)
+	err = gob.NewEncoder(buf).Encode(value)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// appendVarint returns the tag followed by the varint.
+func appendVarint(tag byte, v int64) []byte {
+	b := make([]byte, 1+binary.MaxVarintLen64)
+	b[0] = tag
+	return b[:1+binary.PutVarint(b[1:], v)]
+}
+
+// appendUvarint returns the tag followed by the uvarint.
+func appendUvarint(tag byte, v uint64) []byte {
+	b := make([]byte, 1+binary.MaxVarintLen64)
+	b[0] = tag
+	return b[:1+binary.PutUvarint(b[1:], v)]
+}
+
+// appendUint returns the tag followed by the big endian value with the given size (4 or 8 bytes).
+func appendUint(tag byte, v uint64, size int) []byte {
+	b := make([]byte, 1+size)
+	b[0] = tag
+	if size == 4 {
+		binary.BigEndian.PutUint32(b[1:], uint32(v))
+	} else {
+		binary.BigEndian.PutUint64(b[1:], v)
+	}
+	return b
+}
+
+// Decode the binary data into the original type.
+func (binaryCodec) Decode(data []byte) (interface{}, error) {
+	if len(data) == 0 {
+		return nil, ErrCodecData
+	}
+	tag, b := data[0], data[1:]
+
+	switch tag {
+	case binNil:
+		return nil, nil
+	case binFalse:
+		return false, nil
+	case binTrue:
+		return true, nil
+	case binInt, binInt8, binInt16, binInt32, binInt64, binDuration:
+		v, n := binary.Varint(b)
+		if n <= 0 {
+			return nil, ErrCodecData
+		}
+		switch tag {
+		case binInt:
+			return int(v), nil
+		case binInt8:
+			return int8(v), nil
+		case binInt16:
+			return int16(v), nil
+		case binInt32:
+			return int32(v), nil
+		case binDuration:
+			return time.Duration(v), nil
+		}
+		return v, nil
+	case binUint, binUint8, binUint16, binUint32, binUint64:
+		v, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, ErrCodecData
+		}
+		switch tag {
+		case binUint:
+			return uint(v), nil
+		case binUint8:
+			return uint8(v), nil
+		case binUint16:
+			return uint16(v), nil
+		case binUint32:
+			return uint32(v), nil
+		}
+		return v, nil
+	case binFloat32:
+		if len(b) != 4 {
+			return nil, ErrCodecData
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), nil
+	case binFloat64:
+		if len(b) != 8 {
+			return nil, ErrCodecData
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), nil
+	case binString:
+		return string(b), nil
+	case binBytes:
+		return append([]byte{}, b...), nil
+	case binTime:
+		t := time.Time{}
+		err := t.UnmarshalBinary(b)
+		if err != nil {
+			return nil, err
+		}
+		return t, nil
+	case binRegistered:
+		l, n := binary.Uvarint(b)
+		if n <= 0 || uint64(len(b)-n) < l {
+			return nil, ErrCodecData
+		}
+		t, err := typeByName(string(b[n : n+int(l)]))
+		if err != nil {
+			return nil, err
+		}
+		v := reflect.New(t)
+		err = gob.NewDecoder(bytes.NewReader(b[n+int(l):])).Decode(v.Interface())
+		if err != nil {
+			return nil, err
+		}
+		return v.Elem().Interface(), nil
+	}
+
+	return nil, ErrCodecData
+}
@@ -0,0 +1,132 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cache_test
+
+import (
+	"encoding/gob"
+	"fmt"
+	"testing"
+	"time"
+
+	cm "github.com/patrickascher/gofw/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+type codecUser struct {
+	Name    string
+	Age     int
+	Tags    []string
+	Created time.Time
+}
+
+type codecUnregistered struct {
+	Name string
+}
+
+type codecOther struct {
+	Name string
+}
+
+type codecGobPtr struct {
+	Name string
+}
+
+func init() {
+	// registered as pointer by gob only.
+	gob.Register(&codecGobPtr{})
+}
+
+func TestRegisterType(t *testing.T) {
+	test := assert.New(t)
+
+	// ok
+	test.NoError(cm.RegisterType(codecUser{}))
+	test.NoError(cm.RegisterType(&codecUser{}))
+	// ok: multiple registration of the same type
+	test.NoError(cm.RegisterType(codecUser{}))
+
+	// error: name is used by another type
+	err := cm.RegisterTypeName("github.com/patrickascher/gofw/cache_test.codecUser", codecOther{})
+	test.Error(err)
+	test.Equal(fmt.Sprintf(cm.ErrTypeName.Error(), "github.com/patrickascher/gofw/cache_test.codecUser", "cache_test.codecUser"), err.Error())
+}
+
+func TestCodec(t *testing.T) {
+	test := assert.New(t)
+	test.NoError(cm.RegisterType(codecUser{}))
+	test.NoError(cm.RegisterType(&codecUser{}))
+
+	now := time.Now().UTC().Round(0)
+	values := []interface{}{
+		nil, true, false, "foo", "", []byte("bar"),
+		int(-5), int8(-8), int16(16), int32(-32), int64(1 << 40),
+		uint(5), uint8(8), uint16(16), uint32(32), uint64(1 << 60),
+		float32(1.5), float64(-3.25),
+		now, 5 * time.Second,
+		[]string{"a", "b"}, map[string]string{"a": "b"},
+		codecUser{Name: "John", Age: 42, Tags: []string{"admin"}, Created: now},
+		&codecUser{Name: "Jane"},
+	}
+
+	for name, codec := range map[string]cm.Codec{"gob": cm.Gob, "json": cm.JSON, "binary": cm.Binary} {
+		t.Run(name, func(t *testing.T) {
+			for _, v := range values {
+				// ok
+				b, err := codec.Encode(v)
+				assert.NoError(t, err)
+				rv, err := codec.Decode(b)
+				assert.NoError(t, err)
+				assert.Equal(t, v, rv, fmt.Sprintf("%T", v))
+			}
+
+			// error: type is not registered
+			_, err := codec.Encode(codecUnregistered{Name: "foo"})
+			assert.Error(t, err)
+
+			// error: invalid data
+			_, err = codec.Decode([]byte{})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCodec_GobPointer(t *testing.T) {
+	test := assert.New(t)
+	test.NoError(cm.RegisterType(codecUser{}))
+
+	u := &codecUser{Name: "John"}
+	uu := &u
+	var nilUser *codecUser
+	for _, v := range []interface{}{u, uu, &codecGobPtr{Name: "Jane"}, codecGobPtr{Name: "Jane"}, nilUser} {
+		b, err := cm.Gob.Encode(v)
+		test.NoError(err)
+		rv, err := cm.Gob.Decode(b)
+		test.NoError(err)
+		if v == nilUser {
+			test.Nil(rv)
+			continue
+		}
+		test.Equal(v, rv, fmt.Sprintf("%T", v))
+		test.IsType(v, rv)
+	}
+}
+
+func TestCodec_Binary(t *testing.T) {
+	test := assert.New(t)
+
+	// ok: basic types are compact
+	b, err := cm.Binary.Encode(int64(1))
+	test.NoError(err)
+	test.Equal(2, len(b))
+	b, err = cm.Binary.Encode("foo")
+	test.NoError(err)
+	test.Equal(4, len(b))
+
+	// error: corrupt data
+	for _, data := range [][]byte{{255}, {3}, {13, 1}, {19, 10, 'a'}} {
+		_, err = cm.Binary.Decode(data)
+		test.Error(err)
+	}
+}
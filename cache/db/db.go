@@ -0,0 +1,678 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package db implements the cache.Interface and registers a database provider.
+// The items are stored in a table by the sqlquery.Builder. Like this a shared cache can be used
+// without an additional cache service.
+//
+// The table must exist and needs the following columns (mysql example):
+//
+//	CREATE TABLE `cache` (
+//		`id` VARCHAR(255) NOT NULL PRIMARY KEY,
+//		`value` LONGBLOB NOT NULL,
+//		`tags` VARCHAR(1024) NOT NULL DEFAULT '',
+//		`expire` BIGINT NOT NULL DEFAULT 0,
+//		INDEX (`expire`)
+//	);
+//
+// The expire column holds the expiration as unix nano, 0 means infinity.
+//
+// Values are encoded by the Options.Codec (default cache.Gob). Custom types must be registered with cache.RegisterType before they are set.
+// Atomic operations are using optimistic updates, where the old value is part of the condition.
+//
+// Check the db.Options for the available configurations.
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cm "github.com/patrickascher/gofw/cache"
+	"github.com/patrickascher/gofw/sqlquery"
+)
+
+// init register the db provider.
+func init() {
+	_ = cm.Register(cm.DB, New)
+}
+
+// defaults of the db provider.
+var (
+	defaultTable      = "cache"
+	defaultGCInterval = 60
+	defaultGCBatch    = 500
+	defaultMaxRetries = 100
+)
+
+// tagSeparator is used to store the tags in one column.
+const tagSeparator = ","
+
+// Error messages
+var (
+	ErrKeyNotExist = errors.New("cache/db: key %v does not exist")
+	ErrBuilder     = errors.New("cache/db: option Builder is mandatory")
+	ErrTag         = errors.New("cache/db: tag %v must not contain a " + tagSeparator)
+	ErrTransaction = errors.New("cache/db: update of key %v failed after %d retries")
+)
+
+// db cache provider
+type db struct {
+	options     Options
+	builder     sqlquery.Builder
+	hits        uint64
+	misses      uint64
+	expirations uint64
+	closing     chan struct{}
+	closed      sync.Once
+}
+
+// Options for the db provider.
+type Options struct {
+	// Builder which is used for the queries. Mandatory.
+	Builder sqlquery.Builder
+	// Table name. Default is "cache".
+	Table string
+	// GCInterval of the garbage collector. Default is 60 seconds.
+	GCInterval time.Duration
+	// GCBatch is the maximum number of expired rows which are deleted in one query. Default is 500.
+	GCBatch int
+	// Codec to encode the values. Default is cache.Gob.
+	Codec cm.Codec
+}
+
+// item implements the Valuer interface
+type item struct {
+	val interface{}
+}
+
+// Value returns the value of the item.
+func (i *item) Value() interface{} {
+	return i.val
+}
+
+// row of the cache table.
+type row struct {
+	value  []byte
+	tags   string
+	expire int64
+}
+
+// expired returns a bool if the row is expired.
+func (r row) expired() bool {
+	return r.expire != 0 && r.expire < time.Now().UnixNano()
+}
+
+// New creates a db cache by the given options.
+func New(opt interface{}) cm.Interface {
+	options := Options{}
+	if opt != nil {
+		options = opt.(Options)
+	}
+	if options.Table == "" {
+		options.Table = defaultTable
+	}
+	if options.GCInterval <= 0 {
+		options.GCInterval = time.Duration(defaultGCInterval) * time.Second
+	}
+	if options.GCBatch <= 0 {
+		options.GCBatch = defaultGCBatch
+	}
+	if options.Codec == nil {
+		options.Codec = cm.Gob
+	}
+	return &db{options: options, builder: options.Builder, closing: make(chan struct{})}
+}
+
+// Get returns the value of the given key.
+// Error will return if the key does not exist or is expired.
+func (d *db) Get(key string) (cm.Valuer, error) {
+	r, err := d.row(key)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil || r.expired() {
+		atomic.AddUint64(&d.misses, 1)
+		return nil, fmt.Errorf(ErrKeyNotExist.Error(), key)
+	}
+
+	atomic.AddUint64(&d.hits, 1)
+	return d.decode(r.value)
+}
+
+// GetPrefixed returns all items with the given prefix as map.
+// Expired items are skipped.
+func (d *db) GetPrefixed(prefix string) map[string]cm.Valuer {
+	rv := make(map[string]cm.Valuer)
+	if d.check() != nil {
+		return rv
+	}
+
+	rows, err := d.builder.Select(d.options.Table).
+		Columns("id", "value", "expire").
+		Where(d.column("id")+" LIKE ?", like(prefix)).
+		Where("("+d.column("expire")+" = 0 OR "+d.column("expire")+" >= ?)", time.Now().UnixNano()).
+		All()
+	if err != nil {
+		return rv
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		r := row{}
+		if err := rows.Scan(&key, &r.value, &r.expire); err != nil {
+			continue
+		}
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if v, err := d.decode(r.value); err == nil {
+			rv[key] = v
+		}
+	}
+
+	return rv
+}
+
+// GetAll returns all items of the cache as map.
+func (d *db) GetAll() map[string]cm.Valuer {
+	return d.GetPrefixed("")
+}
+
+// Set key/value pair.
+// The ttl can be set by duration or forever with cache.INFINITY.
+// Tags must not contain a comma.
+func (d *db) Set(key string, value interface{}, ttl time.Duration, tags ...string) error {
+	b, err := d.encode(value)
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if strings.Contains(tag, tagSeparator) {
+			return fmt.Errorf(ErrTag.Error(), tag)
+		}
+	}
+	return d.set(key, row{value: b, tags: joinTags(tags), expire: expire(ttl)})
+}
+
+// Exist returns true if the key exists and is not expired.
+func (d *db) Exist(key string) bool {
+	r, err := d.row(key)
+	return err == nil && r != nil && !r.expired()
+}
+
+// Delete removes a given key from the cache.
+// Error will return if the key does not exist.
+func (d *db) Delete(key string) error {
+	if err := d.check(); err != nil {
+		return err
+	}
+
+	res, err := d.builder.Delete(d.options.Table).Where(d.column("id")+" = ?", key).Exec()
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf(ErrKeyNotExist.Error(), key)
+	}
+	return nil
+}
+
+// DeleteAll removes all items from the cache.
+func (d *db) DeleteAll() error {
+	if err := d.check(); err != nil {
+		return err
+	}
+
+	_, err := d.builder.Delete(d.options.Table).Exec()
+	return err
+}
+
+// DeletePrefixed removes all items with the given prefix.
+func (d *db) DeletePrefixed(prefix string) error {
+	if err := d.check(); err != nil {
+		return err
+	}
+
+	keys, err := d.keys(d.column("id")+" LIKE ?", like(prefix))
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for _, key := range keys {
+		if strings.HasPrefix(key, prefix) {
+			ids = append(ids, key)
+		}
+	}
+	return d.deleteKeys(ids)
+}
+
+// DeleteTagged removes all items which have at least one of the given tags.
+// The rows are pre-selected by LIKE and the tags are compared exactly afterwards, because the tag can contain wildcards.
+func (d *db) DeleteTagged(tags ...string) error {
+	if err := d.check(); err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		keys, err := d.tagged(tag)
+		if err != nil {
+			return err
+		}
+		err = d.deleteKeys(keys)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Increment the integer value of the key by delta and returns the new value.
+// If the key does not exist or is expired, it will be created with the given ttl.
+// The ttl and tags of an existing key are not changed.
+// Error will return if the value is not an integer.
+func (d *db) Increment(key string, delta int64, ttl time.Duration) (int64, error) {
+	var v int64
+	_, err := d.update(key, func(r *row) (*row, error) {
+		v = 0
+		n := &row{expire: expire(ttl)}
+		if r != nil {
+			cur, err := d.decode(r.value)
+			if err != nil {
+				return nil, err
+			}
+			v, err = cm.Int64(key, cur.Value())
+			if err != nil {
+				return nil, err
+			}
+			n.expire, n.tags = r.expire, r.tags
+		}
+		v += delta
+
+		b, err := d.encode(v)
+		if err != nil {
+			return nil, err
+		}
+		n.value = b
+		return n, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return v, nil
+}
+
+// Decrement the integer value of the key by delta and returns the new value.
+// See Increment for more details.
+func (d *db) Decrement(key string, delta int64, ttl time.Duration) (int64, error) {
+	return d.Increment(key, -delta, ttl)
+}
+
+// SetIfNotExists sets the value only if the key does not exist or is expired.
+// True will return if the value was set.
+func (d *db) SetIfNotExists(key string, value interface{}, ttl time.Duration) (bool, error) {
+	b, err := d.encode(value)
+	if err != nil {
+		return false, err
+	}
+	return d.update(key, func(r *row) (*row, error) {
+		if r != nil {
+			return nil, nil
+		}
+		return &row{value: b, expire: expire(ttl)}, nil
+	})
+}
+
+// CompareAndSwap sets the new value only if the key exists, is not expired and its value is equal to old.
+// The values are compared with reflect.DeepEqual, the tags of the key are kept.
+// True will return if the value was swapped.
+func (d *db) CompareAndSwap(key string, old interface{}, new interface{}, ttl time.Duration) (bool, error) {
+	b, err := d.encode(new)
+	if err != nil {
+		return false, err
+	}
+	return d.update(key, func(r *row) (*row, error) {
+		if r == nil {
+			return nil, nil
+		}
+		cur, err := d.decode(r.value)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(cur.Value(), old) {
+			return nil, nil
+		}
+		return &row{value: b, tags: r.tags, expire: expire(ttl)}, nil
+	})
+}
+
+// Stats returns the hits, misses and expirations of this instance and the number of valid rows.
+func (d *db) Stats() cm.Stats {
+	rv := cm.Stats{
+		Hits:        atomic.LoadUint64(&d.hits),
+		Misses:      atomic.LoadUint64(&d.misses),
+		Expirations: atomic.LoadUint64(&d.expirations),
+	}
+	if d.check() != nil {
+		return rv
+	}
+
+	r, err := d.builder.Select(d.options.Table).
+		Columns(sqlquery.Raw("COUNT(*)")).
+		Where("("+d.column("expire")+" = 0 OR "+d.column("expire")+" >= ?)", time.Now().UnixNano()).
+		First()
+	if err == nil {
+		_ = r.Scan(&rv.Items)
+	}
+	return rv
+}
+
+// GC is an infinity loop. The loop will rerun after an specific interval time which can be set
+// in the options (default 60sec).
+// The loop ends if the cache gets closed.
+func (d *db) GC() {
+	ticker := time.NewTicker(d.options.GCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.closing:
+			return
+		case <-ticker.C:
+			_ = d.gc()
+		}
+	}
+}
+
+// Close stops the garbage collector.
+// The builder is not closed, because it is owned by the application.
+func (d *db) Close() error {
+	d.closed.Do(func() { close(d.closing) })
+	return nil
+}
+
+// gc deletes the expired rows in batches of Options.GCBatch.
+// The expiration is checked on delete again, like this a row which was set in the meantime is not deleted.
+func (d *db) gc() error {
+	if err := d.check(); err != nil {
+		return err
+	}
+
+	now := time.Now().UnixNano()
+	expired := d.column("expire") + " > 0 AND " + d.column("expire") + " < ?"
+	for {
+		rows, err := d.builder.Select(d.options.Table).Columns("id").Where(expired, now).Limit(d.options.GCBatch).All()
+		if err != nil {
+			return err
+		}
+		keys, err := scanKeys(rows)
+		if err != nil || len(keys) == 0 {
+			return err
+		}
+
+		res, err := d.builder.Delete(d.options.Table).Where(d.column("id")+" IN (?)", keys).Where(expired, now).Exec()
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil {
+			atomic.AddUint64(&d.expirations, uint64(n))
+		}
+		if len(keys) < d.options.GCBatch {
+			return nil
+		}
+	}
+}
+
+// check if a builder is defined.
+func (d *db) check() error {
+	if d.builder.Driver() == nil {
+		return ErrBuilder
+	}
+	return nil
+}
+
+// column returns the quoted column name.
+func (d *db) column(name string) string {
+	return d.builder.QuoteIdentifier(name)
+}
+
+// row returns the row of the given key.
+// Nil will return if the key does not exist.
+func (d *db) row(key string) (*row, error) {
+	if err := d.check(); err != nil {
+		return nil, err
+	}
+
+	res, err := d.builder.Select(d.options.Table).
+		Columns("value", "tags", "expire").
+		Where(d.column("id")+" = ?", key).
+		First()
+	if err != nil {
+		return nil, err
+	}
+
+	r := row{}
+	err = res.Scan(&r.value, &r.tags, &r.expire)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// keys returns all keys of the given condition.
+func (d *db) keys(where string, args ...interface{}) ([]string, error) {
+	rows, err := d.builder.Select(d.options.Table).Columns("id").Where(where, args...).All()
+	if err != nil {
+		return nil, err
+	}
+	return scanKeys(rows)
+}
+
+// tagged returns all keys which have the given tag.
+func (d *db) tagged(tag string) ([]string, error) {
+	rows, err := d.builder.Select(d.options.Table).
+		Columns("id", "tags").
+		Where(d.column("tags")+" LIKE ?", "%"+like(tagSeparator+tag+tagSeparator)).
+		All()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key, tags string
+		if err := rows.Scan(&key, &tags); err != nil {
+			return nil, err
+		}
+		for _, t := range strings.Split(strings.Trim(tags, tagSeparator), tagSeparator) {
+			if t == tag {
+				keys = append(keys, key)
+				break
+			}
+		}
+	}
+	return keys, rows.Err()
+}
+
+// scanKeys returns the keys of the rows and closes them.
+func scanKeys(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// deleteKeys deletes the rows of the given keys in batches.
+func (d *db) deleteKeys(keys []string) error {
+	for len(keys) > 0 {
+		n := len(keys)
+		if n > d.options.GCBatch {
+			n = d.options.GCBatch
+		}
+		_, err := d.builder.Delete(d.options.Table).Where(d.column("id")+" IN (?)", keys[:n]).Exec()
+		if err != nil {
+			return err
+		}
+		keys = keys[n:]
+	}
+	return nil
+}
+
+// set updates the row of the key or inserts it if it does not exist.
+// If the insert fails because the key was inserted in the meantime, the update is retried.
+func (d *db) set(key string, r row) error {
+	if err := d.check(); err != nil {
+		return err
+	}
+
+	values := map[string]interface{}{"value": r.value, "tags": r.tags, "expire": r.expire}
+	for n := 0; n < defaultMaxRetries; n++ {
+		res, err := d.builder.Update(d.options.Table).Set(values).Where(d.column("id")+" = ?", key).Exec()
+		if err != nil {
+			return err
+		}
+		if affected, err := res.RowsAffected(); err == nil && affected > 0 {
+			return nil
+		}
+
+		values["id"] = key
+		_, err = d.builder.Insert(d.options.Table).Values([]map[string]interface{}{values}).Exec()
+		delete(values, "id")
+		if err == nil {
+			return nil
+		}
+		// some drivers return 0 affected rows if the values did not change.
+		if cur, rErr := d.row(key); rErr == nil && cur != nil {
+			if bytes.Equal(cur.value, r.value) && cur.tags == r.tags && cur.expire == r.expire {
+				return nil
+			}
+			continue
+		}
+		return err
+	}
+	return fmt.Errorf(ErrTransaction.Error(), key, defaultMaxRetries)
+}
+
+// update runs an optimistic update on the given key.
+// The function receives the current row (nil if it does not exist or is expired) and returns the new row.
+// If the returned row is nil, nothing will be written.
+// The old value is part of the update condition, if the row was changed in the meantime the update is retried.
+// True will return if the row was written.
+func (d *db) update(key string, fn func(*row) (*row, error)) (bool, error) {
+	if err := d.check(); err != nil {
+		return false, err
+	}
+
+	for n := 0; n < defaultMaxRetries; n++ {
+		cur, err := d.row(key)
+		if err != nil {
+			return false, err
+		}
+
+		// expired rows are removed first.
+		if cur != nil && cur.expired() {
+			_, err = d.builder.Delete(d.options.Table).Where(d.column("id")+" = ? AND "+d.column("expire")+" = ?", key, cur.expire).Exec()
+			if err != nil {
+				return false, err
+			}
+			cur = nil
+		}
+
+		r, err := fn(cur)
+		if err != nil || r == nil {
+			return false, err
+		}
+
+		values := map[string]interface{}{"value": r.value, "tags": r.tags, "expire": r.expire}
+		if cur == nil {
+			values["id"] = key
+			_, err = d.builder.Insert(d.options.Table).Values([]map[string]interface{}{values}).Exec()
+			if err == nil {
+				return true, nil
+			}
+			// the key was inserted in the meantime
+			if exists, rErr := d.row(key); rErr == nil && exists != nil {
+				continue
+			}
+			return false, err
+		}
+
+		res, err := d.builder.Update(d.options.Table).Set(values).
+			Where(d.column("id")+" = ? AND "+d.column("value")+" = ? AND "+d.column("expire")+" = ?", key, blob{cur.value}, cur.expire).
+			Exec()
+		if err != nil {
+			return false, err
+		}
+		if affected, err := res.RowsAffected(); err == nil && affected > 0 {
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf(ErrTransaction.Error(), key, defaultMaxRetries)
+}
+
+// expire returns the expiration of the ttl as unix nano.
+func expire(ttl time.Duration) int64 {
+	if ttl == cm.INFINITY {
+		return 0
+	}
+	return time.Now().Add(ttl).UnixNano()
+}
+
+// joinTags returns the tags as one string.
+// The tags are wrapped by the separator, like this a LIKE condition can be used.
+func joinTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return tagSeparator + strings.Join(tags, tagSeparator) + tagSeparator
+}
+
+// like returns a LIKE pattern which starts with the given string.
+// The wildcard characters % and _ are replaced by _, which could match more rows.
+// Because the escape character differs between the databases, the result must be filtered again.
+func like(s string) string {
+	return strings.Replace(s, "%", "_", -1) + "%"
+}
+
+// blob wraps a byte slice for conditions, because slices are expanded by the sqlquery condition.
+type blob struct {
+	b []byte
+}
+
+// Value implements the driver.Valuer interface.
+func (b blob) Value() (driver.Value, error) {
+	return b.b, nil
+}
+
+// encode the given value with the codec.
+func (d *db) encode(value interface{}) ([]byte, error) {
+	return d.options.Codec.Encode(value)
+}
+
+// decode the given bytes into a Valuer.
+func (d *db) decode(b []byte) (cm.Valuer, error) {
+	v, err := d.options.Codec.Decode(b)
+	if err != nil {
+		return nil, err
+	}
+	return &item{val: v}, nil
+}
@@ -0,0 +1,251 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	cm "github.com/patrickascher/gofw/cache"
+	"github.com/patrickascher/gofw/cache/db"
+	"github.com/patrickascher/gofw/sqlquery"
+	_ "github.com/patrickascher/gofw/sqlquery/driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+// newDB returns a db cache with an empty cache table.
+func newDB(t *testing.T) cm.Interface {
+	return db.New(db.Options{Builder: newBuilder(t), GCBatch: 2})
+}
+
+// newBuilder returns a builder with an empty cache table.
+func newBuilder(t *testing.T) sqlquery.Builder {
+	cfg := sqlquery.Config{
+		Driver:   "mysql",
+		Host:     "127.0.0.1",
+		Port:     3319,
+		Username: "root",
+		Password: "root",
+		Database: "gofw",
+	}
+	b, err := sqlquery.New(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = b.Driver().Connection().Exec("CREATE TABLE IF NOT EXISTS `cache` (`id` VARCHAR(255) NOT NULL PRIMARY KEY, `value` LONGBLOB NOT NULL, `tags` VARCHAR(1024) NOT NULL DEFAULT '', `expire` BIGINT NOT NULL DEFAULT 0, INDEX (`expire`))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = b.Delete("cache").Exec()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+func TestDB_New(t *testing.T) {
+	// error: no builder
+	c, err := cm.New(cm.DB, nil)
+	assert.NoError(t, err)
+	assert.Error(t, c.Set("foo", "bar", cm.INFINITY))
+	_, err = c.Get("foo")
+	assert.Error(t, err)
+}
+
+func TestDB_SetGet(t *testing.T) {
+	c := newDB(t)
+
+	// ok
+	assert.NoError(t, c.Set("foo", "bar", cm.INFINITY))
+	assert.NoError(t, c.Set("foo", "BAR", cm.INFINITY))
+	assert.NoError(t, c.Set("int", 42, cm.INFINITY))
+	assert.NoError(t, c.Set("ttl", 42, 10*time.Millisecond))
+
+	v, err := c.Get("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "BAR", v.Value())
+	v, err = c.Get("int")
+	assert.NoError(t, err)
+	assert.Equal(t, 42, v.Value())
+	assert.True(t, c.Exist("ttl"))
+
+	// error: expired
+	time.Sleep(20 * time.Millisecond)
+	_, err = c.Get("ttl")
+	assert.Error(t, err)
+	assert.False(t, c.Exist("ttl"))
+
+	// error: key does not exist
+	_, err = c.Get("none")
+	assert.Error(t, err)
+
+	assert.Equal(t, cm.Stats{Hits: 2, Misses: 2, Items: 2}, c.Stats())
+}
+
+func TestDB_GetAllPrefixed(t *testing.T) {
+	c := newDB(t)
+
+	assert.NoError(t, c.Set("user:1", 1, cm.INFINITY))
+	assert.NoError(t, c.Set("user:2", 2, cm.INFINITY))
+	// wildcards are escaped
+	assert.NoError(t, c.Set("user%3", 3, cm.INFINITY))
+	assert.NoError(t, c.Set("user_4", 4, cm.INFINITY))
+
+	assert.Equal(t, 4, len(c.GetAll()))
+	assert.Equal(t, 2, len(c.GetPrefixed("user:")))
+	assert.Equal(t, 1, len(c.GetPrefixed("user%")))
+
+	assert.NoError(t, c.DeletePrefixed("user:"))
+	assert.Equal(t, 2, len(c.GetAll()))
+}
+
+func TestDB_Delete(t *testing.T) {
+	c := newDB(t)
+
+	assert.NoError(t, c.Set("foo", "bar", cm.INFINITY, "t1"))
+	assert.NoError(t, c.Set("bar", "foo", cm.INFINITY, "t1", "t_2"))
+	assert.NoError(t, c.Set("baz", "foo", cm.INFINITY))
+	assert.NoError(t, c.Set("qux", "foo", cm.INFINITY, "tx2", "t%"))
+
+	// ok
+	assert.NoError(t, c.DeleteTagged("t_2"))
+	assert.False(t, c.Exist("bar"))
+	assert.True(t, c.Exist("foo"))
+	// ok: wildcards in the tag are compared exactly
+	assert.True(t, c.Exist("qux"))
+	assert.NoError(t, c.DeleteTagged("%"))
+	assert.True(t, c.Exist("qux"))
+	assert.NoError(t, c.DeleteTagged("t%"))
+	assert.False(t, c.Exist("qux"))
+	assert.NoError(t, c.Delete("foo"))
+	assert.False(t, c.Exist("foo"))
+
+	// error: key does not exist
+	assert.Error(t, c.Delete("foo"))
+
+	// ok: delete all
+	assert.NoError(t, c.DeleteAll())
+	assert.Equal(t, 0, len(c.GetAll()))
+}
+
+func TestDB_Atomic(t *testing.T) {
+	c := newDB(t)
+
+	// increment
+	v, err := c.Increment("counter", 2, cm.INFINITY)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), v)
+	v, err = c.Decrement("counter", 5, cm.INFINITY)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-3), v)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.Increment("counter", 1, cm.INFINITY)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	val, err := c.Get("counter")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(17), val.Value())
+
+	// error: no integer
+	assert.NoError(t, c.Set("string", "foo", cm.INFINITY))
+	_, err = c.Increment("string", 1, cm.INFINITY)
+	assert.Error(t, err)
+
+	// set if not exists
+	ok, err := c.SetIfNotExists("lock", "a", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = c.SetIfNotExists("lock", "b", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// compare and swap
+	ok, err = c.CompareAndSwap("lock", "b", "c", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = c.CompareAndSwap("lock", "a", "c", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	val, err = c.Get("lock")
+	assert.NoError(t, err)
+	assert.Equal(t, "c", val.Value())
+
+	// ok: the tags are kept
+	assert.NoError(t, c.Set("tagged", "a", cm.INFINITY, "locks"))
+	ok, err = c.CompareAndSwap("tagged", "a", "b", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.NoError(t, c.DeleteTagged("locks"))
+	assert.False(t, c.Exist("tagged"))
+}
+
+func TestDB_GC(t *testing.T) {
+	c := db.New(db.Options{Builder: newBuilder(t), GCBatch: 2, GCInterval: 10 * time.Millisecond})
+	defer c.Close()
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, c.Set(fmt.Sprintf("exp:%d", i), i, time.Millisecond))
+	}
+	assert.NoError(t, c.Set("foo", "bar", cm.INFINITY))
+	time.Sleep(5 * time.Millisecond)
+
+	// ok: expired rows are deleted in batches
+	go c.GC()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, uint64(5), c.Stats().Expirations)
+	assert.Equal(t, 1, c.Stats().Items)
+	assert.True(t, c.Exist("foo"))
+}
+
+func TestDB_Close(t *testing.T) {
+	c := db.New(db.Options{GCInterval: time.Millisecond})
+
+	done := make(chan struct{})
+	go func() {
+		c.GC()
+		close(done)
+	}()
+
+	// ok: gc stops
+	assert.NoError(t, c.Close())
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("gc was not stopped")
+	}
+	assert.NoError(t, c.Close())
+}
+
+func TestDB_Codec(t *testing.T) {
+	b := newBuilder(t)
+
+	for _, codec := range []cm.Codec{cm.JSON, cm.Binary} {
+		c := db.New(db.Options{Builder: b, Codec: codec})
+		assert.NoError(t, c.Set("foo", []string{"a", "b"}, cm.INFINITY))
+		v, err := c.Get("foo")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"a", "b"}, v.Value())
+
+		// ok: atomic operations
+		i, err := c.Increment("counter", 2, cm.INFINITY)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), i)
+		assert.NoError(t, c.DeleteAll())
+
+		// error: type is not registered
+		assert.Error(t, c.Set("struct", struct{ A int }{A: 1}, cm.INFINITY))
+	}
+}
@@ -0,0 +1,501 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package file implements the cache.Interface and registers a file provider.
+// Each item is stored in its own file, which contains the key, value, ttl and tags.
+// Like this the cache survives a restart of the application.
+//
+// Files are written to a temporary file first, which gets synced and renamed. The directory is synced after the rename,
+// like this a crash never leaves a half written item behind or loses a finished write.
+// All operations are using a sync.RWMutex for synchronization.
+//
+// The item file is gob encoded, the value itself is encoded by the Options.Codec (default cache.Gob).
+// Custom types must be registered with cache.RegisterType before they are set.
+//
+// Check the file.Options for the available configurations.
+package file
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	cm "github.com/patrickascher/gofw/cache"
+)
+
+// init register the file provider.
+func init() {
+	_ = cm.Register(cm.FILE, New)
+}
+
+// defaultGCInterval holds the garbage collector waiting time in seconds.
+var defaultGCInterval = 60
+
+// file extensions.
+const (
+	extension    = ".cache"
+	tmpExtension = ".tmp"
+)
+
+// Error messages
+var (
+	ErrKeyNotExist = errors.New("cache/file: key %v does not exist")
+)
+
+// file cache provider
+type file struct {
+	mutex       sync.RWMutex
+	options     Options
+	hits        uint64
+	misses      uint64
+	expirations uint64
+	closing     chan struct{}
+	closed      sync.Once
+}
+
+// Options for the file provider.
+type Options struct {
+	// Directory where the cache files are stored. It will be created if it does not exist.
+	// The directory should only be used by this cache, because DeleteAll removes all cache files of it.
+	// Default is a directory per application in os temp dir/gofw-cache, named by the executable and the hash of its path.
+	Directory string
+	// GCInterval of the garbage collector. Default is 60 seconds.
+	GCInterval time.Duration
+	// Codec to encode the values. Default is cache.Gob.
+	Codec cm.Codec
+}
+
+// item implements the Valuer interface.
+// The exported fields are gob encoded, Data holds the value encoded by the codec.
+type item struct {
+	Key     string
+	Data    []byte
+	val     interface{}
+	TTL     time.Duration
+	Created time.Time
+	Tags    []string
+}
+
+// Value returns the value of the item.
+func (i *item) Value() interface{} {
+	return i.val
+}
+
+// expired returns a bool if the value is expired.
+func (i *item) expired() bool {
+	if i.TTL == cm.INFINITY {
+		return false
+	}
+	return time.Now().Sub(i.Created) > i.TTL
+}
+
+// New creates a file cache by the given options.
+func New(opt interface{}) cm.Interface {
+	options := Options{}
+	if opt != nil {
+		options = opt.(Options)
+	}
+	if options.Directory == "" {
+		options.Directory = defaultDirectory()
+	}
+	if options.GCInterval <= 0 {
+		options.GCInterval = time.Duration(defaultGCInterval) * time.Second
+	}
+	if options.Codec == nil {
+		options.Codec = cm.Gob
+	}
+	return &file{options: options, closing: make(chan struct{})}
+}
+
+// Get returns the value of the given key.
+// Error will return if the key does not exist or is expired.
+func (f *file) Get(key string) (cm.Valuer, error) {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	i, err := f.read(f.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			atomic.AddUint64(&f.misses, 1)
+			return nil, fmt.Errorf(ErrKeyNotExist.Error(), key)
+		}
+		return nil, err
+	}
+	if i.expired() {
+		atomic.AddUint64(&f.misses, 1)
+		return nil, fmt.Errorf(ErrKeyNotExist.Error(), key)
+	}
+
+	atomic.AddUint64(&f.hits, 1)
+	return i, nil
+}
+
+// GetPrefixed returns all items with the given prefix as map.
+// Expired items are skipped.
+func (f *file) GetPrefixed(prefix string) map[string]cm.Valuer {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	rv := make(map[string]cm.Valuer)
+	for _, i := range f.items() {
+		if strings.HasPrefix(i.Key, prefix) && !i.expired() {
+			rv[i.Key] = i
+		}
+	}
+	return rv
+}
+
+// GetAll returns all items of the cache as map.
+func (f *file) GetAll() map[string]cm.Valuer {
+	return f.GetPrefixed("")
+}
+
+// Set key/value pair.
+// The ttl can be set by duration or forever with cache.INFINITY.
+func (f *file) Set(key string, value interface{}, ttl time.Duration, tags ...string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.write(&item{Key: key, val: value, TTL: ttl, Created: time.Now(), Tags: tags})
+}
+
+// Exist returns true if the key exists and is not expired.
+func (f *file) Exist(key string) bool {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	i, err := f.read(f.path(key))
+	return err == nil && !i.expired()
+}
+
+// Delete removes a given key from the cache.
+// Error will return if the key does not exist.
+func (f *file) Delete(key string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	err := os.Remove(f.path(key))
+	if os.IsNotExist(err) {
+		return fmt.Errorf(ErrKeyNotExist.Error(), key)
+	}
+	return err
+}
+
+// DeleteAll removes all items from the cache.
+func (f *file) DeleteAll() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.deleteBy(func(*item) bool { return true })
+}
+
+// DeletePrefixed removes all items with the given prefix.
+func (f *file) DeletePrefixed(prefix string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.deleteBy(func(i *item) bool { return strings.HasPrefix(i.Key, prefix) })
+}
+
+// DeleteTagged removes all items which have at least one of the given tags.
+func (f *file) DeleteTagged(tags ...string) error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return f.deleteBy(func(i *item) bool {
+		for _, tag := range tags {
+			for _, t := range i.Tags {
+				if t == tag {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+// Increment the integer value of the key by delta and returns the new value.
+// If the key does not exist or is expired, it will be created with the given ttl.
+// The ttl and tags of an existing key are not changed.
+// Error will return if the value is not an integer.
+func (f *file) Increment(key string, delta int64, ttl time.Duration) (int64, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	i := &item{Key: key, TTL: ttl, Created: time.Now()}
+	var v int64
+	if cur, ok := f.valid(key); ok {
+		var err error
+		v, err = cm.Int64(key, cur.val)
+		if err != nil {
+			return 0, err
+		}
+		i = cur
+	}
+	v += delta
+	i.val = v
+
+	return v, f.write(i)
+}
+
+// Decrement the integer value of the key by delta and returns the new value.
+// See Increment for more details.
+func (f *file) Decrement(key string, delta int64, ttl time.Duration) (int64, error) {
+	return f.Increment(key, -delta, ttl)
+}
+
+// SetIfNotExists sets the value only if the key does not exist or is expired.
+// True will return if the value was set.
+func (f *file) SetIfNotExists(key string, value interface{}, ttl time.Duration) (bool, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, ok := f.valid(key); ok {
+		return false, nil
+	}
+	err := f.write(&item{Key: key, val: value, TTL: ttl, Created: time.Now()})
+	return err == nil, err
+}
+
+// CompareAndSwap sets the new value only if the key exists, is not expired and its value is equal to old.
+// The values are compared with reflect.DeepEqual, the tags of the key are kept.
+// True will return if the value was swapped.
+func (f *file) CompareAndSwap(key string, old interface{}, new interface{}, ttl time.Duration) (bool, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	cur, ok := f.valid(key)
+	if !ok || !reflect.DeepEqual(cur.val, old) {
+		return false, nil
+	}
+	err := f.write(&item{Key: key, val: new, TTL: ttl, Created: time.Now(), Tags: cur.Tags})
+	return err == nil, err
+}
+
+// Stats returns the hits, misses and expirations of this instance.
+// Items and Size are calculated by the existing files.
+func (f *file) Stats() cm.Stats {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	rv := cm.Stats{
+		Hits:        atomic.LoadUint64(&f.hits),
+		Misses:      atomic.LoadUint64(&f.misses),
+		Expirations: atomic.LoadUint64(&f.expirations),
+	}
+	files, _ := filepath.Glob(filepath.Join(f.options.Directory, "*"+extension))
+	for _, name := range files {
+		if info, err := os.Stat(name); err == nil {
+			rv.Items++
+			rv.Size += info.Size()
+		}
+	}
+	return rv
+}
+
+// GC is an infinity loop. The loop will rerun after an specific interval time which can be set
+// in the options (default 60sec).
+// Expired items and temporary files which are older than the interval (crashed writes) are removed.
+// The loop ends if the cache gets closed.
+func (f *file) GC() {
+	ticker := time.NewTicker(f.options.GCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-f.closing:
+			return
+		case <-ticker.C:
+			f.gc()
+		}
+	}
+}
+
+// Close stops the garbage collector.
+// The files are not removed, like this the items are available after a restart.
+func (f *file) Close() error {
+	f.closed.Do(func() { close(f.closing) })
+	return nil
+}
+
+// gc removes all expired items, files which can not be decoded and left temporary files.
+func (f *file) gc() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	_ = f.deleteBy(func(i *item) bool {
+		if i.expired() {
+			atomic.AddUint64(&f.expirations, 1)
+			return true
+		}
+		return false
+	})
+
+	tmp, _ := filepath.Glob(filepath.Join(f.options.Directory, "*"+tmpExtension))
+	for _, name := range tmp {
+		if info, err := os.Stat(name); err == nil && time.Now().Sub(info.ModTime()) > f.options.GCInterval {
+			_ = os.Remove(name)
+		}
+	}
+}
+
+// path returns the filepath of the key.
+// The key is hashed, like this any key can be used without escaping.
+func (f *file) path(key string) string {
+	h := sha1.Sum([]byte(key))
+	return filepath.Join(f.options.Directory, hex.EncodeToString(h[:])+extension)
+}
+
+// valid returns the item if it exists and is not expired.
+// The caller must hold the lock.
+func (f *file) valid(key string) (*item, bool) {
+	i, err := f.read(f.path(key))
+	if err != nil || i.expired() {
+		return nil, false
+	}
+	return i, true
+}
+
+// items returns all items of the directory.
+// Files which can not be decoded are skipped.
+// The caller must hold the lock.
+func (f *file) items() map[string]*item {
+	rv := make(map[string]*item)
+	files, _ := filepath.Glob(filepath.Join(f.options.Directory, "*"+extension))
+	for _, name := range files {
+		if i, err := f.read(name); err == nil {
+			rv[name] = i
+		}
+	}
+	return rv
+}
+
+// deleteBy removes all items where the given function returns true.
+// Only the metadata of the items is decoded, like this items with a value which can not be decoded are removed as well.
+// Files which can not be decoded at all are removed.
+// The caller must hold the write lock.
+func (f *file) deleteBy(fn func(*item) bool) error {
+	files, _ := filepath.Glob(filepath.Join(f.options.Directory, "*"+extension))
+	for _, name := range files {
+		i, err := f.meta(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err == nil && !fn(i) {
+			continue
+		}
+		if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// meta decodes the item of the given file without the value.
+func (f *file) meta(name string) (*item, error) {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	i := &item{}
+	err = gob.NewDecoder(bytes.NewReader(b)).Decode(i)
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// read decodes the item and the value of the given file.
+func (f *file) read(name string) (*item, error) {
+	i, err := f.meta(name)
+	if err != nil {
+		return nil, err
+	}
+	i.val, err = f.options.Codec.Decode(i.Data)
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+// write encodes the item into a temporary file, which is synced and renamed to the item file.
+// The caller must hold the write lock.
+func (f *file) write(i *item) (err error) {
+	i.Data, err = f.options.Codec.Encode(i.val)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	err = gob.NewEncoder(&buf).Encode(i)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(f.options.Directory, 0755)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(f.options.Directory, "*"+tmpExtension)
+	if err != nil {
+		return err
+	}
+	// remove the temporary file on error.
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	_, err = tmp.Write(buf.Bytes())
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmp.Name(), f.path(i.Key))
+	if err != nil {
+		return err
+	}
+	return syncDir(f.options.Directory)
+}
+
+// syncDir syncs the directory, like this a rename is persisted.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if cErr := d.Close(); err == nil {
+		err = cErr
+	}
+	return err
+}
+
+// defaultDirectory returns the cache directory of the application.
+// The name of the executable and the hash of its path are used, like this different applications are not sharing the directory.
+func defaultDirectory() string {
+	name := filepath.Base(os.Args[0])
+	if exe, err := os.Executable(); err == nil {
+		h := sha1.Sum([]byte(exe))
+		name = filepath.Base(exe) + "-" + hex.EncodeToString(h[:4])
+	}
+	return filepath.Join(os.TempDir(), "gofw-cache", name)
+}
@@ -0,0 +1,271 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package file_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cm "github.com/patrickascher/gofw/cache"
+	"github.com/patrickascher/gofw/cache/file"
+	"github.com/stretchr/testify/assert"
+)
+
+// newFile returns a file cache in a temporary directory.
+func newFile(t *testing.T, gc time.Duration) (string, cm.Interface) {
+	dir, err := ioutil.TempDir("", "gofw-cache-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir, file.New(file.Options{Directory: dir, GCInterval: gc})
+}
+
+func TestFile_New(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gofw-cache-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c, err := cm.New(cm.FILE, file.Options{Directory: filepath.Join(dir, "sub")})
+	assert.NoError(t, err)
+	assert.NoError(t, c.Set("foo", "bar", cm.INFINITY))
+	assert.True(t, c.Exist("foo"))
+}
+
+func TestFile_DefaultDirectory(t *testing.T) {
+	// a file of another application in the shared directory.
+	shared := filepath.Join(os.TempDir(), "gofw-cache")
+	assert.NoError(t, os.MkdirAll(shared, 0755))
+	other := filepath.Join(shared, "other.cache")
+	assert.NoError(t, ioutil.WriteFile(other, []byte("other"), 0644))
+	defer os.Remove(other)
+
+	c := file.New(nil)
+	assert.NoError(t, c.Set("foo", "bar", cm.INFINITY))
+	assert.True(t, c.Exist("foo"))
+	assert.NoError(t, c.DeleteAll())
+	assert.False(t, c.Exist("foo"))
+	_, err := os.Stat(other)
+	assert.NoError(t, err)
+}
+
+func TestFile_SetGet(t *testing.T) {
+	dir, c := newFile(t, time.Minute)
+
+	// ok
+	assert.NoError(t, c.Set("foo", "bar", cm.INFINITY))
+	assert.NoError(t, c.Set("foo", "BAR", cm.INFINITY))
+	assert.NoError(t, c.Set("int", 42, cm.INFINITY))
+	assert.NoError(t, c.Set("ttl", 42, 10*time.Millisecond))
+
+	v, err := c.Get("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "BAR", v.Value())
+	v, err = c.Get("int")
+	assert.NoError(t, err)
+	assert.Equal(t, 42, v.Value())
+
+	// ok: survives a restart
+	c = file.New(file.Options{Directory: dir})
+	v, err = c.Get("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "BAR", v.Value())
+
+	// error: expired
+	time.Sleep(20 * time.Millisecond)
+	assert.False(t, c.Exist("ttl"))
+	v, err = c.Get("ttl")
+	assert.Error(t, err)
+	assert.Nil(t, v)
+
+	// error: key does not exist
+	v, err = c.Get("baz")
+	assert.Error(t, err)
+	assert.Equal(t, fmt.Sprintf(file.ErrKeyNotExist.Error(), "baz"), err.Error())
+	assert.Nil(t, v)
+
+	// error: type is not registered
+	err = c.Set("struct", struct{ A int }{A: 1}, cm.INFINITY)
+	assert.Error(t, err)
+	files, _ := filepath.Glob(filepath.Join(dir, "*.tmp"))
+	assert.Equal(t, 0, len(files))
+
+	assert.Equal(t, cm.Stats{Hits: 1, Misses: 2, Items: 3, Size: c.Stats().Size}, c.Stats())
+}
+
+func TestFile_GetAllPrefixed(t *testing.T) {
+	_, c := newFile(t, time.Minute)
+	assert.NoError(t, c.Set("user:1", "John", cm.INFINITY))
+	assert.NoError(t, c.Set("user:2", "Jane", cm.INFINITY))
+	assert.NoError(t, c.Set("grid", "orders", cm.INFINITY))
+
+	v := c.GetAll()
+	assert.Equal(t, 3, len(v))
+	assert.Equal(t, "John", v["user:1"].Value())
+
+	v = c.GetPrefixed("user:")
+	assert.Equal(t, 2, len(v))
+	assert.Equal(t, "Jane", v["user:2"].Value())
+}
+
+func TestFile_Delete(t *testing.T) {
+	_, c := newFile(t, time.Minute)
+	assert.NoError(t, c.Set("user:1", "John", cm.INFINITY, "user"))
+	assert.NoError(t, c.Set("user:2", "Jane", cm.INFINITY))
+	assert.NoError(t, c.Set("grid", "orders", cm.INFINITY, "grid", "user"))
+	assert.NoError(t, c.Set("foo", "bar", cm.INFINITY))
+
+	// ok
+	assert.NoError(t, c.DeleteTagged("user"))
+	assert.Equal(t, 2, len(c.GetAll()))
+	assert.True(t, c.Exist("user:2"))
+
+	// error: key does not exist
+	err := c.Delete("grid")
+	assert.Error(t, err)
+	assert.Equal(t, fmt.Sprintf(file.ErrKeyNotExist.Error(), "grid"), err.Error())
+
+	assert.NoError(t, c.DeletePrefixed("user:"))
+	assert.Equal(t, 1, len(c.GetAll()))
+	assert.NoError(t, c.Delete("foo"))
+	assert.Equal(t, 0, len(c.GetAll()))
+
+	assert.NoError(t, c.Set("foo", "bar", cm.INFINITY))
+	assert.NoError(t, c.DeleteAll())
+	assert.Equal(t, 0, len(c.GetAll()))
+}
+
+func TestFile_Atomic(t *testing.T) {
+	_, c := newFile(t, time.Minute)
+
+	v, err := c.Increment("counter", 2, cm.INFINITY)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), v)
+	v, err = c.Decrement("counter", 1, cm.INFINITY)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), v)
+
+	// error: no integer
+	assert.NoError(t, c.Set("foo", "bar", cm.INFINITY))
+	_, err = c.Increment("foo", 1, cm.INFINITY)
+	assert.Error(t, err)
+
+	ok, err := c.SetIfNotExists("lock", "owner1", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = c.SetIfNotExists("lock", "owner2", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = c.CompareAndSwap("lock", "owner2", "owner3", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = c.CompareAndSwap("lock", "owner1", "owner3", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	val, err := c.Get("lock")
+	assert.NoError(t, err)
+	assert.Equal(t, "owner3", val.Value())
+
+	// ok: the tags are kept
+	assert.NoError(t, c.Set("tagged", "a", cm.INFINITY, "locks"))
+	ok, err = c.CompareAndSwap("tagged", "a", "b", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.NoError(t, c.DeleteTagged("locks"))
+	assert.False(t, c.Exist("tagged"))
+}
+
+func TestFile_GC(t *testing.T) {
+	dir, c := newFile(t, 20*time.Millisecond)
+	go c.GC()
+
+	assert.NoError(t, c.Set("foo", "bar", cm.INFINITY))
+	assert.NoError(t, c.Set("gc", "val", 10*time.Millisecond))
+	// left temporary file of a crashed write
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "crashed.tmp"), []byte("x"), 0644))
+
+	time.Sleep(100 * time.Millisecond)
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	assert.Equal(t, 1, len(files))
+	assert.Equal(t, uint64(1), c.Stats().Expirations)
+}
+
+func TestFile_Unreadable(t *testing.T) {
+	dir, c := newFile(t, 10*time.Millisecond)
+	corrupt := filepath.Join(dir, "corrupt.cache")
+
+	// value which can not be decoded by the codec
+	assert.NoError(t, file.New(file.Options{Directory: dir, Codec: cm.Binary}).Set("foo", "bar", 10*time.Millisecond, "tag"))
+	_, err := c.Get("foo")
+	assert.Error(t, err)
+
+	// ok: DeleteTagged and DeletePrefixed see the item
+	assert.NoError(t, c.DeleteTagged("tag"))
+	files, _ := filepath.Glob(filepath.Join(dir, "*.cache"))
+	assert.Equal(t, 0, len(files))
+	assert.NoError(t, file.New(file.Options{Directory: dir, Codec: cm.Binary}).Set("foo", "bar", cm.INFINITY))
+	assert.NoError(t, c.DeletePrefixed("f"))
+	files, _ = filepath.Glob(filepath.Join(dir, "*.cache"))
+	assert.Equal(t, 0, len(files))
+
+	// ok: the GC removes expired items and corrupt files
+	assert.NoError(t, file.New(file.Options{Directory: dir, Codec: cm.Binary}).Set("foo", "bar", 10*time.Millisecond))
+	assert.NoError(t, ioutil.WriteFile(corrupt, []byte("corrupt"), 0644))
+	go c.GC()
+	defer c.Close()
+	time.Sleep(50 * time.Millisecond)
+	files, _ = filepath.Glob(filepath.Join(dir, "*.cache"))
+	assert.Equal(t, 0, len(files))
+
+	// ok: DeleteAll removes corrupt files
+	assert.NoError(t, ioutil.WriteFile(corrupt, []byte("corrupt"), 0644))
+	assert.NoError(t, c.DeleteAll())
+	_, err = os.Stat(corrupt)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFile_Close(t *testing.T) {
+	dir, c := newFile(t, time.Millisecond)
+	assert.NoError(t, c.Set("foo", "bar", cm.INFINITY))
+
+	done := make(chan struct{})
+	go func() {
+		c.GC()
+		close(done)
+	}()
+
+	// ok: gc stops and the items are kept
+	assert.NoError(t, c.Close())
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("gc was not stopped")
+	}
+	assert.NoError(t, c.Close())
+	assert.True(t, file.New(file.Options{Directory: dir}).Exist("foo"))
+}
+
+func TestFile_Codec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gofw-cache-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, codec := range []cm.Codec{cm.JSON, cm.Binary} {
+		c := file.New(file.Options{Directory: dir, Codec: codec})
+		assert.NoError(t, c.Set("foo", time.Duration(5), cm.INFINITY, "tag"))
+		v, err := c.Get("foo")
+		assert.NoError(t, err)
+		assert.Equal(t, time.Duration(5), v.Value())
+		assert.NoError(t, c.DeleteTagged("tag"))
+
+		// error: type is not registered
+		assert.Error(t, c.Set("struct", struct{ A int }{A: 1}, cm.INFINITY))
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/patrickascher/gofw/cache"
+	"github.com/patrickascher/gofw/cache/memory"
 )
 
 var memCache cache.Interface
@@ -51,3 +52,51 @@ func BenchmarkMemory_DeleteAll(b *testing.B) {
 		_ = memCache.DeleteAll()
 	}
 }
+
+// benchmarkParallel runs a mixed read/write load on the cache.
+// Every tenth operation is a Set.
+func benchmarkParallel(b *testing.B, c cache.Interface) {
+	for i := 0; i < 1000; i++ {
+		_ = c.Set("key:"+strconv.Itoa(i), i, cache.INFINITY)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := "key:" + strconv.Itoa(i%1000)
+			if i%10 == 0 {
+				_ = c.Set(key, i, cache.INFINITY)
+			} else {
+				_, _ = c.Get(key)
+			}
+			i++
+		}
+	})
+}
+
+// BenchmarkMemory_Parallel compares a single shard, which is equal to a global lock, with the default shards.
+func BenchmarkMemory_Parallel(b *testing.B) {
+	b.Run("Shards:1", func(b *testing.B) {
+		benchmarkParallel(b, memory.New(memory.Options{Shards: 1}))
+	})
+	b.Run("Shards:default", func(b *testing.B) {
+		benchmarkParallel(b, memory.New(nil))
+	})
+	b.Run("Shards:1/LRU", func(b *testing.B) {
+		benchmarkParallel(b, memory.New(memory.Options{Shards: 1, MaxItems: 2000}))
+	})
+	b.Run("Shards:default/LRU", func(b *testing.B) {
+		benchmarkParallel(b, memory.New(memory.Options{MaxItems: 2000}))
+	})
+}
+
+func BenchmarkMemory_GetAll(b *testing.B) {
+	c := memory.New(nil)
+	for i := 0; i < 1000; i++ {
+		_ = c.Set("key:"+strconv.Itoa(i), i, cache.INFINITY)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = c.GetAll()
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"container/heap"
+	"container/list"
+	"reflect"
+	"sync"
+)
+
+// Eviction policies which can be set in the Options.
+const (
+	// LRU evicts the least recently used item.
+	LRU = "lru"
+	// LFU evicts the least frequently used item.
+	// If two items have the same frequency, the least recently used one is evicted.
+	LFU = "lfu"
+	// FIFO evicts the oldest item.
+	FIFO = "fifo"
+)
+
+// itemOverhead is the approximated size of an item without key and value.
+const itemOverhead = 64
+
+// policy tracks the usage of the cache keys and decides which item gets evicted.
+// The policy has its own mutex, because access is called on reading operations which only hold a read lock of the cache.
+type policy interface {
+	// add a new key.
+	add(key string)
+	// access marks a key as used.
+	access(key string)
+	// remove a key.
+	remove(key string)
+	// victim returns the key which should get evicted next.
+	victim() (string, bool)
+	// reset removes all keys.
+	reset()
+}
+
+// newPolicy returns the policy by name.
+// If the name is unknown, LRU is used.
+func newPolicy(name string) policy {
+	switch name {
+	case LFU:
+		p := &lfu{}
+		p.reset()
+		return p
+	case FIFO:
+		p := &lru{fifo: true}
+		p.reset()
+		return p
+	default:
+		p := &lru{}
+		p.reset()
+		return p
+	}
+}
+
+// lru implements the LRU and FIFO policy.
+// The front of the list is the newest element.
+type lru struct {
+	mutex    sync.Mutex
+	fifo     bool
+	list     *list.List
+	elements map[string]*list.Element
+}
+
+func (p *lru) add(key string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.elements[key] = p.list.PushFront(key)
+}
+
+func (p *lru) access(key string) {
+	if p.fifo {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if e, ok := p.elements[key]; ok {
+		p.list.MoveToFront(e)
+	}
+}
+
+func (p *lru) remove(key string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if e, ok := p.elements[key]; ok {
+		p.list.Remove(e)
+		delete(p.elements, key)
+	}
+}
+
+func (p *lru) victim() (string, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if e := p.list.Back(); e != nil {
+		return e.Value.(string), true
+	}
+	return "", false
+}
+
+func (p *lru) reset() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.list = list.New()
+	p.elements = make(map[string]*list.Element)
+}
+
+// lfu implements the LFU policy with a min-heap.
+type lfu struct {
+	mutex   sync.Mutex
+	counter uint64
+	heap    lfuHeap
+	entries map[string]*lfuEntry
+}
+
+// lfuEntry is a heap element.
+type lfuEntry struct {
+	key   string
+	freq  uint64
+	used  uint64 // counter value of the last access, used for ties.
+	index int
+}
+
+func (p *lfu) add(key string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.counter++
+	e := &lfuEntry{key: key, freq: 1, used: p.counter}
+	p.entries[key] = e
+	heap.Push(&p.heap, e)
+}
+
+func (p *lfu) access(key string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if e, ok := p.entries[key]; ok {
+		p.counter++
+		e.freq++
+		e.used = p.counter
+		heap.Fix(&p.heap, e.index)
+	}
+}
+
+func (p *lfu) remove(key string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if e, ok := p.entries[key]; ok {
+		heap.Remove(&p.heap, e.index)
+		delete(p.entries, key)
+	}
+}
+
+func (p *lfu) victim() (string, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if len(p.heap) == 0 {
+		return "", false
+	}
+	return p.heap[0].key, true
+}
+
+func (p *lfu) reset() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.heap = nil
+	p.entries = make(map[string]*lfuEntry)
+}
+
+// lfuHeap implements the heap.Interface.
+type lfuHeap []*lfuEntry
+
+func (h lfuHeap) Len() int { return len(h) }
+
+func (h lfuHeap) Less(i, j int) bool {
+	if h[i].freq == h[j].freq {
+		return h[i].used < h[j].used
+	}
+	return h[i].freq < h[j].freq
+}
+
+func (h lfuHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *lfuHeap) Push(x interface{}) {
+	e := x.(*lfuEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *lfuHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
+
+// sizeOf returns the approximated size of the value in bytes.
+// Pointers are only counted once, to avoid endless loops on circular references.
+func sizeOf(v interface{}) int64 {
+	if v == nil {
+		return 0
+	}
+	return valueSize(reflect.ValueOf(v), make(map[uintptr]bool))
+}
+
+// valueSize returns the approximated size of the reflect.Value in bytes.
+func valueSize(v reflect.Value, seen map[uintptr]bool) int64 {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || seen[v.Pointer()] {
+			return int64(v.Type().Size())
+		}
+		seen[v.Pointer()] = true
+		return int64(v.Type().Size()) + valueSize(v.Elem(), seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			return int64(v.Type().Size())
+		}
+		return int64(v.Type().Size()) + valueSize(v.Elem(), seen)
+	case reflect.String:
+		return int64(v.Type().Size()) + int64(v.Len())
+	case reflect.Slice:
+		size := int64(v.Type().Size())
+		if v.IsNil() || seen[v.Pointer()] {
+			return size
+		}
+		seen[v.Pointer()] = true
+		for i := 0; i < v.Len(); i++ {
+			size += valueSize(v.Index(i), seen)
+		}
+		return size
+	case reflect.Array:
+		size := int64(0)
+		for i := 0; i < v.Len(); i++ {
+			size += valueSize(v.Index(i), seen)
+		}
+		return size
+	case reflect.Map:
+		size := int64(v.Type().Size())
+		if v.IsNil() || seen[v.Pointer()] {
+			return size
+		}
+		seen[v.Pointer()] = true
+		iter := v.MapRange()
+		for iter.Next() {
+			size += valueSize(iter.Key(), seen) + valueSize(iter.Value(), seen)
+		}
+		return size
+	case reflect.Struct:
+		size := int64(0)
+		for i := 0; i < v.NumField(); i++ {
+			size += valueSize(v.Field(i), seen)
+		}
+		// padding
+		if int64(v.Type().Size()) > size {
+			return int64(v.Type().Size())
+		}
+		return size
+	default:
+		return int64(v.Type().Size())
+	}
+}
@@ -3,15 +3,28 @@
 // license that can be found in the LICENSE file.
 
 // Package memory implements the cache.Interface and registers an in-memory provider.
-// All operations are using a sync.RWMutex for synchronization.
+// The items are split into shards by the hash of the key. Each shard has its own sync.RWMutex,
+// like this concurrent operations on different keys are not blocking each other.
+//
+// The cache can be bounded by a maximum number of items and/or an approximated byte size.
+// If a limit is reached, items are evicted by the configured policy (LRU, LFU, FIFO).
+// The limits are global for the whole cache. Each shard has its own policy, the victims are taken from the shard of the new item first
+// and then from the other shards. Like this the eviction order is exact with one shard and approximated with more shards.
+// Concurrent writes can exceed the limits for a short time, until their eviction is done.
+//
+// Hits, misses, evictions and expirations are counted for the whole cache and the configured StatsPrefixes.
+// The OnEvict and OnExpire callbacks are called after the lock is released, so they can use the cache.
+//
 // Benchmark file is available.
 package memory
 
 import (
 	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	cm "github.com/patrickascher/gofw/cache"
@@ -25,21 +38,55 @@ func init() {
 // defaultGCInterval holds the garbage collector waiting time in seconds.
 var defaultGCInterval = 60
 
+// defaultShards holds the number of shards.
+var defaultShards = 16
+
+// minimum share of the limits per shard. If the limits are smaller, the number of shards is reduced.
+const (
+	minShardItems = 16
+	minShardBytes = 16 << 10
+)
+
 // Error messages
 var (
 	ErrKeyNotExist = errors.New("cache/memory: key %v does not exist")
+	ErrItemSize    = errors.New("cache/memory: item %v exceeds the maximum size of %d bytes")
 )
 
 // memory cache provider
 type memory struct {
-	mutex   sync.RWMutex
+	// items and size of the bounded cache, the fields are first for the 64-bit alignment of the atomic operations.
+	items   int64
+	size    int64
 	options Options
-	items   map[string]cm.Valuer
+	shards  []*shard
+	stats   counters
+	closing chan struct{}
+	closed  sync.Once
+	// prefixes counters are only created in New, after that the map is read only.
+	prefixes map[string]*counters
 }
 
 // Options for the in-memory provider
 type Options struct {
 	GCInterval time.Duration
+	// Shards is the number of shards. Default is 16.
+	// If the limits are small, the number of shards is reduced, so that every shard has at least 16 items or 16KB.
+	Shards int
+	// MaxItems is the maximum number of items of the cache. 0 means unlimited.
+	MaxItems int
+	// MaxBytes is the approximated maximum size of all keys and values of the cache. 0 means unlimited.
+	// The size is calculated by reflection on Set, which adds some costs.
+	MaxBytes int64
+	// Eviction policy which is used if MaxItems or MaxBytes is reached.
+	// LRU, LFU and FIFO are available. Default is LRU.
+	Eviction string
+	// StatsPrefixes defines key prefixes which are getting an own breakdown in the Stats.
+	StatsPrefixes []string
+	// OnEvict is called after an item was evicted by the eviction policy.
+	OnEvict func(key string, value interface{})
+	// OnExpire is called after an expired item was removed by the garbage collector.
+	OnExpire func(key string, value interface{})
 }
 
 // item implements the Valuer interface
@@ -47,6 +94,8 @@ type item struct {
 	val     interface{}   //value
 	ttl     time.Duration //lifetime
 	created time.Time     //time when the value was set
+	size    int64         //approximated size, only calculated if MaxBytes is set
+	tags    []string      //tags of the item
 }
 
 // Value returns the value of the item.
@@ -64,130 +113,383 @@ func (m *item) expired() bool {
 
 // New creates a in-memory cache by the given options.
 func New(opt interface{}) cm.Interface {
-	options := Options{GCInterval: time.Duration(defaultGCInterval) * time.Second}
+	options := Options{}
 	if opt != nil {
-		//TODO use a merger like https://github.com/imdario/mergo?
-		if opt.(Options).GCInterval > 0 {
-			options = opt.(Options)
-		}
+		options = opt.(Options)
+	}
+	if options.GCInterval <= 0 {
+		options.GCInterval = time.Duration(defaultGCInterval) * time.Second
+	}
+	if options.Shards <= 0 {
+		options.Shards = defaultShards
 	}
-	return &memory{options: options, items: make(map[string]cm.Valuer)}
+	options.Shards = reduce(options.Shards, int64(options.MaxItems), minShardItems)
+	options.Shards = reduce(options.Shards, options.MaxBytes, minShardBytes)
+
+	m := &memory{options: options, shards: make([]*shard, options.Shards), prefixes: make(map[string]*counters), closing: make(chan struct{})}
+	for i := range m.shards {
+		m.shards[i] = newShard(m, i)
+	}
+	for _, prefix := range options.StatsPrefixes {
+		m.prefixes[prefix] = &counters{}
+	}
+	return m
 }
 
 // Get returns the value of the given key.
 // Error will return if the key does not exist.
 func (m *memory) Get(key string) (cm.Valuer, error) {
-	m.mutex.RLock()
-	defer m.mutex.RUnlock()
+	s := m.shard(key)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 
-	if val, ok := m.items[key]; ok {
+	if val, ok := s.items[key]; ok {
+		if s.policy != nil {
+			s.policy.access(key)
+		}
+		m.count(key, hit)
 		return val, nil
 	}
+	m.count(key, miss)
 	return nil, fmt.Errorf(ErrKeyNotExist.Error(), key)
 }
 
-// GetPrefixed returns all items of the cache as map.
+// GetPrefixed returns all items with the given prefix as map.
+// The map is a copy, the shards are locked one after another.
 func (m *memory) GetPrefixed(prefix string) map[string]cm.Valuer {
-	m.mutex.RLock()
-	defer m.mutex.RUnlock()
-
-	rv := make(map[string]cm.Valuer, 0)
-	for k, item := range m.items {
-		if strings.HasPrefix(k, prefix) {
-			rv[k] = item
-		}
+	rv := make(map[string]cm.Valuer)
+	for _, s := range m.shards {
+		s.mutex.RLock()
+		s.prefixed(prefix, rv)
+		s.mutex.RUnlock()
 	}
-
 	return rv
 }
 
 // GetAll returns all items of the cache as map.
+// The map is a copy, the shards are locked one after another.
 func (m *memory) GetAll() map[string]cm.Valuer {
-	m.mutex.RLock()
-	defer m.mutex.RUnlock()
-
-	return m.items
+	return m.GetPrefixed("")
 }
 
 // Set key/value pair.
 // The ttl can be set by duration or forever with cache.INFINITY.
-func (m *memory) Set(key string, value interface{}, ttl time.Duration) error {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
+// Tags can be added to invalidate the item with DeleteTagged.
+// If the cache is bounded, items are evicted until the new item fits.
+// Error will return if the item itself exceeds the MaxBytes.
+func (m *memory) Set(key string, value interface{}, ttl time.Duration, tags ...string) error {
+	s := m.shard(key)
+	i, err := m.newItem(key, value, ttl, tags)
+	if err != nil {
+		return err
+	}
 
-	m.items[key] = &item{val: value, created: time.Now(), ttl: ttl}
+	s.mutex.Lock()
+	evicted := s.set(key, i)
+	s.mutex.Unlock()
 
+	m.onEvict(m.evict(s, evicted))
 	return nil
 }
 
 // Exist returns true if the key exists.
 func (m *memory) Exist(key string) bool {
-	m.mutex.RLock()
-	defer m.mutex.RUnlock()
+	s := m.shard(key)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
 
-	_, ok := m.items[key]
+	_, ok := s.items[key]
 	return ok
 }
 
 // Delete removes a given key from the cache.
 // Error will return if the key does not exist.
 func (m *memory) Delete(key string) error {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
+	s := m.shard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
 
-	if _, ok := m.items[key]; !ok {
+	if _, ok := s.items[key]; !ok {
 		return fmt.Errorf(ErrKeyNotExist.Error(), key)
 	}
 
-	delete(m.items, key)
+	s.delete(key)
 
 	return nil
 }
 
 // DeleteAll removes all items from the cache.
 func (m *memory) DeleteAll() error {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-
-	m.items = make(map[string]cm.Valuer)
-
+	for _, s := range m.shards {
+		s.mutex.Lock()
+		s.reset()
+		s.mutex.Unlock()
+	}
 	return nil
 }
 
+// DeletePrefixed removes all items with the given prefix.
 func (m *memory) DeletePrefixed(prefix string) error {
-	items := m.GetPrefixed(prefix)
-	for k := range items {
-		err := m.Delete(k)
+	for _, s := range m.shards {
+		s.mutex.Lock()
+		for key := range s.items {
+			if strings.HasPrefix(key, prefix) {
+				s.delete(key)
+			}
+		}
+		s.mutex.Unlock()
+	}
+	return nil
+}
+
+// Increment the integer value of the key by delta and returns the new value.
+// If the key does not exist or is expired, it will be created with the given ttl.
+// The ttl and tags of an existing key are not changed. An existing key is updated in place, like this
+// its usage of the eviction policy is kept and the update counts as access.
+// Error will return if the value is not an integer.
+func (m *memory) Increment(key string, delta int64, ttl time.Duration) (int64, error) {
+	s := m.shard(key)
+	s.mutex.Lock()
+
+	old, ok := s.valid(key)
+	var v int64
+	if ok {
+		var err error
+		v, err = cm.Int64(key, old.val)
 		if err != nil {
-			return err
+			s.mutex.Unlock()
+			return 0, err
+		}
+	}
+	v += delta
+
+	if ok {
+		// the item is copied, because it could be read by a caller of Get without lock.
+		i := *old
+		i.val = v
+		if m.options.MaxBytes > 0 {
+			i.size = int64(len(key)) + sizeOf(v) + itemOverhead
+		}
+		s.replace(key, &i)
+		s.mutex.Unlock()
+		m.onEvict(m.evict(s, nil))
+		return v, nil
+	}
+
+	i, err := m.newItem(key, v, ttl, nil)
+	if err != nil {
+		s.mutex.Unlock()
+		return 0, err
+	}
+	evicted := s.set(key, i)
+	s.mutex.Unlock()
+
+	m.onEvict(m.evict(s, evicted))
+	return v, nil
+}
+
+// Decrement the integer value of the key by delta and returns the new value.
+// See Increment for more details.
+func (m *memory) Decrement(key string, delta int64, ttl time.Duration) (int64, error) {
+	return m.Increment(key, -delta, ttl)
+}
+
+// SetIfNotExists sets the value only if the key does not exist or is expired.
+// True will return if the value was set.
+func (m *memory) SetIfNotExists(key string, value interface{}, ttl time.Duration) (bool, error) {
+	s := m.shard(key)
+	i, err := m.newItem(key, value, ttl, nil)
+	if err != nil {
+		return false, err
+	}
+
+	s.mutex.Lock()
+	if _, ok := s.valid(key); ok {
+		s.mutex.Unlock()
+		return false, nil
+	}
+	evicted := s.set(key, i)
+	s.mutex.Unlock()
+
+	m.onEvict(m.evict(s, evicted))
+	return true, nil
+}
+
+// CompareAndSwap sets the new value only if the key exists, is not expired and its value is equal to old.
+// The values are compared with reflect.DeepEqual, the tags of the key are kept.
+// True will return if the value was swapped.
+func (m *memory) CompareAndSwap(key string, old interface{}, new interface{}, ttl time.Duration) (bool, error) {
+	s := m.shard(key)
+	i, err := m.newItem(key, new, ttl, nil)
+	if err != nil {
+		return false, err
+	}
+
+	s.mutex.Lock()
+	cur, ok := s.valid(key)
+	if !ok || !reflect.DeepEqual(cur.val, old) {
+		s.mutex.Unlock()
+		return false, nil
+	}
+	i.tags = cur.tags
+	evicted := s.set(key, i)
+	s.mutex.Unlock()
+
+	m.onEvict(m.evict(s, evicted))
+	return true, nil
+}
+
+// DeleteTagged removes all items which have at least one of the given tags.
+func (m *memory) DeleteTagged(tags ...string) error {
+	for _, s := range m.shards {
+		s.mutex.Lock()
+		for _, tag := range tags {
+			for key := range s.tags[tag] {
+				s.delete(key)
+			}
 		}
+		s.mutex.Unlock()
 	}
 	return nil
 }
 
+// Stats returns the counters, number of items and the approximated size of the cache.
+// The size is only calculated if MaxBytes is set.
+// The configured StatsPrefixes are added as breakdown.
+func (m *memory) Stats() cm.Stats {
+	rv := m.stats.toStats()
+	if len(m.prefixes) > 0 {
+		rv.Prefixes = make(map[string]cm.Stats, len(m.prefixes))
+		for prefix, c := range m.prefixes {
+			rv.Prefixes[prefix] = c.toStats()
+		}
+	}
+
+	for _, s := range m.shards {
+		s.mutex.RLock()
+		rv.Items += len(s.items)
+		rv.Size += s.size
+		for prefix, ps := range rv.Prefixes {
+			for k, i := range s.items {
+				if strings.HasPrefix(k, prefix) {
+					ps.Items++
+					ps.Size += i.size
+				}
+			}
+			rv.Prefixes[prefix] = ps
+		}
+		s.mutex.RUnlock()
+	}
+
+	return rv
+}
+
 // GC is an infinity loop. The loop will rerun after an specific interval time which can be set
 // in the options (default 60sec).
+// Each shard is locked once to remove all its expired items.
+// The OnExpire callback is called after the lock is released.
+// The loop ends if the cache gets closed.
 func (m *memory) GC() {
+	ticker := time.NewTicker(m.options.GCInterval)
+	defer ticker.Stop()
 	for {
-		<-time.After(m.options.GCInterval)
-		if keys := m.expiredKeys(); len(keys) != 0 {
-			for _, key := range keys {
-				_ = m.Delete(key)
+		select {
+		case <-m.closing:
+			return
+		case <-ticker.C:
+		}
+		for _, s := range m.shards {
+			expired := s.expire(m)
+			if m.options.OnExpire != nil {
+				for k, v := range expired {
+					m.options.OnExpire(k, v)
+				}
 			}
 		}
 	}
 }
 
-// expiredKeys returns all expired keys.
-func (m *memory) expiredKeys() (keys []string) {
-	m.mutex.RLock()
-	defer m.mutex.RUnlock()
+// Close stops the garbage collector and removes all items.
+func (m *memory) Close() error {
+	m.closed.Do(func() {
+		close(m.closing)
+		_ = m.DeleteAll()
+	})
+	return nil
+}
 
-	for key, itm := range m.items {
-		x := itm.(*item)
-		if x.expired() {
-			keys = append(keys, key)
+// shard returns the shard of the key.
+func (m *memory) shard(key string) *shard {
+	if len(m.shards) == 1 {
+		return m.shards[0]
+	}
+	return m.shards[fnv32(key)%uint32(len(m.shards))]
+}
+
+// newItem creates an item. If MaxBytes is set, the size is calculated.
+// Error will return if the item exceeds the MaxBytes.
+func (m *memory) newItem(key string, value interface{}, ttl time.Duration, tags []string) (*item, error) {
+	i := &item{val: value, created: time.Now(), ttl: ttl, tags: tags}
+	if m.options.MaxBytes > 0 {
+		i.size = int64(len(key)) + sizeOf(value) + itemOverhead
+		if i.size > m.options.MaxBytes {
+			return nil, fmt.Errorf(ErrItemSize.Error(), key, m.options.MaxBytes)
+		}
+	}
+	return i, nil
+}
+
+// bounded returns true if MaxItems or MaxBytes is set.
+func (m *memory) bounded() bool {
+	return m.options.MaxItems > 0 || m.options.MaxBytes > 0
+}
+
+// full returns true if an item with the given size does not fit into the cache.
+func (m *memory) full(size int64) bool {
+	return (m.options.MaxItems > 0 && atomic.LoadInt64(&m.items)+1 > int64(m.options.MaxItems)) ||
+		(m.options.MaxBytes > 0 && atomic.LoadInt64(&m.size)+size > m.options.MaxBytes)
+}
+
+// over returns true if the cache exceeds a limit.
+func (m *memory) over() bool {
+	return (m.options.MaxItems > 0 && atomic.LoadInt64(&m.items) > int64(m.options.MaxItems)) ||
+		(m.options.MaxBytes > 0 && atomic.LoadInt64(&m.size) > m.options.MaxBytes)
+}
+
+// evict removes items of the other shards, until the cache is within its limits again.
+// The shards are locked one after another, starting with the next shard of s.
+// It must be called after the lock of s is released. The evicted items are added to the given map.
+func (m *memory) evict(s *shard, evicted map[string]interface{}) map[string]interface{} {
+	if !m.bounded() {
+		return evicted
+	}
+	for n := 1; n < len(m.shards) && m.over(); n++ {
+		o := m.shards[(s.index+n)%len(m.shards)]
+		o.mutex.Lock()
+		evicted = o.evict(0, true, evicted)
+		o.mutex.Unlock()
+	}
+	return evicted
+}
+
+// onEvict calls the OnEvict callback for the evicted items.
+// It must be called after the lock is released.
+func (m *memory) onEvict(evicted map[string]interface{}) {
+	if m.options.OnEvict != nil {
+		for k, v := range evicted {
+			m.options.OnEvict(k, v)
 		}
 	}
-	return keys
+}
+
+// reduce returns the number of shards, so that every shard has at least the given minimum of the limit.
+// At least one shard will return. If the limit is 0, the shards are not changed.
+func reduce(shards int, limit int64, min int64) int {
+	if limit <= 0 || int64(shards)*min <= limit {
+		return shards
+	}
+	if n := int(limit / min); n > 1 {
+		return n
+	}
+	return 1
 }
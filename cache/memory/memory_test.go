@@ -6,6 +6,8 @@ package memory_test
 
 import (
 	"fmt"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -54,6 +56,11 @@ func TestMemory_GetAll(t *testing.T) {
 	assert.Equal(t, 2, len(v))
 	assert.Equal(t, "BAR", v["foo"].Value())
 	assert.Equal(t, "Doe", v["John"].Value())
+
+	// ok: the map is a copy
+	delete(v, "foo")
+	assert.True(t, mem.Exist("foo"))
+	assert.Equal(t, 2, len(mem.GetAll()))
 }
 
 func TestMemory_Exist(t *testing.T) {
@@ -95,3 +102,422 @@ func TestMemory_DeleteAll(t *testing.T) {
 	err = mem.DeleteAll()
 	assert.NoError(t, err)
 }
+
+func TestMemory_MaxItems(t *testing.T) {
+	var tests = []struct {
+		eviction string
+		evicted  string
+	}{
+		{eviction: memory.LRU, evicted: "c"},
+		{eviction: memory.LFU, evicted: "b"},
+		{eviction: memory.FIFO, evicted: "a"},
+		{eviction: "", evicted: "c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.eviction, func(t *testing.T) {
+			c := memory.New(memory.Options{Shards: 1, MaxItems: 3, Eviction: tt.eviction})
+			assert.NoError(t, c.Set("a", 1, cm.INFINITY))
+			assert.NoError(t, c.Set("b", 2, cm.INFINITY))
+			assert.NoError(t, c.Set("c", 3, cm.INFINITY))
+
+			// c is used most but not recently, b and a once.
+			_, _ = c.Get("c")
+			_, _ = c.Get("c")
+			_, _ = c.Get("b")
+			_, _ = c.Get("a")
+
+			assert.NoError(t, c.Set("d", 4, cm.INFINITY))
+			assert.Equal(t, 3, len(c.GetAll()))
+			assert.False(t, c.Exist(tt.evicted))
+			assert.True(t, c.Exist("d"))
+
+			// ok: redefine does not evict
+			assert.NoError(t, c.Set("d", 5, cm.INFINITY))
+			assert.Equal(t, 3, len(c.GetAll()))
+
+			// ok: deleted items are not evicted anymore
+			assert.NoError(t, c.DeleteAll())
+			assert.NoError(t, c.Set("e", 1, cm.INFINITY))
+			assert.True(t, c.Exist("e"))
+		})
+	}
+}
+
+func TestMemory_MaxBytes(t *testing.T) {
+	c := memory.New(memory.Options{Shards: 1, MaxBytes: 1024})
+
+	// ok
+	assert.NoError(t, c.Set("a", make([]byte, 400), cm.INFINITY))
+	assert.NoError(t, c.Set("b", make([]byte, 400), cm.INFINITY))
+	assert.Equal(t, 2, len(c.GetAll()))
+
+	// ok: a gets evicted
+	assert.NoError(t, c.Set("c", make([]byte, 400), cm.INFINITY))
+	assert.Equal(t, 2, len(c.GetAll()))
+	assert.False(t, c.Exist("a"))
+
+	// ok: freed size is reused
+	assert.NoError(t, c.Delete("b"))
+	assert.NoError(t, c.Set("d", make([]byte, 400), cm.INFINITY))
+	assert.True(t, c.Exist("c"))
+	assert.True(t, c.Exist("d"))
+
+	// error: item is bigger than the cache
+	err := c.Set("e", make([]byte, 2048), cm.INFINITY)
+	assert.Error(t, err)
+	assert.Equal(t, fmt.Sprintf(memory.ErrItemSize.Error(), "e", 1024), err.Error())
+	assert.Equal(t, 2, len(c.GetAll()))
+}
+
+func TestMemory_EvictionConcurrency(t *testing.T) {
+	c := memory.New(memory.Options{MaxItems: 50, Eviction: memory.LFU})
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 500; i++ {
+				key := strconv.Itoa((g * i) % 120)
+				_ = c.Set(key, i, cm.INFINITY)
+				_, _ = c.Get(key)
+				if i%10 == 0 {
+					_ = c.Delete(key)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	assert.True(t, len(c.GetAll()) <= 50)
+}
+
+func TestMemory_Shards(t *testing.T) {
+	// ok: the limit is global
+	c := memory.New(memory.Options{MaxItems: 100})
+	for i := 0; i < 1000; i++ {
+		assert.NoError(t, c.Set(strconv.Itoa(i), i, cm.INFINITY))
+	}
+	assert.Equal(t, 100, len(c.GetAll()))
+
+	// ok: small limits
+	c = memory.New(memory.Options{Shards: 8, MaxItems: 2})
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, c.Set(strconv.Itoa(i), i, cm.INFINITY))
+	}
+	assert.Equal(t, 2, len(c.GetAll()))
+	c = memory.New(memory.Options{MaxItems: 20})
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, c.Set(strconv.Itoa(i), i, cm.INFINITY))
+	}
+	assert.Equal(t, 20, len(c.GetAll()))
+	assert.Equal(t, uint64(0), c.Stats().Evictions)
+	assert.NoError(t, c.Set("20", 20, cm.INFINITY))
+	assert.Equal(t, 20, len(c.GetAll()))
+	assert.Equal(t, uint64(1), c.Stats().Evictions)
+
+	c = memory.New(memory.Options{MaxBytes: 800})
+	for i := 0; i < 100; i++ {
+		assert.NoError(t, c.Set(strconv.Itoa(i), i, cm.INFINITY))
+	}
+	assert.True(t, c.Stats().Size <= 800)
+	assert.True(t, c.Stats().Items > 0)
+
+	// ok: items can be bigger than the share of a shard
+	c = memory.New(memory.Options{Shards: 16, MaxBytes: 10 << 10})
+	assert.NoError(t, c.Set("big", make([]byte, 2<<10), cm.INFINITY))
+	assert.True(t, c.Exist("big"))
+	c = memory.New(memory.Options{Shards: 16, MaxBytes: 1 << 20})
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, c.Set(strconv.Itoa(i), make([]byte, 200<<10), cm.INFINITY))
+		assert.True(t, c.Exist(strconv.Itoa(i)))
+		assert.True(t, c.Stats().Size <= 1<<20)
+	}
+	assert.Equal(t, 5, c.Stats().Items)
+
+	// error: a limit smaller than an item is not unlimited
+	c = memory.New(memory.Options{MaxBytes: 8})
+	for i := 0; i < 100; i++ {
+		err := c.Set(strconv.Itoa(i), i, cm.INFINITY)
+		assert.Equal(t, fmt.Sprintf(memory.ErrItemSize.Error(), strconv.Itoa(i), 8), err.Error())
+	}
+	assert.Equal(t, 0, c.Stats().Items)
+	assert.Equal(t, int64(0), c.Stats().Size)
+
+	// ok: concurrent operations over all shards
+	c = memory.New(memory.Options{Shards: 4})
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				key := "key:" + strconv.Itoa((g*i)%50)
+				_ = c.Set(key, i, cm.INFINITY, "tag"+strconv.Itoa(i%5))
+				_, _ = c.Get(key)
+				_, _ = c.Increment("counter", 1, cm.INFINITY)
+				_ = c.GetPrefixed("key:1")
+				if i%20 == 0 {
+					_ = c.DeleteTagged("tag" + strconv.Itoa(g%5))
+					_ = c.DeletePrefixed("key:2")
+					_ = c.Stats()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	v, err := c.Get("counter")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1600), v.Value())
+}
+
+func TestMemory_DeleteTagged(t *testing.T) {
+	c := memory.New(nil)
+	assert.NoError(t, c.Set("user:42", "John", cm.INFINITY, "user:42"))
+	assert.NoError(t, c.Set("orders:42", "[]", cm.INFINITY, "user:42", "grid:orders"))
+	assert.NoError(t, c.Set("orders:all", "[]", cm.INFINITY, "grid:orders"))
+	assert.NoError(t, c.Set("foo", "bar", cm.INFINITY))
+
+	// ok
+	err := c.DeleteTagged("user:42")
+	assert.NoError(t, err)
+	assert.False(t, c.Exist("user:42"))
+	assert.False(t, c.Exist("orders:42"))
+	assert.True(t, c.Exist("orders:all"))
+
+	// ok: unknown tag
+	err = c.DeleteTagged("unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(c.GetAll()))
+
+	// ok: redefined item loses its old tags
+	assert.NoError(t, c.Set("orders:all", "[1]", cm.INFINITY, "user:1"))
+	err = c.DeleteTagged("grid:orders")
+	assert.NoError(t, err)
+	assert.True(t, c.Exist("orders:all"))
+
+	// ok: multiple tags
+	assert.NoError(t, c.Set("bar", "baz", cm.INFINITY, "bar"))
+	err = c.DeleteTagged("bar", "user:1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(c.GetAll()))
+	assert.True(t, c.Exist("foo"))
+}
+
+func TestMemory_Stats(t *testing.T) {
+	var evicted, expired []string
+	c := memory.New(memory.Options{
+		GCInterval:    10 * time.Millisecond,
+		Shards:        1,
+		MaxItems:      3,
+		StatsPrefixes: []string{"user:", "grid:"},
+		OnEvict: func(key string, value interface{}) {
+			evicted = append(evicted, key)
+		},
+	})
+
+	assert.NoError(t, c.Set("user:1", "John", cm.INFINITY))
+	assert.NoError(t, c.Set("user:2", "Jane", cm.INFINITY))
+	assert.NoError(t, c.Set("grid:orders", "[]", cm.INFINITY))
+	_, _ = c.Get("user:1")
+	_, _ = c.Get("user:1")
+	_, _ = c.Get("user:3")
+	_, _ = c.Get("grid:orders")
+	_, _ = c.Get("foo")
+
+	// ok: user:2 gets evicted
+	assert.NoError(t, c.Set("foo", "bar", cm.INFINITY))
+	assert.Equal(t, []string{"user:2"}, evicted)
+
+	s := c.Stats()
+	assert.Equal(t, uint64(3), s.Hits)
+	assert.Equal(t, uint64(2), s.Misses)
+	assert.Equal(t, uint64(1), s.Evictions)
+	assert.Equal(t, 3, s.Items)
+	assert.Equal(t, 2, len(s.Prefixes))
+	assert.Equal(t, cm.Stats{Hits: 2, Misses: 1, Evictions: 1, Items: 1}, s.Prefixes["user:"])
+	assert.Equal(t, cm.Stats{Hits: 1, Items: 1}, s.Prefixes["grid:"])
+
+	// ok: expiration callback
+	c = memory.New(memory.Options{
+		GCInterval: 10 * time.Millisecond,
+		OnExpire: func(key string, value interface{}) {
+			expired = append(expired, key+"="+value.(string))
+			// the cache can be used in the callback
+			_ = c.Set(key, "refreshed", cm.INFINITY)
+		},
+	})
+	go c.GC()
+	assert.NoError(t, c.Set("hot", "val", 5*time.Millisecond))
+	time.Sleep(100 * time.Millisecond)
+	v, err := c.Get("hot")
+	assert.NoError(t, err)
+	assert.Equal(t, "refreshed", v.Value())
+	assert.Equal(t, []string{"hot=val"}, expired)
+	assert.Equal(t, uint64(1), c.Stats().Expirations)
+	assert.Nil(t, c.Stats().Prefixes)
+}
+
+func TestMemory_Increment(t *testing.T) {
+	c := memory.New(nil)
+
+	// ok: key is created
+	v, err := c.Increment("login:john", 1, 50*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), v)
+
+	// ok
+	v, err = c.Increment("login:john", 2, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), v)
+	v, err = c.Decrement("login:john", 1, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), v)
+
+	// ok: ttl of the first increment is kept, expired keys are recreated
+	time.Sleep(60 * time.Millisecond)
+	v, err = c.Increment("login:john", 1, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), v)
+
+	// ok: int values
+	assert.NoError(t, c.Set("int", 5, cm.INFINITY))
+	v, err = c.Decrement("int", 10, cm.INFINITY)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(-5), v)
+
+	// error: no integer
+	assert.NoError(t, c.Set("foo", "bar", cm.INFINITY))
+	v, err = c.Increment("foo", 1, cm.INFINITY)
+	assert.Error(t, err)
+	assert.Equal(t, fmt.Sprintf(cm.ErrNotInteger.Error(), "foo"), err.Error())
+
+	// ok: counters keep their usage of the eviction policy
+	c = memory.New(memory.Options{Shards: 1, MaxItems: 2, Eviction: memory.LFU})
+	for i := 0; i < 5; i++ {
+		_, err = c.Increment("hits", 1, cm.INFINITY)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, c.Set("a", 1, cm.INFINITY))
+	_, _ = c.Get("a")
+	assert.NoError(t, c.Set("b", 1, cm.INFINITY))
+	assert.True(t, c.Exist("hits"))
+	assert.False(t, c.Exist("a"))
+
+	// ok: concurrent
+	c = memory.New(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = c.Increment("counter", 1, cm.INFINITY)
+		}()
+	}
+	wg.Wait()
+	val, err := c.Get("counter")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), val.Value())
+}
+
+func TestMemory_SetIfNotExists(t *testing.T) {
+	c := memory.New(nil)
+
+	// ok
+	ok, err := c.SetIfNotExists("lock", "owner1", 50*time.Millisecond)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// ok: already exists
+	ok, err = c.SetIfNotExists("lock", "owner2", 50*time.Millisecond)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// ok: expired
+	time.Sleep(60 * time.Millisecond)
+	ok, err = c.SetIfNotExists("lock", "owner2", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	v, err := c.Get("lock")
+	assert.NoError(t, err)
+	assert.Equal(t, "owner2", v.Value())
+
+	// ok: concurrent
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	winner := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := c.SetIfNotExists("race", 1, cm.INFINITY); ok {
+				mutex.Lock()
+				winner++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, winner)
+}
+
+func TestMemory_CompareAndSwap(t *testing.T) {
+	c := memory.New(nil)
+
+	// ok: key does not exist
+	ok, err := c.CompareAndSwap("lock", "owner1", "owner2", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// ok: value does not match
+	assert.NoError(t, c.Set("lock", "owner1", cm.INFINITY))
+	ok, err = c.CompareAndSwap("lock", "owner2", "owner3", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// ok
+	ok, err = c.CompareAndSwap("lock", "owner1", "owner2", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	v, err := c.Get("lock")
+	assert.NoError(t, err)
+	assert.Equal(t, "owner2", v.Value())
+
+	// ok: deep equal
+	assert.NoError(t, c.Set("slice", []string{"a"}, cm.INFINITY))
+	ok, err = c.CompareAndSwap("slice", []string{"a"}, []string{"b"}, cm.INFINITY)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// ok: the tags are kept
+	assert.NoError(t, c.Set("tagged", "a", cm.INFINITY, "locks"))
+	ok, err = c.CompareAndSwap("tagged", "a", "b", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.NoError(t, c.DeleteTagged("locks"))
+	assert.False(t, c.Exist("tagged"))
+}
+
+func TestMemory_Close(t *testing.T) {
+	c := memory.New(memory.Options{GCInterval: time.Millisecond})
+	assert.NoError(t, c.Set("foo", "bar", cm.INFINITY))
+
+	done := make(chan struct{})
+	go func() {
+		c.GC()
+		close(done)
+	}()
+
+	// ok: gc stops and items are removed
+	assert.NoError(t, c.Close())
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("gc was not stopped")
+	}
+	assert.False(t, c.Exist("foo"))
+
+	// ok: multiple calls
+	assert.NoError(t, c.Close())
+}
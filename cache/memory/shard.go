@@ -0,0 +1,179 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	cm "github.com/patrickascher/gofw/cache"
+)
+
+// shard holds a part of the items, identified by the hash of the key.
+// Each shard has its own lock, tag index and eviction policy. The limits are checked against the whole cache.
+type shard struct {
+	mutex  sync.RWMutex
+	cache  *memory
+	index  int
+	items  map[string]*item
+	tags   map[string]map[string]struct{} // tag index tag => keys
+	policy policy                         // nil if the cache is not bounded
+	size   int64                          // approximated size of all items
+}
+
+// newShard creates the shard with the given index.
+func newShard(m *memory, index int) *shard {
+	s := &shard{cache: m, index: index}
+	s.reset()
+	if m.bounded() {
+		s.policy = newPolicy(m.options.Eviction)
+	}
+	return s
+}
+
+// reset removes all items.
+// The caller must hold the write lock.
+func (s *shard) reset() {
+	if s.policy != nil {
+		atomic.AddInt64(&s.cache.items, -int64(len(s.items)))
+		atomic.AddInt64(&s.cache.size, -s.size)
+	}
+	s.items = make(map[string]*item)
+	s.tags = make(map[string]map[string]struct{})
+	s.size = 0
+	if s.policy != nil {
+		s.policy.reset()
+	}
+}
+
+// prefixed adds all items with the given prefix to the map.
+// The caller must hold the lock.
+func (s *shard) prefixed(prefix string, rv map[string]cm.Valuer) {
+	for k, i := range s.items {
+		if strings.HasPrefix(k, prefix) {
+			rv[k] = i
+		}
+	}
+}
+
+// set adds the item to the shard. An existing item is replaced.
+// Items of the shard are evicted until the item fits, if the shard has no items left the cache can exceed the limits.
+// In that case the items of the other shards must be evicted by memory.evict after the lock is released.
+// The evicted keys and values will return.
+// The caller must hold the write lock.
+func (s *shard) set(key string, i *item) map[string]interface{} {
+	// an existing item is handled like a new one.
+	if _, ok := s.items[key]; ok {
+		s.delete(key)
+	}
+	var evicted map[string]interface{}
+	if s.policy != nil {
+		evicted = s.evict(i.size, false, nil)
+		s.size += i.size
+		atomic.AddInt64(&s.cache.items, 1)
+		atomic.AddInt64(&s.cache.size, i.size)
+		s.policy.add(key)
+	}
+	s.items[key] = i
+	for _, tag := range i.tags {
+		if _, ok := s.tags[tag]; !ok {
+			s.tags[tag] = make(map[string]struct{})
+		}
+		s.tags[tag][key] = struct{}{}
+	}
+	return evicted
+}
+
+// replace sets the new item of an existing key. The tags must be the same.
+// The policy entry is kept and marked as accessed, the size is updated.
+// The caller must hold the write lock.
+func (s *shard) replace(key string, i *item) {
+	if s.policy != nil {
+		diff := i.size - s.items[key].size
+		s.size += diff
+		atomic.AddInt64(&s.cache.size, diff)
+		s.policy.access(key)
+	}
+	s.items[key] = i
+}
+
+// valid returns the item if it exists and is not expired.
+// The caller must hold the lock.
+func (s *shard) valid(key string) (*item, bool) {
+	if i, ok := s.items[key]; ok && !i.expired() {
+		return i, true
+	}
+	return nil, false
+}
+
+// delete removes the item, its tag references and policy entry.
+// The caller must hold the write lock.
+func (s *shard) delete(key string) {
+	i := s.items[key]
+	if s.policy != nil {
+		s.size -= i.size
+		atomic.AddInt64(&s.cache.items, -1)
+		atomic.AddInt64(&s.cache.size, -i.size)
+		s.policy.remove(key)
+	}
+	for _, tag := range i.tags {
+		delete(s.tags[tag], key)
+		if len(s.tags[tag]) == 0 {
+			delete(s.tags, tag)
+		}
+	}
+	delete(s.items, key)
+}
+
+// evict removes items of the shard by the policy until an item with the given size fits into the cache.
+// If over is true, items are removed until the cache is within its limits.
+// The evicted keys and values are added to the given map.
+// The caller must hold the write lock.
+func (s *shard) evict(size int64, over bool, evicted map[string]interface{}) map[string]interface{} {
+	for (!over && s.cache.full(size)) || (over && s.cache.over()) {
+		key, ok := s.policy.victim()
+		if !ok {
+			break
+		}
+		if evicted == nil {
+			evicted = make(map[string]interface{})
+		}
+		evicted[key] = s.items[key].Value()
+		s.delete(key)
+		s.cache.count(key, eviction)
+	}
+	return evicted
+}
+
+// expire removes all expired items.
+// The expired keys and values will return.
+func (s *shard) expire(m *memory) map[string]interface{} {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var expired map[string]interface{}
+	for key, i := range s.items {
+		if i.expired() {
+			if expired == nil {
+				expired = make(map[string]interface{})
+			}
+			expired[key] = i.Value()
+			s.delete(key)
+			m.count(key, expiration)
+		}
+	}
+	return expired
+}
+
+// fnv32 returns the FNV-1a hash of the key.
+func fnv32(key string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return h
+}
@@ -0,0 +1,63 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package memory
+
+import (
+	"strings"
+	"sync/atomic"
+
+	cm "github.com/patrickascher/gofw/cache"
+)
+
+// counter types.
+const (
+	hit = iota
+	miss
+	eviction
+	expiration
+)
+
+// counters of the cache or a prefix.
+// The counters are atomic, because hits and misses are counted under the read lock.
+type counters struct {
+	hits        uint64
+	misses      uint64
+	evictions   uint64
+	expirations uint64
+}
+
+// add increases the counter of the given type.
+func (c *counters) add(typ int) {
+	switch typ {
+	case hit:
+		atomic.AddUint64(&c.hits, 1)
+	case miss:
+		atomic.AddUint64(&c.misses, 1)
+	case eviction:
+		atomic.AddUint64(&c.evictions, 1)
+	case expiration:
+		atomic.AddUint64(&c.expirations, 1)
+	}
+}
+
+// toStats returns the counters as cache.Stats.
+func (c *counters) toStats() cm.Stats {
+	return cm.Stats{
+		Hits:        atomic.LoadUint64(&c.hits),
+		Misses:      atomic.LoadUint64(&c.misses),
+		Evictions:   atomic.LoadUint64(&c.evictions),
+		Expirations: atomic.LoadUint64(&c.expirations),
+	}
+}
+
+// count increases the counter of the cache and all matching prefixes.
+func (m *memory) count(key string, typ int) {
+	m.stats.add(typ)
+	for prefix, c := range m.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			c.add(typ)
+		}
+	}
+}
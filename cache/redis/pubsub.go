@@ -0,0 +1,166 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package redis
+
+import (
+	"sync"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// defaultReconnect is the waiting time before a lost subscription gets reconnected.
+var defaultReconnect = time.Second
+
+// PubSub is a message channel over redis pub/sub.
+// It implements the tiered.Invalidator interface.
+//
+// Messages which are published while a subscription is reconnecting are lost.
+type PubSub struct {
+	options Options
+	channel string
+	pool    *redigo.Pool
+
+	mutex   sync.Mutex
+	conns   map[redigo.Conn]chan struct{} // active subscriptions and their stop channel
+	closing chan struct{}
+	closed  bool
+}
+
+// NewPubSub creates a redis pub/sub channel by the given options.
+// The Options.Prefix is added to the channel name.
+func NewPubSub(options Options, channel string) *PubSub {
+	options = defaults(options)
+	p := &PubSub{options: options, channel: options.Prefix + channel, conns: make(map[redigo.Conn]chan struct{}), closing: make(chan struct{})}
+	p.pool = &redigo.Pool{
+		MaxIdle:     options.MaxIdle,
+		MaxActive:   options.MaxActive,
+		IdleTimeout: options.IdleTimeout,
+		Dial:        func() (redigo.Conn, error) { return dial(options, options.Timeout) },
+	}
+	return p
+}
+
+// Publish sends the message to all subscribers of the channel.
+func (p *PubSub) Publish(msg []byte) error {
+	conn := p.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("PUBLISH", p.channel, msg)
+	return err
+}
+
+// Subscribe calls the function for every message of the channel.
+// The subscription runs in its own goroutine and reconnects if the connection gets lost.
+// Subscribe returns after the first subscription attempt, like this no message gets lost which is published afterwards.
+// The returned function ends the subscription.
+func (p *PubSub) Subscribe(fn func(msg []byte)) func() {
+	var once sync.Once
+	ready := make(chan struct{})
+	stop := make(chan struct{})
+	go p.listen(fn, stop, func() { once.Do(func() { close(ready) }) })
+	<-ready
+
+	var unsubscribe sync.Once
+	return func() { unsubscribe.Do(func() { p.unsubscribe(stop) }) }
+}
+
+// unsubscribe ends the subscription of the given stop channel.
+func (p *PubSub) unsubscribe(stop chan struct{}) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	close(stop)
+	for conn, s := range p.conns {
+		if s == stop {
+			_ = conn.Close()
+		}
+	}
+}
+
+// Close ends all subscriptions and closes the connection pool.
+func (p *PubSub) Close() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	close(p.closing)
+	for conn := range p.conns {
+		_ = conn.Close()
+	}
+	return p.pool.Close()
+}
+
+// listen receives the messages of the channel until the PubSub gets closed or the subscription is stopped.
+func (p *PubSub) listen(fn func([]byte), stop chan struct{}, ready func()) {
+	for {
+		p.receive(fn, stop, ready)
+		ready()
+		select {
+		case <-p.closing:
+			return
+		case <-stop:
+			return
+		case <-time.After(defaultReconnect):
+		}
+	}
+}
+
+// track adds or removes an active subscription.
+// False will return if the PubSub is already closed or the subscription was stopped.
+func (p *PubSub) track(conn redigo.Conn, stop chan struct{}, add bool) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !add {
+		delete(p.conns, conn)
+		return true
+	}
+	if p.closed {
+		return false
+	}
+	select {
+	case <-stop:
+		return false
+	default:
+	}
+	p.conns[conn] = stop
+	return true
+}
+
+// receive subscribes the channel and calls the function until an error occurs.
+// ready is called after the subscription is confirmed.
+func (p *PubSub) receive(fn func([]byte), stop chan struct{}, ready func()) {
+	// no read timeout, the connection is idle until a message is published.
+	conn, err := dial(p.options, 0)
+	if err != nil {
+		return
+	}
+	if !p.track(conn, stop, true) {
+		_ = conn.Close()
+		return
+	}
+	defer p.track(conn, stop, false)
+
+	psc := redigo.PubSubConn{Conn: conn}
+	defer psc.Close()
+
+	if err := psc.Subscribe(p.channel); err != nil {
+		return
+	}
+	for {
+		switch v := psc.Receive().(type) {
+		case redigo.Message:
+			fn(v.Data)
+		case redigo.Subscription:
+			ready()
+		case error:
+			return
+		}
+	}
+}
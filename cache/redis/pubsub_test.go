@@ -0,0 +1,99 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package redis_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	cm "github.com/patrickascher/gofw/cache"
+	"github.com/patrickascher/gofw/cache/memory"
+	"github.com/patrickascher/gofw/cache/redis"
+	"github.com/patrickascher/gofw/cache/tiered"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPubSub(t *testing.T) {
+	srv, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	ps := redis.NewPubSub(redis.Options{Addr: srv.Addr(), Prefix: "app:"}, "invalidate")
+
+	msgs := make(chan string, 2)
+	ps.Subscribe(func(msg []byte) { msgs <- string(msg) })
+	ps.Subscribe(func(msg []byte) { msgs <- string(msg) })
+
+	assert.NoError(t, ps.Publish([]byte("foo")))
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-msgs:
+			assert.Equal(t, "foo", msg)
+		case <-time.After(time.Second):
+			t.Fatal("message was not received")
+		}
+	}
+}
+
+func TestPubSub_Tiered(t *testing.T) {
+	srv, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	opt := redis.Options{Addr: srv.Addr()}
+	remote := redis.New(opt)
+	a := tiered.New(tiered.Options{Remote: remote, Local: memory.Options{}, Invalidator: redis.NewPubSub(opt, "invalidate")})
+	b := tiered.New(tiered.Options{Remote: remote, Invalidator: redis.NewPubSub(opt, "invalidate")})
+
+	assert.NoError(t, a.Set("foo", "bar", cm.INFINITY))
+	v, err := b.Get("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", v.Value())
+
+	assert.NoError(t, a.Set("foo", "baz", cm.INFINITY))
+	assert.Eventually(t, func() bool {
+		v, err := b.Get("foo")
+		return err == nil && v.Value() == "baz"
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestPubSub_Close(t *testing.T) {
+	srv, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	ps := redis.NewPubSub(redis.Options{Addr: srv.Addr()}, "invalidate")
+	ps.Subscribe(func(msg []byte) {})
+	assert.Equal(t, 1, srv.PubSubNumSub("invalidate")["invalidate"])
+
+	// ok: subscriptions are closed
+	assert.NoError(t, ps.Close())
+	assert.Eventually(t, func() bool {
+		return srv.PubSubNumSub("invalidate")["invalidate"] == 0
+	}, time.Second, 5*time.Millisecond)
+	assert.Error(t, ps.Publish([]byte("foo")))
+	assert.NoError(t, ps.Close())
+}
+
+func TestPubSub_Unsubscribe(t *testing.T) {
+	srv, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	ps := redis.NewPubSub(redis.Options{Addr: srv.Addr()}, "invalidate")
+	defer ps.Close()
+	unsubscribe := ps.Subscribe(func(msg []byte) {})
+	ps.Subscribe(func(msg []byte) {})
+	assert.Equal(t, 2, srv.PubSubNumSub("invalidate")["invalidate"])
+
+	// ok: only the one subscription is ended
+	unsubscribe()
+	unsubscribe()
+	assert.Eventually(t, func() bool {
+		return srv.PubSubNumSub("invalidate")["invalidate"] == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.NoError(t, ps.Publish([]byte("foo")))
+}
@@ -0,0 +1,744 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package redis implements the cache.Interface and registers a redis provider.
+// A connection pool is used, the connection is established on the first command.
+//
+// Values are encoded by the Options.Codec (default cache.Gob). Custom types must be registered with cache.RegisterType before they are set.
+// Tags are stored as redis sets, which contain the keys of the tag. Additionally the tags of each key are stored in a set,
+// like this the memberships are removed if the key gets overwritten or deleted.
+// Redis is handling the ttl itself, the garbage collector only removes expired keys from the tag sets.
+//
+// Check the redis.Options for the available configurations.
+package redis
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+	cm "github.com/patrickascher/gofw/cache"
+)
+
+// init register the redis provider.
+func init() {
+	_ = cm.Register(cm.REDIS, New)
+}
+
+// defaults of the redis provider.
+var (
+	defaultAddr        = "127.0.0.1:6379"
+	defaultMaxIdle     = 10
+	defaultIdleTimeout = 240 * time.Second
+	defaultScanCount   = 100
+	defaultMaxRetries  = 100
+	defaultGCInterval  = 60
+)
+
+// tagPrefix is used for the tag sets, keyTagPrefix for the sets which contain the tags of a key.
+const (
+	tagPrefix    = "__tag__:"
+	keyTagPrefix = "__tags__:"
+)
+
+// Error messages
+var (
+	ErrKeyNotExist = errors.New("cache/redis: key %v does not exist")
+	ErrTransaction = errors.New("cache/redis: transaction of key %v failed after %d retries")
+)
+
+// redis cache provider
+type redis struct {
+	options Options
+	pool    *redigo.Pool
+	hits    uint64
+	misses  uint64
+	closing chan struct{}
+	closed  sync.Once
+}
+
+// Options for the redis provider.
+type Options struct {
+	// Addr of the redis server in the format host:port.
+	// Default is 127.0.0.1:6379.
+	Addr string
+	// Password is used for the AUTH command if set.
+	Password string
+	// DB will be selected after the connection is established.
+	DB int
+	// Prefix is added to all keys. Like this multiple applications can share a redis db.
+	// If the prefix is set, DeleteAll only removes the prefixed keys, otherwise the whole db is flushed.
+	Prefix string
+	// MaxIdle connections in the pool. Default is 10.
+	MaxIdle int
+	// MaxActive connections in the pool. 0 means unlimited.
+	MaxActive int
+	// IdleTimeout after which a idle connection gets closed. Default is 240 seconds.
+	IdleTimeout time.Duration
+	// Timeout for connect, read and write. 0 means no timeout.
+	Timeout time.Duration
+	// Codec to encode the values. Default is cache.Gob.
+	Codec cm.Codec
+	// GCInterval of the garbage collector, which removes expired keys from the tag sets. Default is 60 seconds.
+	GCInterval time.Duration
+}
+
+// item implements the Valuer interface
+type item struct {
+	val interface{}
+}
+
+// Value returns the value of the item.
+func (i *item) Value() interface{} {
+	return i.val
+}
+
+// New creates a redis cache by the given options.
+func New(opt interface{}) cm.Interface {
+	options := Options{}
+	if opt != nil {
+		options = opt.(Options)
+	}
+	options = defaults(options)
+
+	r := &redis{options: options, closing: make(chan struct{})}
+	r.pool = &redigo.Pool{
+		MaxIdle:     options.MaxIdle,
+		MaxActive:   options.MaxActive,
+		IdleTimeout: options.IdleTimeout,
+		Dial:        func() (redigo.Conn, error) { return dial(options, options.Timeout) },
+	}
+
+	return r
+}
+
+// defaults sets the default values of the options.
+func defaults(options Options) Options {
+	if options.Addr == "" {
+		options.Addr = defaultAddr
+	}
+	if options.MaxIdle == 0 {
+		options.MaxIdle = defaultMaxIdle
+	}
+	if options.IdleTimeout == 0 {
+		options.IdleTimeout = defaultIdleTimeout
+	}
+	if options.Codec == nil {
+		options.Codec = cm.Gob
+	}
+	if options.GCInterval <= 0 {
+		options.GCInterval = time.Duration(defaultGCInterval) * time.Second
+	}
+	return options
+}
+
+// dial creates a new redis connection with the given read timeout.
+func dial(options Options, readTimeout time.Duration) (redigo.Conn, error) {
+	return redigo.Dial("tcp", options.Addr,
+		redigo.DialPassword(options.Password),
+		redigo.DialDatabase(options.DB),
+		redigo.DialConnectTimeout(options.Timeout),
+		redigo.DialReadTimeout(readTimeout),
+		redigo.DialWriteTimeout(options.Timeout),
+	)
+}
+
+// Get returns the value of the given key.
+// Error will return if the key does not exist.
+func (r *redis) Get(key string) (cm.Valuer, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	b, err := redigo.Bytes(conn.Do("GET", r.key(key)))
+	if err != nil {
+		if err == redigo.ErrNil {
+			atomic.AddUint64(&r.misses, 1)
+			return nil, fmt.Errorf(ErrKeyNotExist.Error(), key)
+		}
+		return nil, err
+	}
+
+	atomic.AddUint64(&r.hits, 1)
+	return r.decode(b)
+}
+
+// GetPrefixed returns all items with the given prefix as map.
+func (r *redis) GetPrefixed(prefix string) map[string]cm.Valuer {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	rv := make(map[string]cm.Valuer)
+	keys, err := r.scan(conn, prefix)
+	if err != nil {
+		return rv
+	}
+
+	args := make([]interface{}, 0, len(keys))
+	for _, k := range keys {
+		if !r.isTag(k) {
+			args = append(args, k)
+		}
+	}
+	if len(args) == 0 {
+		return rv
+	}
+	values, err := redigo.ByteSlices(conn.Do("MGET", args...))
+	if err != nil {
+		return rv
+	}
+
+	for i, b := range values {
+		// key expired in the meantime
+		if b == nil {
+			continue
+		}
+		v, err := r.decode(b)
+		if err != nil {
+			continue
+		}
+		rv[strings.TrimPrefix(args[i].(string), r.options.Prefix)] = v
+	}
+
+	return rv
+}
+
+// GetAll returns all items of the cache as map.
+func (r *redis) GetAll() map[string]cm.Valuer {
+	return r.GetPrefixed("")
+}
+
+// Set key/value pair.
+// The ttl can be set by duration or forever with cache.INFINITY.
+// The key is added to the set of each tag, the memberships of an overwritten key are removed.
+// All commands are executed in a transaction.
+func (r *redis) Set(key string, value interface{}, ttl time.Duration, tags ...string) error {
+	b, err := r.encode(value)
+	if err != nil {
+		return err
+	}
+
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	args := []interface{}{r.key(key), b}
+	if ttl != cm.INFINITY {
+		args = append(args, "PX", ttl.Milliseconds())
+	}
+	_, err = r.tagged(conn, []string{key}, func(old [][]string) error {
+		err := r.untag(conn, key, old[0])
+		if err != nil {
+			return err
+		}
+		err = conn.Send("SET", args...)
+		if err != nil {
+			return err
+		}
+		for _, tag := range tags {
+			err = conn.Send("SADD", r.key(tagPrefix+tag), r.key(key))
+			if err != nil {
+				return err
+			}
+			err = conn.Send("SADD", r.key(keyTagPrefix+key), tag)
+			if err != nil {
+				return err
+			}
+		}
+		if len(tags) > 0 && ttl != cm.INFINITY {
+			return conn.Send("PEXPIRE", r.key(keyTagPrefix+key), ttl.Milliseconds())
+		}
+		return nil
+	})
+	return err
+}
+
+// Exist returns true if the key exists.
+func (r *redis) Exist(key string) bool {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	exists, err := redigo.Bool(conn.Do("EXISTS", r.key(key)))
+	if err != nil {
+		return false
+	}
+	return exists
+}
+
+// Delete removes a given key from the cache.
+// Error will return if the key does not exist.
+func (r *redis) Delete(key string) error {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	reply, err := r.tagged(conn, []string{key}, func(old [][]string) error {
+		err := r.untag(conn, key, old[0])
+		if err != nil {
+			return err
+		}
+		return conn.Send("DEL", r.key(key))
+	})
+	if err != nil {
+		return err
+	}
+	n, err := redigo.Int(reply[len(reply)-1], nil)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf(ErrKeyNotExist.Error(), key)
+	}
+	return nil
+}
+
+// DeleteAll removes all items from the cache.
+// If no Options.Prefix is set, the whole db will be flushed.
+func (r *redis) DeleteAll() error {
+	if r.options.Prefix == "" {
+		conn := r.pool.Get()
+		defer conn.Close()
+
+		_, err := conn.Do("FLUSHDB")
+		return err
+	}
+	return r.DeletePrefixed("")
+}
+
+// DeletePrefixed removes all items with the given prefix and their tag memberships.
+// If the prefix is empty, the tag sets are deleted as well.
+func (r *redis) DeletePrefixed(prefix string) error {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	keys, err := r.scan(conn, prefix)
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+
+	var items []string
+	var sets []interface{}
+	for _, k := range keys {
+		if !r.isTag(k) {
+			items = append(items, strings.TrimPrefix(k, r.options.Prefix))
+		} else if prefix == "" {
+			sets = append(sets, k)
+		}
+	}
+	if len(items) > 0 {
+		_, err = r.tagged(conn, items, func(old [][]string) error {
+			args := make([]interface{}, len(items))
+			for i, k := range items {
+				err := r.untag(conn, k, old[i])
+				if err != nil {
+					return err
+				}
+				args[i] = r.key(k)
+			}
+			return conn.Send("DEL", args...)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if len(sets) > 0 {
+		_, err = conn.Do("DEL", sets...)
+	}
+	return err
+}
+
+// DeleteTagged removes all items which have at least one of the given tags.
+// The members of the tag sets are only deleted if the key still has the tag. The tag sets are deleted as well.
+func (r *redis) DeleteTagged(tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	sets := make([]interface{}, len(tags))
+	for i, tag := range tags {
+		sets[i] = r.key(tagPrefix + tag)
+	}
+	members, err := redigo.Strings(conn.Do("SUNION", sets...))
+	if err != nil {
+		return err
+	}
+	keys := make([]string, len(members))
+	for i, m := range members {
+		keys[i] = strings.TrimPrefix(m, r.options.Prefix)
+	}
+
+	_, err = r.tagged(conn, keys, func(old [][]string) error {
+		var del []interface{}
+		for i, k := range keys {
+			if !hasTag(old[i], tags) {
+				continue
+			}
+			err := r.untag(conn, k, old[i])
+			if err != nil {
+				return err
+			}
+			del = append(del, r.key(k))
+		}
+		return conn.Send("DEL", append(sets, del...)...)
+	})
+	return err
+}
+
+// Increment the integer value of the key by delta and returns the new value.
+// If the key does not exist, it will be created with the given ttl. The ttl of an existing key is not changed.
+// Because values are encoded by the codec, an optimistic transaction (WATCH/MULTI/EXEC) is used instead of INCRBY.
+// Error will return if the value is not an integer.
+func (r *redis) Increment(key string, delta int64, ttl time.Duration) (int64, error) {
+	var v int64
+	_, err := r.update(key, ttl, true, func(cur cm.Valuer) (interface{}, bool, error) {
+		v = 0
+		if cur != nil {
+			i, err := cm.Int64(key, cur.Value())
+			if err != nil {
+				return nil, false, err
+			}
+			v = i
+		}
+		v += delta
+		return v, true, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return v, nil
+}
+
+// Decrement the integer value of the key by delta and returns the new value.
+// See Increment for more details.
+func (r *redis) Decrement(key string, delta int64, ttl time.Duration) (int64, error) {
+	return r.Increment(key, -delta, ttl)
+}
+
+// SetIfNotExists sets the value only if the key does not exist.
+// True will return if the value was set.
+func (r *redis) SetIfNotExists(key string, value interface{}, ttl time.Duration) (bool, error) {
+	b, err := r.encode(value)
+	if err != nil {
+		return false, err
+	}
+
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	args := []interface{}{r.key(key), b, "NX"}
+	if ttl != cm.INFINITY {
+		args = append(args, "PX", ttl.Milliseconds())
+	}
+	reply, err := conn.Do("SET", args...)
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
+
+// CompareAndSwap sets the new value only if the key exists and its value is equal to old.
+// The values are compared with reflect.DeepEqual, the tags of the key are kept.
+// True will return if the value was swapped.
+func (r *redis) CompareAndSwap(key string, old interface{}, new interface{}, ttl time.Duration) (bool, error) {
+	return r.update(key, ttl, false, func(cur cm.Valuer) (interface{}, bool, error) {
+		if cur == nil || !reflect.DeepEqual(cur.Value(), old) {
+			return nil, false, nil
+		}
+		return new, true, nil
+	})
+}
+
+// Stats returns the hits and misses of this instance and the number of stored items.
+// Evictions and expirations are handled by redis and are not counted.
+func (r *redis) Stats() cm.Stats {
+	rv := cm.Stats{Hits: atomic.LoadUint64(&r.hits), Misses: atomic.LoadUint64(&r.misses)}
+
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	keys, err := r.scan(conn, "")
+	if err != nil {
+		return rv
+	}
+	for _, k := range keys {
+		if !r.isTag(k) {
+			rv.Items++
+		}
+	}
+
+	return rv
+}
+
+// GC is an infinity loop. The loop will rerun after an specific interval time which can be set
+// in the options (default 60sec).
+// Redis is handling the ttl itself, only expired keys are removed from the tag sets.
+// The loop ends if the cache gets closed.
+func (r *redis) GC() {
+	ticker := time.NewTicker(r.options.GCInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.closing:
+			return
+		case <-ticker.C:
+			r.gc()
+		}
+	}
+}
+
+// Close stops the garbage collector and closes the connection pool.
+func (r *redis) Close() error {
+	r.closed.Do(func() { close(r.closing) })
+	return r.pool.Close()
+}
+
+// gc removes the keys which do not exist anymore from the tag sets.
+func (r *redis) gc() {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	sets, err := r.scan(conn, tagPrefix)
+	if err != nil {
+		return
+	}
+	for _, set := range sets {
+		members, err := redigo.Strings(conn.Do("SMEMBERS", set))
+		if err != nil {
+			continue
+		}
+		for _, m := range members {
+			if exists, err := redigo.Bool(conn.Do("EXISTS", m)); err == nil && !exists {
+				_, _ = conn.Do("SREM", set, m)
+			}
+		}
+	}
+}
+
+// tagged runs an optimistic transaction on the given keys.
+// The function receives the current tags of each key and must send the commands of the transaction.
+// The transaction is retried if the tags of a key were modified in the meantime.
+// The reply of the EXEC command will return.
+func (r *redis) tagged(conn redigo.Conn, keys []string, fn func(old [][]string) error) ([]interface{}, error) {
+	watch := make([]interface{}, len(keys))
+	for i, k := range keys {
+		watch[i] = r.key(keyTagPrefix + k)
+	}
+
+	for n := 0; n < defaultMaxRetries; n++ {
+		if len(watch) > 0 {
+			_, err := conn.Do("WATCH", watch...)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		old := make([][]string, len(keys))
+		for i := range keys {
+			tags, err := redigo.Strings(conn.Do("SMEMBERS", watch[i]))
+			if err != nil {
+				_, _ = conn.Do("UNWATCH")
+				return nil, err
+			}
+			old[i] = tags
+		}
+
+		err := conn.Send("MULTI")
+		if err != nil {
+			return nil, err
+		}
+		err = fn(old)
+		if err != nil {
+			_, _ = conn.Do("DISCARD")
+			return nil, err
+		}
+		reply, err := redigo.Values(conn.Do("EXEC"))
+		if err != nil && err != redigo.ErrNil {
+			return nil, err
+		}
+		// a nil reply means that the tags were modified in the meantime.
+		if reply != nil {
+			return reply, nil
+		}
+	}
+
+	return nil, fmt.Errorf(ErrTransaction.Error(), strings.Join(keys, ","), defaultMaxRetries)
+}
+
+// untag sends the commands to remove the key from the given tag sets and deletes the tags of the key.
+func (r *redis) untag(conn redigo.Conn, key string, tags []string) error {
+	for _, tag := range tags {
+		err := conn.Send("SREM", r.key(tagPrefix+tag), r.key(key))
+		if err != nil {
+			return err
+		}
+	}
+	return conn.Send("DEL", r.key(keyTagPrefix+key))
+}
+
+// hasTag returns true if at least one of the tags is in the list.
+func hasTag(list []string, tags []string) bool {
+	for _, l := range list {
+		for _, t := range tags {
+			if l == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// key returns the key with the configured prefix.
+func (r *redis) key(key string) string {
+	return r.options.Prefix + key
+}
+
+// update runs an optimistic transaction on the given key.
+// The function receives the current value (nil if the key does not exist) and returns the new value and if it should be written.
+// If keepTTL is true, the remaining ttl of an existing key is read by PTTL and set again.
+// KEEPTTL is not used, because it needs redis 6.
+// The transaction is retried if the key was modified in the meantime.
+// True will return if the value was written.
+func (r *redis) update(key string, ttl time.Duration, keepTTL bool, fn func(cm.Valuer) (interface{}, bool, error)) (bool, error) {
+	conn := r.pool.Get()
+	defer conn.Close()
+
+	for n := 0; n < defaultMaxRetries; n++ {
+		_, err := conn.Do("WATCH", r.key(key))
+		if err != nil {
+			return false, err
+		}
+
+		var cur cm.Valuer
+		b, err := redigo.Bytes(conn.Do("GET", r.key(key)))
+		if err == nil {
+			cur, err = r.decode(b)
+		}
+		if err != nil && err != redigo.ErrNil {
+			_, _ = conn.Do("UNWATCH")
+			return false, err
+		}
+
+		value, write, err := fn(cur)
+		if err != nil || !write {
+			_, _ = conn.Do("UNWATCH")
+			return false, err
+		}
+		b, err = r.encode(value)
+		if err != nil {
+			_, _ = conn.Do("UNWATCH")
+			return false, err
+		}
+
+		args := []interface{}{r.key(key), b}
+		if cur != nil && keepTTL {
+			pttl, err := redigo.Int64(conn.Do("PTTL", r.key(key)))
+			if err != nil {
+				_, _ = conn.Do("UNWATCH")
+				return false, err
+			}
+			// the key expired after it was read, the transaction is retried.
+			if pttl == -2 {
+				_, _ = conn.Do("UNWATCH")
+				continue
+			}
+			if pttl > 0 {
+				args = append(args, "PX", pttl)
+			}
+		} else if ttl != cm.INFINITY {
+			args = append(args, "PX", ttl.Milliseconds())
+		}
+		err = conn.Send("MULTI")
+		if err != nil {
+			return false, err
+		}
+		err = conn.Send("SET", args...)
+		if err != nil {
+			return false, err
+		}
+		// the tags of the key must expire with the key.
+		if cur == nil || !keepTTL {
+			if ttl != cm.INFINITY {
+				err = conn.Send("PEXPIRE", r.key(keyTagPrefix+key), ttl.Milliseconds())
+			} else {
+				err = conn.Send("PERSIST", r.key(keyTagPrefix+key))
+			}
+			if err != nil {
+				return false, err
+			}
+		}
+		reply, err := conn.Do("EXEC")
+		if err != nil {
+			return false, err
+		}
+		// a nil reply means that the key was modified in the meantime.
+		if reply != nil {
+			return true, nil
+		}
+	}
+
+	return false, fmt.Errorf(ErrTransaction.Error(), key, defaultMaxRetries)
+}
+
+// isTag checks if the redis key is a tag set or the tags of a key.
+func (r *redis) isTag(key string) bool {
+	return strings.HasPrefix(key, r.key(tagPrefix)) || strings.HasPrefix(key, r.key(keyTagPrefix))
+}
+
+// scan returns all redis keys which are starting with the given prefix.
+// The returned keys include the Options.Prefix.
+func (r *redis) scan(conn redigo.Conn, prefix string) ([]string, error) {
+	var keys []string
+	pattern := escapePattern(r.key(prefix)) + "*"
+	cursor := 0
+	for {
+		values, err := redigo.Values(conn.Do("SCAN", cursor, "MATCH", pattern, "COUNT", defaultScanCount))
+		if err != nil {
+			return nil, err
+		}
+		cursor, err = redigo.Int(values[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		k, err := redigo.Strings(values[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k...)
+		if cursor == 0 {
+			return keys, nil
+		}
+	}
+}
+
+// escapePattern escapes the glob-style characters of the redis MATCH pattern.
+func escapePattern(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteRune('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// encode the given value with the codec.
+func (r *redis) encode(value interface{}) ([]byte, error) {
+	return r.options.Codec.Encode(value)
+}
+
+// decode the given bytes into a Valuer.
+func (r *redis) decode(b []byte) (cm.Valuer, error) {
+	v, err := r.options.Codec.Decode(b)
+	if err != nil {
+		return nil, err
+	}
+	return &item{val: v}, nil
+}
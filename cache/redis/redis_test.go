@@ -0,0 +1,411 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package redis_test
+
+import (
+	"encoding/gob"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	cm "github.com/patrickascher/gofw/cache"
+	"github.com/patrickascher/gofw/cache/redis"
+	"github.com/stretchr/testify/assert"
+)
+
+// newRedis returns an in-process redis server and a cache provider which is connected to it.
+func newRedis(t *testing.T, prefix string) (*miniredis.Miniredis, cm.Interface) {
+	srv, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Close)
+	return srv, redis.New(redis.Options{Addr: srv.Addr(), Prefix: prefix})
+}
+
+func TestRedis_New(t *testing.T) {
+	srv, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	c, err := cm.New(cm.REDIS, redis.Options{Addr: srv.Addr()})
+	assert.NoError(t, err)
+	assert.NotNil(t, c)
+	assert.NoError(t, c.Set("foo", "bar", cm.INFINITY))
+	assert.True(t, c.Exist("foo"))
+}
+
+func TestRedis_SetGet(t *testing.T) {
+	srv, c := newRedis(t, "app:")
+
+	// ok
+	err := c.Set("foo", "bar", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.True(t, srv.Exists("app:foo"))
+
+	// ok: redefine
+	err = c.Set("foo", "BAR", cm.INFINITY)
+	assert.NoError(t, err)
+
+	// ok: different types
+	err = c.Set("int", 42, cm.INFINITY)
+	assert.NoError(t, err)
+	gob.Register(map[string]int{})
+	err = c.Set("map", map[string]int{"a": 1}, cm.INFINITY)
+	assert.NoError(t, err)
+
+	v, err := c.Get("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "BAR", v.Value())
+	v, err = c.Get("int")
+	assert.NoError(t, err)
+	assert.Equal(t, 42, v.Value())
+	v, err = c.Get("map")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"a": 1}, v.Value())
+
+	// error: type is not registered
+	err = c.Set("struct", struct{ A int }{A: 1}, cm.INFINITY)
+	assert.Error(t, err)
+
+	// error: key does not exist
+	v, err = c.Get("baz")
+	assert.Error(t, err)
+	assert.Equal(t, fmt.Sprintf(redis.ErrKeyNotExist.Error(), "baz"), err.Error())
+	assert.Nil(t, v)
+}
+
+func TestRedis_TTL(t *testing.T) {
+	srv, c := newRedis(t, "")
+
+	err := c.Set("ttl", "val", 500*time.Millisecond)
+	assert.NoError(t, err)
+	assert.True(t, c.Exist("ttl"))
+
+	srv.FastForward(time.Second)
+	assert.False(t, c.Exist("ttl"))
+}
+
+func TestRedis_GetAllPrefixed(t *testing.T) {
+	srv, c := newRedis(t, "app:")
+	// foreign key of another application
+	assert.NoError(t, srv.Set("other", "x"))
+
+	assert.NoError(t, c.Set("user:1", "John", cm.INFINITY))
+	assert.NoError(t, c.Set("user:2", "Jane", cm.INFINITY))
+	assert.NoError(t, c.Set("grid:*", "orders", cm.INFINITY))
+
+	v := c.GetAll()
+	assert.Equal(t, 3, len(v))
+	assert.Equal(t, "John", v["user:1"].Value())
+	assert.Equal(t, "orders", v["grid:*"].Value())
+
+	v = c.GetPrefixed("user:")
+	assert.Equal(t, 2, len(v))
+	assert.Equal(t, "Jane", v["user:2"].Value())
+
+	// glob characters are escaped
+	v = c.GetPrefixed("grid:*")
+	assert.Equal(t, 1, len(v))
+	v = c.GetPrefixed("u*")
+	assert.Equal(t, 0, len(v))
+}
+
+func TestRedis_Delete(t *testing.T) {
+	srv, c := newRedis(t, "app:")
+	assert.NoError(t, srv.Set("other", "x"))
+	assert.NoError(t, c.Set("user:1", "John", cm.INFINITY))
+	assert.NoError(t, c.Set("user:2", "Jane", cm.INFINITY))
+	assert.NoError(t, c.Set("grid", "orders", cm.INFINITY))
+
+	// ok
+	err := c.Delete("grid")
+	assert.NoError(t, err)
+	assert.False(t, c.Exist("grid"))
+
+	// error: key does not exist
+	err = c.Delete("grid")
+	assert.Error(t, err)
+	assert.Equal(t, fmt.Sprintf(redis.ErrKeyNotExist.Error(), "grid"), err.Error())
+
+	// ok: prefixed
+	err = c.DeletePrefixed("user:")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(c.GetAll()))
+
+	// ok: prefixed with no entries
+	err = c.DeletePrefixed("user:")
+	assert.NoError(t, err)
+
+	// ok: only the keys of the prefix are deleted
+	assert.NoError(t, c.Set("user:1", "John", cm.INFINITY))
+	err = c.DeleteAll()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(c.GetAll()))
+	assert.True(t, srv.Exists("other"))
+}
+
+func TestRedis_DeleteAll(t *testing.T) {
+	srv, c := newRedis(t, "")
+	assert.NoError(t, srv.Set("other", "x"))
+	assert.NoError(t, c.Set("foo", "bar", cm.INFINITY))
+
+	// ok: without a prefix the db is flushed
+	err := c.DeleteAll()
+	assert.NoError(t, err)
+	assert.False(t, srv.Exists("other"))
+	assert.Equal(t, 0, len(c.GetAll()))
+}
+
+func TestRedis_Connection(t *testing.T) {
+	srv, c := newRedis(t, "")
+	srv.Close()
+
+	// error: connection refused
+	err := c.Set("foo", "bar", cm.INFINITY)
+	assert.Error(t, err)
+	assert.False(t, c.Exist("foo"))
+	assert.Equal(t, 0, len(c.GetAll()))
+}
+
+func TestRedis_DeleteTagged(t *testing.T) {
+	srv, c := newRedis(t, "app:")
+	assert.NoError(t, c.Set("user:42", "John", cm.INFINITY, "user:42"))
+	assert.NoError(t, c.Set("orders:42", "[]", cm.INFINITY, "user:42", "grid:orders"))
+	assert.NoError(t, c.Set("orders:all", "[]", cm.INFINITY, "grid:orders"))
+	assert.NoError(t, c.Set("foo", "bar", cm.INFINITY))
+
+	// ok: tag sets are not returned
+	assert.Equal(t, 4, len(c.GetAll()))
+	assert.True(t, srv.Exists("app:__tag__:user:42"))
+
+	// ok
+	err := c.DeleteTagged("user:42")
+	assert.NoError(t, err)
+	assert.False(t, c.Exist("user:42"))
+	assert.False(t, c.Exist("orders:42"))
+	assert.True(t, c.Exist("orders:all"))
+	assert.False(t, srv.Exists("app:__tag__:user:42"))
+
+	// ok: unknown tag
+	err = c.DeleteTagged("unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(c.GetAll()))
+
+	// ok: multiple tags
+	err = c.DeleteTagged("grid:orders", "unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(c.GetAll()))
+
+	// ok: DeleteAll removes the tag sets
+	assert.NoError(t, c.Set("bar", "baz", cm.INFINITY, "bar"))
+	assert.NoError(t, c.DeletePrefixed("__tag__"))
+	assert.True(t, srv.Exists("app:__tag__:bar"))
+	assert.NoError(t, c.DeleteAll())
+	assert.False(t, srv.Exists("app:__tag__:bar"))
+}
+
+func TestRedis_DeleteTagged_Memberships(t *testing.T) {
+	srv, c := newRedis(t, "app:")
+
+	// ok: overwritten key loses the old tags
+	assert.NoError(t, c.Set("orders:42", "[]", cm.INFINITY, "user:42", "grid:orders"))
+	assert.NoError(t, c.Set("orders:42", "[1]", cm.INFINITY, "grid:orders"))
+	members, err := srv.Members("app:__tag__:grid:orders")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"app:orders:42"}, members)
+	assert.False(t, srv.Exists("app:__tag__:user:42"))
+	assert.NoError(t, c.DeleteTagged("user:42"))
+	assert.True(t, c.Exist("orders:42"))
+
+	// ok: overwritten key without tags
+	assert.NoError(t, c.Set("orders:42", "[2]", cm.INFINITY))
+	assert.False(t, srv.Exists("app:__tag__:grid:orders"))
+	assert.False(t, srv.Exists("app:__tags__:orders:42"))
+
+	// ok: deleted key loses the tags
+	assert.NoError(t, c.Set("user:42", "John", cm.INFINITY, "user:42"))
+	assert.NoError(t, c.Delete("user:42"))
+	assert.False(t, srv.Exists("app:__tag__:user:42"))
+	assert.NoError(t, c.Set("user:42", "John", cm.INFINITY, "user:42"))
+	assert.NoError(t, c.DeletePrefixed("user:"))
+	assert.False(t, srv.Exists("app:__tag__:user:42"))
+	assert.False(t, srv.Exists("app:__tags__:user:42"))
+
+	// ok: key which was added to the tag set by someone else is not deleted
+	assert.NoError(t, c.Set("foo", "bar", cm.INFINITY))
+	_, err = srv.SetAdd("app:__tag__:stale", "app:foo")
+	assert.NoError(t, err)
+	assert.NoError(t, c.DeleteTagged("stale"))
+	assert.True(t, c.Exist("foo"))
+	assert.False(t, srv.Exists("app:__tag__:stale"))
+}
+
+func TestRedis_GC(t *testing.T) {
+	srv, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer srv.Close()
+	c := redis.New(redis.Options{Addr: srv.Addr(), GCInterval: 10 * time.Millisecond})
+	go c.GC()
+	defer c.Close()
+
+	assert.NoError(t, c.Set("foo", "bar", time.Second, "tag"))
+	assert.NoError(t, c.Set("baz", "bar", cm.INFINITY, "tag"))
+	srv.FastForward(2 * time.Second)
+	assert.False(t, srv.Exists("__tags__:foo"))
+
+	// ok: expired keys are removed from the tag sets
+	time.Sleep(50 * time.Millisecond)
+	members, err := srv.Members("__tag__:tag")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"baz"}, members)
+}
+
+func TestRedis_Stats(t *testing.T) {
+	_, c := newRedis(t, "app:")
+	assert.NoError(t, c.Set("foo", "bar", cm.INFINITY, "tag"))
+	assert.NoError(t, c.Set("John", "Doe", cm.INFINITY))
+	_, _ = c.Get("foo")
+	_, _ = c.Get("baz")
+
+	assert.Equal(t, cm.Stats{Hits: 1, Misses: 1, Items: 2}, c.Stats())
+}
+
+func TestRedis_Increment(t *testing.T) {
+	srv, c := newRedis(t, "app:")
+
+	// ok: key is created
+	v, err := c.Increment("login:john", 1, time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), v)
+
+	// ok: ttl of the first increment is kept
+	v, err = c.Increment("login:john", 2, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), v)
+	assert.Equal(t, time.Second, srv.TTL("app:login:john"))
+	srv.FastForward(500 * time.Millisecond)
+	_, err = c.Increment("login:john", 0, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 500*time.Millisecond, srv.TTL("app:login:john"))
+	v, err = c.Decrement("login:john", 1, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), v)
+
+	// ok: expired keys are recreated
+	srv.FastForward(2 * time.Second)
+	v, err = c.Increment("login:john", 1, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), v)
+
+	// error: no integer
+	assert.NoError(t, c.Set("foo", "bar", cm.INFINITY))
+	_, err = c.Increment("foo", 1, cm.INFINITY)
+	assert.Error(t, err)
+	assert.Equal(t, fmt.Sprintf(cm.ErrNotInteger.Error(), "foo"), err.Error())
+
+	// ok: concurrent
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.Increment("counter", 1, cm.INFINITY)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	val, err := c.Get("counter")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(20), val.Value())
+}
+
+func TestRedis_SetIfNotExists(t *testing.T) {
+	srv, c := newRedis(t, "")
+
+	// ok
+	ok, err := c.SetIfNotExists("lock", "owner1", time.Second)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// ok: already exists
+	ok, err = c.SetIfNotExists("lock", "owner2", time.Second)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// ok: expired
+	srv.FastForward(2 * time.Second)
+	ok, err = c.SetIfNotExists("lock", "owner2", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	v, err := c.Get("lock")
+	assert.NoError(t, err)
+	assert.Equal(t, "owner2", v.Value())
+}
+
+func TestRedis_CompareAndSwap(t *testing.T) {
+	_, c := newRedis(t, "")
+
+	// ok: key does not exist
+	ok, err := c.CompareAndSwap("lock", "owner1", "owner2", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// ok: value does not match
+	assert.NoError(t, c.Set("lock", "owner1", cm.INFINITY))
+	ok, err = c.CompareAndSwap("lock", "owner2", "owner3", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// ok
+	ok, err = c.CompareAndSwap("lock", "owner1", "owner2", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	v, err := c.Get("lock")
+	assert.NoError(t, err)
+	assert.Equal(t, "owner2", v.Value())
+
+	// ok: the tags are kept
+	assert.NoError(t, c.Set("tagged", "a", cm.INFINITY, "locks"))
+	ok, err = c.CompareAndSwap("tagged", "a", "b", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.NoError(t, c.DeleteTagged("locks"))
+	assert.False(t, c.Exist("tagged"))
+}
+
+func TestRedis_Close(t *testing.T) {
+	_, c := newRedis(t, "")
+	assert.NoError(t, c.Set("foo", "bar", cm.INFINITY))
+
+	// ok: pool is closed
+	assert.NoError(t, c.Close())
+	assert.Error(t, c.Set("foo", "bar", cm.INFINITY))
+}
+
+func TestRedis_Codec(t *testing.T) {
+	srv, err := miniredis.Run()
+	assert.NoError(t, err)
+	defer srv.Close()
+
+	for _, codec := range []cm.Codec{cm.JSON, cm.Binary} {
+		c := redis.New(redis.Options{Addr: srv.Addr(), Codec: codec})
+		assert.NoError(t, c.Set("foo", map[string]string{"a": "b"}, cm.INFINITY))
+		v, err := c.Get("foo")
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]string{"a": "b"}, v.Value())
+
+		// ok: atomic operations
+		i, err := c.Increment("counter", 2, cm.INFINITY)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), i)
+		assert.NoError(t, c.DeleteAll())
+
+		// error: type is not registered
+		assert.Error(t, c.Set("struct", struct{ A int }{A: 1}, cm.INFINITY))
+	}
+}
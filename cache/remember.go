@@ -0,0 +1,79 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// Loader is a function which returns the value of a cache key.
+type Loader func() (interface{}, error)
+
+// flight key, identified by the cache instance and key.
+type flightKey struct {
+	cache Interface
+	key   string
+}
+
+// flight is a running loader call.
+type flight struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// flights holds all running loader calls.
+var flights = struct {
+	sync.Mutex
+	calls map[flightKey]*flight
+}{calls: make(map[flightKey]*flight)}
+
+// Remember returns the value of the given key.
+// If the key does not exist, the loader is called and its value is set with the given ttl.
+//
+// Concurrent misses for the same cache instance and key are only running the loader once,
+// the other calls are waiting and receive the same value or error.
+// Errors of the loader are returned but not cached, the next call will run the loader again.
+// If the value could not be set, the loaded value and the error of the provider will return.
+func Remember(c Interface, key string, ttl time.Duration, loader Loader) (interface{}, error) {
+	if v, err := c.Get(key); err == nil {
+		return v.Value(), nil
+	}
+
+	fk := flightKey{cache: c, key: key}
+
+	flights.Lock()
+	if f, ok := flights.calls[fk]; ok {
+		flights.Unlock()
+		f.wg.Wait()
+		return f.val, f.err
+	}
+	f := &flight{}
+	f.wg.Add(1)
+	flights.calls[fk] = f
+	flights.Unlock()
+
+	defer func() {
+		flights.Lock()
+		delete(flights.calls, fk)
+		flights.Unlock()
+		f.wg.Done()
+	}()
+
+	// the value could be set in the meantime by a finished flight.
+	if v, err := c.Get(key); err == nil {
+		f.val = v.Value()
+		return f.val, nil
+	}
+
+	f.val, f.err = loader()
+	if f.err != nil {
+		return f.val, f.err
+	}
+
+	f.err = c.Set(key, f.val, ttl)
+	return f.val, f.err
+}
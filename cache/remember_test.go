@@ -0,0 +1,87 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cache_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cm "github.com/patrickascher/gofw/cache"
+	"github.com/patrickascher/gofw/cache/memory"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemember(t *testing.T) {
+	test := assert.New(t)
+	c := memory.New(nil)
+
+	// ok: loader is called on a miss
+	calls := 0
+	loader := func() (interface{}, error) {
+		calls++
+		return "bar", nil
+	}
+	v, err := cm.Remember(c, "foo", cm.INFINITY, loader)
+	test.NoError(err)
+	test.Equal("bar", v)
+	test.Equal(1, calls)
+	test.True(c.Exist("foo"))
+
+	// ok: value is cached
+	v, err = cm.Remember(c, "foo", cm.INFINITY, loader)
+	test.NoError(err)
+	test.Equal("bar", v)
+	test.Equal(1, calls)
+
+	// error: loader errors are not cached
+	v, err = cm.Remember(c, "err", cm.INFINITY, func() (interface{}, error) {
+		return nil, errors.New("loader failed")
+	})
+	test.Error(err)
+	test.Nil(v)
+	test.False(c.Exist("err"))
+	v, err = cm.Remember(c, "err", cm.INFINITY, loader)
+	test.NoError(err)
+	test.Equal("bar", v)
+	test.Equal(2, calls)
+}
+
+func TestRemember_Concurrent(t *testing.T) {
+	test := assert.New(t)
+	c := memory.New(nil)
+
+	var calls int32
+	loader := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(50 * time.Millisecond)
+		return 42, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, 50)
+	for i := 0; i < len(results); i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err := cm.Remember(c, "answer", cm.INFINITY, loader)
+			test.NoError(err)
+			results[i] = v
+		}(i)
+	}
+	wg.Wait()
+
+	test.Equal(int32(1), atomic.LoadInt32(&calls))
+	for _, v := range results {
+		test.Equal(42, v)
+	}
+
+	// ok: different cache instances are not sharing a flight.
+	_, err := cm.Remember(memory.New(nil), "answer", cm.INFINITY, loader)
+	test.NoError(err)
+	test.Equal(int32(2), atomic.LoadInt32(&calls))
+}
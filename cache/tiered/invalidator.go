@@ -0,0 +1,78 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tiered
+
+import "sync"
+
+// Invalidator is used to notify the other nodes about changed keys, so they can evict their local copies.
+// The messages are encoded by the tiered provider, the invalidator only has to transport them.
+// A redis implementation is available in the cache/redis package (redis.NewPubSub).
+type Invalidator interface {
+	// Publish sends the message to all subscribers.
+	Publish(msg []byte) error
+	// Subscribe registers a function which is called for every published message.
+	// The returned function removes the subscription, it can be called multiple times.
+	Subscribe(fn func(msg []byte)) (unsubscribe func())
+	// Close ends all subscriptions.
+	Close() error
+}
+
+// Channel is an in-process Invalidator.
+// It can be used if multiple tiered caches are running in the same process, or for testing.
+type Channel struct {
+	mutex       sync.RWMutex
+	subscribers []*subscriber
+}
+
+// subscriber of the channel.
+type subscriber struct {
+	fn func([]byte)
+}
+
+// NewChannel creates a new in-process channel.
+func NewChannel() *Channel {
+	return &Channel{}
+}
+
+// Publish calls all subscribers synchronously.
+func (c *Channel) Publish(msg []byte) error {
+	c.mutex.RLock()
+	subscribers := make([]*subscriber, len(c.subscribers))
+	copy(subscribers, c.subscribers)
+	c.mutex.RUnlock()
+
+	for _, sub := range subscribers {
+		sub.fn(msg)
+	}
+	return nil
+}
+
+// Subscribe adds the function to the subscribers.
+// The returned function removes it again.
+func (c *Channel) Subscribe(fn func(msg []byte)) func() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	sub := &subscriber{fn: fn}
+	c.subscribers = append(c.subscribers, sub)
+
+	return func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		for i, s := range c.subscribers {
+			if s == sub {
+				c.subscribers = append(c.subscribers[:i:i], c.subscribers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Close removes all subscribers.
+func (c *Channel) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.subscribers = nil
+	return nil
+}
@@ -0,0 +1,393 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package tiered implements the cache.Interface and registers a two-tier provider.
+// A local in-memory cache is layered in front of a remote cache (redis, db, ...), which is shared by all nodes.
+//
+// Reads are served by the local cache. On a local miss the remote cache is asked and the value is copied into the local cache.
+// Writes and deletes are going through both layers. The other nodes are notified by the Invalidator, so they evict their local copies.
+// Local copies are only living for Options.LocalTTL, which limits the staleness if an invalidation message gets lost.
+//
+// Atomic operations (Increment, SetIfNotExists, CompareAndSwap) are executed on the remote cache and the local copy gets invalidated.
+// GetAll and GetPrefixed are always served by the remote cache.
+//
+// Check the tiered.Options for the available configurations.
+package tiered
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	cm "github.com/patrickascher/gofw/cache"
+	"github.com/patrickascher/gofw/cache/memory"
+)
+
+// init register the tiered provider.
+func init() {
+	_ = cm.Register(cm.TIERED, New)
+}
+
+// defaultLocalTTL is the maximum lifetime of a local copy.
+var defaultLocalTTL = time.Minute
+
+// unknownTag is added to local copies which were loaded from the remote cache.
+// Their tags are unknown, so they are evicted on every tag invalidation.
+const unknownTag = "__tiered_unknown__"
+
+// invalidation operations.
+const (
+	opKey    = "key"
+	opPrefix = "prefix"
+	opTag    = "tag"
+	opAll    = "all"
+)
+
+// Error messages
+var (
+	ErrRemote = errors.New("cache/tiered: remote cache is not defined")
+)
+
+// tiered cache provider
+type tiered struct {
+	options Options
+	local   cm.Interface
+	node    string
+	hits    uint64
+	misses  uint64
+	// unsubscribe removes the subscription of the invalidator.
+	unsubscribe func()
+}
+
+// Options for the tiered provider.
+type Options struct {
+	// Remote cache which is shared by all nodes. It is mandatory.
+	// The remote cache should be created by cache.New, so that its garbage collector is running.
+	// It is owned by the caller and not closed by the tiered cache.
+	Remote cm.Interface
+	// Local options of the in-memory cache.
+	Local memory.Options
+	// LocalTTL is the maximum lifetime of a local copy. Default is 1 minute.
+	LocalTTL time.Duration
+	// Invalidator is used to notify the other nodes.
+	// If it is nil, the local copies of the other nodes are only expiring by the LocalTTL.
+	// It is owned by the caller and not closed by the tiered cache, unless CloseInvalidator is set.
+	Invalidator Invalidator
+	// CloseInvalidator closes the invalidator on Close. It should only be set if the invalidator is not shared.
+	CloseInvalidator bool
+}
+
+// localItem is the value of a local copy.
+// The expiration is checked on Get, because the in-memory cache only removes expired items by the garbage collector.
+type localItem struct {
+	val     interface{}
+	expires time.Time
+}
+
+// Value returns the value of the item.
+func (i *localItem) Value() interface{} {
+	return i.val
+}
+
+// message is the json encoded invalidation message.
+type message struct {
+	Node string   `json:"node"`
+	Op   string   `json:"op"`
+	Keys []string `json:"keys,omitempty"`
+}
+
+// New creates a tiered cache by the given options.
+func New(opt interface{}) cm.Interface {
+	options := Options{}
+	if opt != nil {
+		options = opt.(Options)
+	}
+	if options.LocalTTL <= 0 {
+		options.LocalTTL = defaultLocalTTL
+	}
+
+	t := &tiered{options: options, local: memory.New(options.Local), node: nodeID()}
+	if options.Invalidator != nil {
+		t.unsubscribe = options.Invalidator.Subscribe(t.receive)
+	}
+	return t
+}
+
+// Get returns the value of the given key.
+// If the key does not exist locally, the value of the remote cache is copied into the local cache.
+// Error will return if the key does not exist.
+func (t *tiered) Get(key string) (cm.Valuer, error) {
+	if v, ok := t.localGet(key); ok {
+		atomic.AddUint64(&t.hits, 1)
+		return v, nil
+	}
+	if t.options.Remote == nil {
+		return nil, ErrRemote
+	}
+
+	v, err := t.options.Remote.Get(key)
+	if err != nil {
+		atomic.AddUint64(&t.misses, 1)
+		return nil, err
+	}
+	atomic.AddUint64(&t.hits, 1)
+
+	_ = t.local.Set(key, t.localItem(v.Value(), cm.INFINITY), t.localTTL(cm.INFINITY), unknownTag)
+	return v, nil
+}
+
+// GetPrefixed returns all items of the remote cache with the given prefix.
+func (t *tiered) GetPrefixed(prefix string) map[string]cm.Valuer {
+	if t.options.Remote == nil {
+		return make(map[string]cm.Valuer)
+	}
+	return t.options.Remote.GetPrefixed(prefix)
+}
+
+// GetAll returns all items of the remote cache.
+func (t *tiered) GetAll() map[string]cm.Valuer {
+	return t.GetPrefixed("")
+}
+
+// Set key/value pair in the remote and local cache.
+// The local copy lives for the ttl, but max. Options.LocalTTL.
+// The other nodes are notified.
+func (t *tiered) Set(key string, value interface{}, ttl time.Duration, tags ...string) error {
+	if t.options.Remote == nil {
+		return ErrRemote
+	}
+
+	err := t.options.Remote.Set(key, value, ttl, tags...)
+	if err != nil {
+		return err
+	}
+	err = t.local.Set(key, t.localItem(value, ttl), t.localTTL(ttl), tags...)
+	if err != nil {
+		// the old local copy must not survive.
+		_ = t.local.Delete(key)
+	}
+	return t.publish(opKey, key)
+}
+
+// Exist returns true if the key exists locally or in the remote cache.
+func (t *tiered) Exist(key string) bool {
+	if _, ok := t.localGet(key); ok {
+		return true
+	}
+	return t.options.Remote != nil && t.options.Remote.Exist(key)
+}
+
+// Delete removes a given key from the remote and local cache.
+// The other nodes are notified.
+// Error will return if the key does not exist in the remote cache.
+func (t *tiered) Delete(key string) error {
+	if t.options.Remote == nil {
+		return ErrRemote
+	}
+	err := t.options.Remote.Delete(key)
+	return t.notify(err, opKey, key)
+}
+
+// DeleteAll removes all items from the remote and local cache.
+// The other nodes are notified.
+func (t *tiered) DeleteAll() error {
+	if t.options.Remote == nil {
+		return ErrRemote
+	}
+	err := t.options.Remote.DeleteAll()
+	return t.notify(err, opAll)
+}
+
+// DeletePrefixed removes all items with the given prefix from the remote and local cache.
+// The other nodes are notified.
+func (t *tiered) DeletePrefixed(prefix string) error {
+	if t.options.Remote == nil {
+		return ErrRemote
+	}
+	err := t.options.Remote.DeletePrefixed(prefix)
+	return t.notify(err, opPrefix, prefix)
+}
+
+// DeleteTagged removes all items with one of the given tags from the remote and local cache.
+// Local copies which were loaded from the remote cache are also removed, because their tags are unknown.
+// The other nodes are notified.
+func (t *tiered) DeleteTagged(tags ...string) error {
+	if t.options.Remote == nil {
+		return ErrRemote
+	}
+	err := t.options.Remote.DeleteTagged(tags...)
+	return t.notify(err, opTag, tags...)
+}
+
+// Increment the integer value of the key in the remote cache.
+// The local copy is invalidated and the other nodes are notified.
+func (t *tiered) Increment(key string, delta int64, ttl time.Duration) (int64, error) {
+	if t.options.Remote == nil {
+		return 0, ErrRemote
+	}
+	v, err := t.options.Remote.Increment(key, delta, ttl)
+	if err != nil {
+		return 0, err
+	}
+	return v, t.notify(nil, opKey, key)
+}
+
+// Decrement the integer value of the key in the remote cache.
+// See Increment for more details.
+func (t *tiered) Decrement(key string, delta int64, ttl time.Duration) (int64, error) {
+	return t.Increment(key, -delta, ttl)
+}
+
+// SetIfNotExists sets the value in the remote cache only if the key does not exist.
+// If the value was set, the local copy is invalidated and the other nodes are notified.
+func (t *tiered) SetIfNotExists(key string, value interface{}, ttl time.Duration) (bool, error) {
+	if t.options.Remote == nil {
+		return false, ErrRemote
+	}
+	ok, err := t.options.Remote.SetIfNotExists(key, value, ttl)
+	if err != nil || !ok {
+		return ok, err
+	}
+	return ok, t.notify(nil, opKey, key)
+}
+
+// CompareAndSwap sets the new value in the remote cache only if the current value is equal to old.
+// If the value was swapped, the local copy is invalidated and the other nodes are notified.
+func (t *tiered) CompareAndSwap(key string, old interface{}, new interface{}, ttl time.Duration) (bool, error) {
+	if t.options.Remote == nil {
+		return false, ErrRemote
+	}
+	ok, err := t.options.Remote.CompareAndSwap(key, old, new, ttl)
+	if err != nil || !ok {
+		return ok, err
+	}
+	return ok, t.notify(nil, opKey, key)
+}
+
+// Stats returns the hits and misses of this instance, a hit can be served by the local or remote cache.
+// Evictions and expirations are the ones of the local cache, Items and Size the ones of the remote cache.
+func (t *tiered) Stats() cm.Stats {
+	local := t.local.Stats()
+	rv := cm.Stats{
+		Hits:        atomic.LoadUint64(&t.hits),
+		Misses:      atomic.LoadUint64(&t.misses),
+		Evictions:   local.Evictions,
+		Expirations: local.Expirations,
+	}
+	if t.options.Remote != nil {
+		remote := t.options.Remote.Stats()
+		rv.Items = remote.Items
+		rv.Size = remote.Size
+	}
+	return rv
+}
+
+// GC runs the garbage collector of the local cache.
+// The garbage collector of the remote cache is not started.
+func (t *tiered) GC() {
+	t.local.GC()
+}
+
+// Close stops the garbage collector of the local cache, removes the local copies and the subscription of the invalidator.
+// The remote cache is not closed, because it can be shared. The invalidator is only closed if Options.CloseInvalidator is set.
+func (t *tiered) Close() error {
+	if t.unsubscribe != nil {
+		t.unsubscribe()
+	}
+	err := t.local.Close()
+	if t.options.CloseInvalidator && t.options.Invalidator != nil {
+		if iErr := t.options.Invalidator.Close(); err == nil {
+			err = iErr
+		}
+	}
+	return err
+}
+
+// localGet returns the local copy if it exists and is not expired.
+func (t *tiered) localGet(key string) (cm.Valuer, bool) {
+	v, err := t.local.Get(key)
+	if err != nil {
+		return nil, false
+	}
+	i, ok := v.Value().(*localItem)
+	if !ok || time.Now().After(i.expires) {
+		return nil, false
+	}
+	return i, true
+}
+
+// localItem returns the local copy of the value.
+func (t *tiered) localItem(value interface{}, ttl time.Duration) *localItem {
+	return &localItem{val: value, expires: time.Now().Add(t.localTTL(ttl))}
+}
+
+// localTTL returns the ttl of a local copy, which is max. Options.LocalTTL.
+func (t *tiered) localTTL(ttl time.Duration) time.Duration {
+	if ttl == cm.INFINITY || ttl > t.options.LocalTTL {
+		return t.options.LocalTTL
+	}
+	return ttl
+}
+
+// notify invalidates the local copies and notifies the other nodes.
+// The given error of the remote operation has priority.
+func (t *tiered) notify(err error, op string, keys ...string) error {
+	t.invalidate(op, keys)
+	if pErr := t.publish(op, keys...); err == nil {
+		err = pErr
+	}
+	return err
+}
+
+// publish sends an invalidation message to the other nodes.
+func (t *tiered) publish(op string, keys ...string) error {
+	if t.options.Invalidator == nil {
+		return nil
+	}
+	b, err := json.Marshal(message{Node: t.node, Op: op, Keys: keys})
+	if err != nil {
+		return err
+	}
+	return t.options.Invalidator.Publish(b)
+}
+
+// receive is called by the Invalidator.
+// Messages of the own node and unknown messages are ignored.
+func (t *tiered) receive(b []byte) {
+	msg := message{}
+	if err := json.Unmarshal(b, &msg); err != nil || msg.Node == t.node {
+		return
+	}
+	t.invalidate(msg.Op, msg.Keys)
+}
+
+// invalidate removes the local copies.
+func (t *tiered) invalidate(op string, keys []string) {
+	switch op {
+	case opKey:
+		for _, key := range keys {
+			_ = t.local.Delete(key)
+		}
+	case opPrefix:
+		for _, prefix := range keys {
+			_ = t.local.DeletePrefixed(prefix)
+		}
+	case opTag:
+		tags := make([]string, len(keys), len(keys)+1)
+		copy(tags, keys)
+		_ = t.local.DeleteTagged(append(tags, unknownTag)...)
+	case opAll:
+		_ = t.local.DeleteAll()
+	}
+}
+
+// nodeID returns a random id, which is used to identify the own invalidation messages.
+func nodeID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
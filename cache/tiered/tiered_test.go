@@ -0,0 +1,238 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package tiered_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	cm "github.com/patrickascher/gofw/cache"
+	"github.com/patrickascher/gofw/cache/memory"
+	"github.com/patrickascher/gofw/cache/tiered"
+	"github.com/stretchr/testify/assert"
+)
+
+// countInvalidator counts the active subscriptions and the close calls of the channel.
+type countInvalidator struct {
+	*tiered.Channel
+	n      int32
+	closed int32
+}
+
+// Close implements the tiered.Invalidator interface.
+func (c *countInvalidator) Close() error {
+	atomic.AddInt32(&c.closed, 1)
+	return c.Channel.Close()
+}
+
+// Subscribe implements the tiered.Invalidator interface.
+func (c *countInvalidator) Subscribe(fn func(msg []byte)) func() {
+	atomic.AddInt32(&c.n, 1)
+	unsubscribe := c.Channel.Subscribe(fn)
+	return func() {
+		unsubscribe()
+		atomic.AddInt32(&c.n, -1)
+	}
+}
+
+// newNodes returns two tiered caches which are sharing the remote cache and invalidator.
+func newNodes(localTTL time.Duration) (cm.Interface, cm.Interface, cm.Interface) {
+	remote := memory.New(nil)
+	ch := tiered.NewChannel()
+	a := tiered.New(tiered.Options{Remote: remote, LocalTTL: localTTL, Invalidator: ch})
+	b := tiered.New(tiered.Options{Remote: remote, LocalTTL: localTTL, Invalidator: ch})
+	return remote, a, b
+}
+
+func TestTiered_New(t *testing.T) {
+	c, err := cm.New(cm.TIERED, tiered.Options{Remote: memory.New(nil)})
+	assert.NoError(t, err)
+	assert.NoError(t, c.Set("foo", "bar", cm.INFINITY))
+	assert.True(t, c.Exist("foo"))
+
+	// error: no remote cache
+	c, err = cm.New(cm.TIERED, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, tiered.ErrRemote, c.Set("foo", "bar", cm.INFINITY))
+	_, err = c.Get("foo")
+	assert.Equal(t, tiered.ErrRemote, err)
+}
+
+func TestTiered_SetGet(t *testing.T) {
+	remote, a, b := newNodes(time.Minute)
+
+	// ok: write through
+	assert.NoError(t, a.Set("foo", "bar", cm.INFINITY))
+	v, err := remote.Get("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", v.Value())
+
+	// ok: local copy is served, even if the remote cache was changed directly.
+	assert.NoError(t, remote.Set("foo", "remote", cm.INFINITY))
+	v, err = a.Get("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "bar", v.Value())
+
+	// ok: b loads the value from the remote cache.
+	v, err = b.Get("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "remote", v.Value())
+
+	// ok: b invalidates the local copy of a.
+	assert.NoError(t, b.Set("foo", "b", cm.INFINITY))
+	v, err = a.Get("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "b", v.Value())
+
+	// error: key does not exist
+	_, err = a.Get("none")
+	assert.Error(t, err)
+
+	assert.Equal(t, cm.Stats{Hits: 2, Misses: 1, Items: 1}, a.Stats())
+	assert.Equal(t, cm.Stats{Hits: 1, Items: 1}, b.Stats())
+}
+
+func TestTiered_LocalTTL(t *testing.T) {
+	remote, a, _ := newNodes(10 * time.Millisecond)
+
+	assert.NoError(t, a.Set("foo", "bar", cm.INFINITY))
+	assert.NoError(t, remote.Set("foo", "remote", cm.INFINITY))
+
+	// ok: local copy is expired
+	time.Sleep(20 * time.Millisecond)
+	v, err := a.Get("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "remote", v.Value())
+}
+
+func TestTiered_Delete(t *testing.T) {
+	remote, a, b := newNodes(time.Minute)
+
+	assert.NoError(t, a.Set("user:1", 1, cm.INFINITY))
+	assert.NoError(t, a.Set("user:2", 2, cm.INFINITY, "t1"))
+	assert.NoError(t, a.Set("foo", "bar", cm.INFINITY))
+	// local copies of b
+	for _, key := range []string{"user:1", "user:2", "foo"} {
+		_, err := b.Get(key)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 3, len(b.GetAll()))
+	assert.Equal(t, 2, len(b.GetPrefixed("user:")))
+
+	// ok: delete
+	assert.NoError(t, a.Delete("foo"))
+	assert.False(t, remote.Exist("foo"))
+	assert.False(t, a.Exist("foo"))
+	assert.False(t, b.Exist("foo"))
+
+	// error: key does not exist
+	assert.Error(t, a.Delete("foo"))
+
+	// ok: tagged, b has loaded the item without tags.
+	assert.NoError(t, a.DeleteTagged("t1"))
+	assert.False(t, b.Exist("user:2"))
+	assert.True(t, b.Exist("user:1"))
+
+	// ok: prefixed
+	assert.NoError(t, a.DeletePrefixed("user:"))
+	assert.False(t, b.Exist("user:1"))
+
+	// ok: all
+	assert.NoError(t, b.Set("foo", "bar", cm.INFINITY))
+	_, err := a.Get("foo")
+	assert.NoError(t, err)
+	assert.NoError(t, b.DeleteAll())
+	assert.False(t, a.Exist("foo"))
+	assert.Equal(t, 0, len(remote.GetAll()))
+}
+
+func TestTiered_Atomic(t *testing.T) {
+	_, a, b := newNodes(time.Minute)
+
+	// increment
+	v, err := a.Increment("counter", 2, cm.INFINITY)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), v)
+	val, err := b.Get("counter")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), val.Value())
+	v, err = a.Decrement("counter", 1, cm.INFINITY)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), v)
+	val, err = b.Get("counter")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), val.Value())
+
+	// set if not exists
+	ok, err := a.SetIfNotExists("lock", "a", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = b.SetIfNotExists("lock", "b", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// compare and swap
+	val, err = b.Get("lock")
+	assert.NoError(t, err)
+	assert.Equal(t, "a", val.Value())
+	ok, err = a.CompareAndSwap("lock", "a", "c", cm.INFINITY)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	val, err = b.Get("lock")
+	assert.NoError(t, err)
+	assert.Equal(t, "c", val.Value())
+}
+
+func TestTiered_Close(t *testing.T) {
+	remote, a, b := newNodes(time.Minute)
+	assert.NoError(t, a.Set("foo", "bar", cm.INFINITY))
+
+	// ok: the local cache is closed, remote and invalidator are still usable.
+	assert.NoError(t, a.Close())
+	assert.True(t, remote.Exist("foo"))
+	assert.NoError(t, b.Set("foo", "baz", cm.INFINITY))
+	v, err := remote.Get("foo")
+	assert.NoError(t, err)
+	assert.Equal(t, "baz", v.Value())
+}
+
+func TestTiered_Unsubscribe(t *testing.T) {
+	ch := &countInvalidator{Channel: tiered.NewChannel()}
+	c := tiered.New(tiered.Options{Remote: memory.New(nil), Invalidator: ch})
+	assert.Equal(t, int32(1), atomic.LoadInt32(&ch.n))
+
+	// ok: the subscription is removed on close, the invalidator is not closed
+	assert.NoError(t, c.Close())
+	assert.Equal(t, int32(0), atomic.LoadInt32(&ch.n))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&ch.closed))
+
+	// ok: the invalidator is owned by the tiered cache
+	c = tiered.New(tiered.Options{Remote: memory.New(nil), Invalidator: ch, CloseInvalidator: true})
+	assert.NoError(t, c.Close())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&ch.closed))
+
+	// ok: the tags of the caller are not modified
+	c = tiered.New(tiered.Options{Remote: memory.New(nil)})
+	backing := make([]string, 2)
+	backing[0] = "tag"
+	assert.NoError(t, c.DeleteTagged(backing[:1]...))
+	assert.Equal(t, "", backing[1])
+}
+
+func TestChannel_Subscribe(t *testing.T) {
+	ch := tiered.NewChannel()
+	var a, b int32
+	unsubscribe := ch.Subscribe(func([]byte) { atomic.AddInt32(&a, 1) })
+	ch.Subscribe(func([]byte) { atomic.AddInt32(&b, 1) })
+	assert.NoError(t, ch.Publish([]byte("foo")))
+
+	// ok: unsubscribe can be called multiple times
+	unsubscribe()
+	unsubscribe()
+	assert.NoError(t, ch.Publish([]byte("foo")))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&a))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&b))
+}
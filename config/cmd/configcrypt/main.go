@@ -0,0 +1,160 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Command configcrypt encrypts config values and re-encrypts config files on a key rotation.
+//
+// The key is read from the environment variable CONFIG_KEY or the key file of CONFIG_KEY_FILE.
+//
+//	configcrypt keygen                              // prints a new key
+//	configcrypt encrypt < secret.txt                // prints enc:..., the value is read from stdin
+//	configcrypt rotate -new-key-file new.key a.json // re-encrypts all values of the files with the new key
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/patrickascher/gofw/config"
+)
+
+const usage = `usage:
+  configcrypt keygen
+  configcrypt encrypt            (the value is read from stdin)
+  configcrypt rotate (-new-key <key> | -new-key-file <file>) <file>...
+
+The key is read from the environment variable CONFIG_KEY or the file of CONFIG_KEY_FILE.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "keygen":
+		err = keygen()
+	case "encrypt":
+		err = encrypt(os.Args[2:])
+	case "rotate":
+		err = rotate(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// keygen prints a new key.
+func keygen() error {
+	key, err := config.GenerateKey()
+	if err != nil {
+		return err
+	}
+	fmt.Println(key)
+	return nil
+}
+
+// encrypt prints the encrypted value.
+// The value is read from stdin, like this it does not end up in the shell history or the process list.
+// If stdin is a terminal, a prompt is printed. One trailing line break is removed.
+func encrypt(args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("configcrypt: encrypt reads the value from stdin, arguments are not allowed")
+	}
+	key, err := config.Key()
+	if err != nil {
+		return err
+	}
+
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, "value (end with ctrl-d): ")
+	}
+	b, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	value := strings.TrimSuffix(strings.TrimSuffix(string(b), "\n"), "\r")
+	if value == "" {
+		return fmt.Errorf("configcrypt: value is empty")
+	}
+
+	enc, err := config.Encrypt(value, key)
+	if err != nil {
+		return err
+	}
+	fmt.Println(enc)
+	return nil
+}
+
+// rotate re-encrypts the files with the new key.
+// All files are checked first, so that no file is changed if one value can not be decrypted.
+func rotate(args []string) error {
+	fs := flag.NewFlagSet("rotate", flag.ExitOnError)
+	newKey := fs.String("new-key", "", "base64 encoded new key")
+	newKeyFile := fs.String("new-key-file", "", "file of the base64 encoded new key")
+	_ = fs.Parse(args)
+	if fs.NArg() == 0 {
+		return fmt.Errorf("configcrypt: rotate requires at least one file")
+	}
+
+	oldKey, err := config.Key()
+	if err != nil {
+		return err
+	}
+
+	k := *newKey
+	if *newKeyFile != "" {
+		b, err := ioutil.ReadFile(*newKeyFile)
+		if err != nil {
+			return err
+		}
+		k = string(b)
+	}
+	if k == "" {
+		return fmt.Errorf("configcrypt: -new-key or -new-key-file is required")
+	}
+	key, err := config.ParseKey(k)
+	if err != nil {
+		return err
+	}
+
+	type result struct {
+		content []byte
+		mode    os.FileMode
+		n       int
+	}
+	results := make([]result, fs.NArg())
+	for i, f := range fs.Args() {
+		info, err := os.Stat(f)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		results[i].content, results[i].n, err = config.Reencrypt(b, oldKey, key)
+		if err != nil {
+			return fmt.Errorf("configcrypt: %v: %v", f, err)
+		}
+		results[i].mode = info.Mode()
+	}
+
+	for i, f := range fs.Args() {
+		if err = ioutil.WriteFile(f, results[i].content, results[i].mode); err != nil {
+			return err
+		}
+		fmt.Printf("%s: %d values re-encrypted\n", f, results[i].n)
+	}
+	return nil
+}
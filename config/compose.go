@@ -0,0 +1,190 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/go-playground/validator"
+	"github.com/patrickascher/gofw/callback"
+)
+
+// Source is a layer of the composed configuration.
+type Source struct {
+	// Name is recorded for the fields which were set by this source. Default is the provider name.
+	Name string
+	// Provider is the name of a registered config provider.
+	Provider string
+	// Options are passed to the provider.
+	Options interface{}
+	// Env is passed to the provider.
+	// File providers are only merging the environment file if it is set (e.g. config.Env()).
+	Env string
+}
+
+// Sources holds the name of the source which has set the field, by the field path (e.g. Server.HTTPPort, Databases[0].Host).
+type Sources map[string]string
+
+// String returns the sources sorted by the field path, one field per line.
+func (s Sources) String() string {
+	paths := make([]string, 0, len(s))
+	for p := range s {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var b strings.Builder
+	for _, p := range paths {
+		b.WriteString(fmt.Sprintf("%s = %s\n", p, s[p]))
+	}
+	return b.String()
+}
+
+// Compose parses the config struct by all given sources, each source overrides the ones before.
+// Callbacks, references and the validation are handled like in New, but the environment variables are only set if the ENVIRONMENT source is added.
+//
+// The source is recorded for every field which was changed by a source. A field which is set to the same value again keeps its source.
+// Error will return if a provider is not registered, a provider returns an error or the validation fails.
+//
+//	sources, err := config.Compose(&cfg,
+//		config.Source{Provider: config.DEFAULTS},
+//		config.Source{Provider: config.JSON, Options: json.Options{Filepath: "conf.json"}},
+//		config.Source{Name: "json:" + config.Env(), Provider: config.JSON, Options: json.Options{Filepath: "conf.json"}, Env: config.Env()},
+//		config.Source{Provider: config.ENVIRONMENT},
+//		config.Source{Provider: config.FLAGS},
+//	)
+func Compose(config interface{}, sources ...Source) (Sources, error) {
+	if reflect.ValueOf(config).Kind() != reflect.Ptr {
+		return nil, ErrConfigPtr
+	}
+
+	instances := make([]Interface, len(sources))
+	for i, s := range sources {
+		instanceFn, ok := registry[s.Provider]
+		if !ok {
+			return nil, fmt.Errorf(ErrUnknownProvider.Error(), s.Provider)
+		}
+		instances[i] = instanceFn()
+	}
+
+	err := callback.StructMethod(CallbackBeforeParse, config)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make(Sources)
+	before := snapshot(config)
+	for i, s := range sources {
+		err = instances[i].Parse(config, s.Env, s.Options)
+		if err != nil {
+			return rv, err
+		}
+
+		name := s.Name
+		if name == "" {
+			name = s.Provider
+		}
+		after := snapshot(config)
+		for path, val := range after {
+			if prev, ok := before[path]; !ok || prev != val {
+				rv[path] = name
+			}
+		}
+		before = after
+	}
+
+	err = resolve(config)
+	if err != nil {
+		return rv, err
+	}
+
+	err = valid(config)
+	if err != nil {
+		return rv, err
+	}
+
+	load(config, instances...)
+	return rv, nil
+}
+
+// Validate runs the same validation and callbacks as New.
+// It can be used by providers which are writing a config back (e.g. config/db).
+func Validate(config interface{}) error {
+	return valid(config)
+}
+
+// valid calls the validation and the callbacks BeforeValid, AfterValid and AfterParse.
+func valid(config interface{}) error {
+	err := callback.StructMethod(CallbackBeforeValid, config)
+	if err != nil {
+		return err
+	}
+
+	validate := validator.New()
+	err = validate.Struct(config)
+	if err != nil {
+		return err
+	}
+
+	err = callback.StructMethod(CallbackAfterValid, config)
+	if err != nil {
+		return err
+	}
+
+	return callback.StructMethod(CallbackAfterParse, config)
+}
+
+// snapshot returns the json encoded value of every field by its path.
+func snapshot(config interface{}) map[string]string {
+	rv := make(map[string]string)
+	snapshotValue(reflect.ValueOf(config), "", rv)
+	return rv
+}
+
+// snapshotValue adds the value to the snapshot. Structs, pointers and slices of structs are added recursively.
+func snapshotValue(v reflect.Value, path string, rv map[string]string) {
+	if !isText(v) {
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface:
+			if !v.IsNil() {
+				snapshotValue(v.Elem(), path, rv)
+				return
+			}
+		case reflect.Struct:
+			t := v.Type()
+			for i := 0; i < t.NumField(); i++ {
+				f := t.Field(i)
+				if f.PkgPath != "" {
+					continue
+				}
+				p := path
+				// promoted fields of embedded structs.
+				if !f.Anonymous {
+					p = strings.TrimPrefix(path+"."+f.Name, ".")
+				}
+				snapshotValue(v.Field(i), p, rv)
+			}
+			return
+		case reflect.Slice, reflect.Array:
+			if isNested(v.Type().Elem()) {
+				for i := 0; i < v.Len(); i++ {
+					snapshotValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), rv)
+				}
+				return
+			}
+		}
+	}
+
+	b, err := json.Marshal(v.Interface())
+	if err != nil {
+		rv[path] = fmt.Sprintf("%#v", v.Interface())
+		return
+	}
+	rv[path] = string(b)
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/patrickascher/gofw/config"
+	"github.com/patrickascher/gofw/config/json"
+	"github.com/stretchr/testify/assert"
+)
+
+type composeDatabase struct {
+	Host string `json:"host" default:"localhost"`
+	Port int    `json:"port" default:"3306"`
+}
+
+type composeConfig struct {
+	Name      string             `json:"name" default:"app" validate:"required"`
+	HTTPPort  int                `json:"httpPort" default:"80"`
+	Timeout   time.Duration      `json:"timeout" default:"1s"`
+	Debug     bool               `json:"debug"`
+	Databases []*composeDatabase `json:"databases"`
+
+	callbacks []string
+}
+
+func (c *composeConfig) BeforeValid() error {
+	c.callbacks = append(c.callbacks, config.CallbackBeforeValid)
+	return nil
+}
+
+func TestCompose(t *testing.T) {
+	test := assert.New(t)
+
+	err := ioutil.WriteFile("compose.json", []byte(`{"httpPort": 8080, "timeout": 2000000000, "databases": [{"host": "db"}]}`), 0644)
+	test.NoError(err)
+	defer os.Remove("compose.json")
+	err = ioutil.WriteFile("dev.compose.json", []byte(`{"httpPort": 8081, "databases": [{"host": "db", "port": 5432}]}`), 0644)
+	test.NoError(err)
+	defer os.Remove("dev.compose.json")
+	test.NoError(os.Setenv("COMPOSE_HTTP_PORT", "9000"))
+	defer os.Unsetenv("COMPOSE_HTTP_PORT")
+
+	opt := json.Options{Filepath: "compose.json"}
+	cfg := &composeConfig{}
+	sources, err := config.Compose(cfg,
+		config.Source{Provider: config.DEFAULTS},
+		config.Source{Provider: config.JSON, Options: opt},
+		config.Source{Name: "json:dev", Provider: config.JSON, Options: opt, Env: "dev"},
+		config.Source{Provider: config.ENVIRONMENT, Options: config.EnvOptions{Prefix: "COMPOSE"}},
+		config.Source{Provider: config.FLAGS, Options: config.FlagOptions{Args: []string{"-debug", "--httpPort", "9001", "-databases.1.host=db2", "-unknown", "arg"}}},
+	)
+	test.NoError(err)
+
+	// ok: each layer overrides the one before
+	test.Equal("app", cfg.Name)
+	test.Equal(9001, cfg.HTTPPort)
+	test.Equal(2*time.Second, cfg.Timeout)
+	test.True(cfg.Debug)
+	test.Equal([]*composeDatabase{{Host: "db", Port: 5432}, {Host: "db2"}}, cfg.Databases)
+	test.Equal([]string{config.CallbackBeforeValid}, cfg.callbacks)
+
+	// ok: sources
+	test.Equal(config.Sources{
+		"Name":              config.DEFAULTS,
+		"HTTPPort":          config.FLAGS,
+		"Timeout":           config.JSON,
+		"Debug":             config.FLAGS,
+		"Databases[0].Host": config.JSON,
+		"Databases[0].Port": "json:dev",
+		"Databases[1].Host": config.FLAGS,
+		"Databases[1].Port": config.FLAGS,
+	}, sources)
+	test.Contains(sources.String(), "Databases[0].Port = json:dev\nDatabases[1].Host = flags\n")
+
+	// error: unknown provider
+	_, err = config.Compose(cfg, config.Source{Provider: "unknown"})
+	test.Error(err)
+	test.Equal(fmt.Sprintf(config.ErrUnknownProvider.Error(), "unknown"), err.Error())
+
+	// error: no ptr
+	_, err = config.Compose(composeConfig{})
+	test.Equal(config.ErrConfigPtr, err)
+
+	// error: invalid flag value
+	_, err = config.Compose(&composeConfig{}, config.Source{Provider: config.FLAGS, Options: config.FlagOptions{Args: []string{"-httpPort=abc"}}})
+	test.Error(err)
+
+	// error: validation
+	_, err = config.Compose(&composeConfig{}, config.Source{Provider: config.FLAGS, Options: config.FlagOptions{}})
+	test.Error(err)
+}
@@ -9,15 +9,21 @@ package config
 import (
 	"errors"
 	"fmt"
-	"github.com/go-playground/validator"
 	"github.com/patrickascher/gofw/callback"
 	"os"
 	"reflect"
+	"sync"
 )
 
 const (
 	// JSON pre-defined config provider.
 	JSON = "json"
+	// YAML pre-defined config provider.
+	YAML = "yaml"
+	// TOML pre-defined config provider.
+	TOML = "toml"
+	// DB pre-defined config provider.
+	DB = "db"
 	// ENV is the default name to check the system environment variable os.GetEnv().
 	ENV = "ENV"
 )
@@ -49,6 +55,20 @@ type Interface interface {
 	Parse(config interface{}, env string, options interface{}) error
 }
 
+// Loader can be implemented by a config provider, which keeps a state of the parsed config (e.g. config/db).
+type Loader interface {
+	// Loaded is called after the config was parsed, resolved and validated.
+	Loaded(config interface{})
+	// Released is called if the config was parsed again or released by Release.
+	Released(config interface{})
+}
+
+// loaders of the parsed configs.
+var loaders = struct {
+	sync.Mutex
+	configs map[interface{}][]Loader
+}{configs: make(map[interface{}][]Loader)}
+
 // provider is a function which returns the config interface.
 // Like this the config provider is getting initialized only when its called.
 type provider func() Interface
@@ -71,6 +91,8 @@ func Register(provider string, fn provider) error {
 // Options and environment are passed through to the provider. For more information check the provider documentation.
 // If no specific environment was set by SetEnv() before, the os.Env("ENV") will be used.
 // If the provider is not registered, the parsing fails or the cfg kind is not ptr, an error will return.
+// After parsing, the environment variables are set on the struct (see SetEnvPrefix and the env tag) and the references
+// like ${env:DB_PASS} are resolved (see RegisterResolver). Encrypted values (enc:...) are decrypted (see Key).
 // By default validate can be used on the struct to ensure all mandatory data is set.
 // Callbacks BeforeParse, BeforeValid, AfterValid, AfterParse can be used.
 
@@ -95,28 +117,63 @@ func New(provider string, config interface{}, options interface{}) error {
 		return err
 	}
 
-	err = callback.StructMethod(CallbackBeforeValid, config)
+	err = envOverlay(config, envPrefix)
 	if err != nil {
 		return err
 	}
 
-	validate := validator.New()
-	err = validate.Struct(config)
+	err = resolve(config)
 	if err != nil {
 		return err
 	}
 
-	err = callback.StructMethod(CallbackAfterValid, config)
+	err = valid(config)
 	if err != nil {
 		return err
 	}
 
-	err = callback.StructMethod(CallbackAfterParse, config)
-	if err != nil {
-		return err
+	load(config, instance)
+	return nil
+}
+
+// Release removes the state which was added for the config by New, Compose and the providers (e.g. the secrets of MaskString and Masked).
+// It should be called if a config is replaced and not used anymore. The Watcher releases the old config after a reload.
+func Release(config interface{}) {
+	releaseSecrets(config)
+
+	loaders.Lock()
+	l := loaders.configs[config]
+	delete(loaders.configs, config)
+	loaders.Unlock()
+
+	for _, loader := range l {
+		loader.Released(config)
 	}
+}
 
-	return nil
+// load releases the loaders of a previous parse and calls Loaded on all instances which are implementing the Loader interface.
+func load(config interface{}, instances ...Interface) {
+	var l []Loader
+	for _, instance := range instances {
+		if loader, ok := instance.(Loader); ok {
+			l = append(l, loader)
+		}
+	}
+
+	loaders.Lock()
+	old := loaders.configs[config]
+	delete(loaders.configs, config)
+	if len(l) > 0 {
+		loaders.configs[config] = l
+	}
+	loaders.Unlock()
+
+	for _, loader := range old {
+		loader.Released(config)
+	}
+	for _, loader := range l {
+		loader.Loaded(config)
+	}
 }
 
 // SetEnv allows a custom environment variable. This must be set before New() is called.
@@ -90,6 +90,60 @@ func TestNew(t *testing.T) {
 	test.Equal(true, c.Called)
 }
 
+// loaderConfig is a provider which implements the config.Loader interface.
+type loaderConfig struct {
+	loaded   []interface{}
+	released []interface{}
+}
+
+func (l *loaderConfig) Parse(conf interface{}, env string, opt interface{}) error {
+	return nil
+}
+
+func (l *loaderConfig) Loaded(conf interface{}) {
+	l.loaded = append(l.loaded, conf)
+}
+
+func (l *loaderConfig) Released(conf interface{}) {
+	l.released = append(l.released, conf)
+}
+
+func TestRelease(t *testing.T) {
+	test := assert.New(t)
+
+	var instances []*loaderConfig
+	test.NoError(config.Register("loader", func() config.Interface {
+		l := &loaderConfig{}
+		instances = append(instances, l)
+		return l
+	}))
+
+	// ok: loaded after parsing
+	c := &cfg{}
+	test.NoError(config.New("loader", c, nil))
+	test.Equal(1, len(instances))
+	test.Equal([]interface{}{c}, instances[0].loaded)
+	test.Nil(instances[0].released)
+
+	// ok: the previous state is released if the config is parsed again
+	test.NoError(config.New("loader", c, nil))
+	test.Equal([]interface{}{c}, instances[0].released)
+	test.Equal([]interface{}{c}, instances[1].loaded)
+
+	// ok: release
+	config.Release(c)
+	test.Equal([]interface{}{c}, instances[1].released)
+	config.Release(c)
+	test.Equal(1, len(instances[1].released))
+
+	// ok: not loaded if the validation fails
+	invalid := &struct {
+		Name string `validate:"required"`
+	}{}
+	test.Error(config.New("loader", invalid, nil))
+	test.Nil(instances[2].loaded)
+}
+
 func TestSetEnv(t *testing.T) {
 	config.SetEnv("development")
 	assert.Equal(t, "development", config.Env())
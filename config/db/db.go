@@ -0,0 +1,477 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package db implements the config.Interface and registers a database provider.
+// Settings are stored as key/value rows, like this they can be changed at runtime (e.g. by an admin UI) without a deploy.
+//
+// The fields are mapped by the setting tag. The tag of a struct field is used as prefix for its fields.
+// Fields without a tag are skipped, embedded or untagged structs are added without a prefix.
+//
+//	type Settings struct {
+//		Mail struct {
+//			Sender string `setting:"sender" validate:"required,email"`
+//		} `setting:"mail"` // mail.sender
+//		Banner string `setting:"maintenance.banner"`
+//	}
+//
+// The values are converted like environment variables (see config.SetValue), slices are comma separated.
+// The tables must exist and need the following columns (mysql example):
+//
+//	CREATE TABLE `settings` (
+//		`name` VARCHAR(255) NOT NULL PRIMARY KEY,
+//		`value` TEXT NOT NULL
+//	);
+//	CREATE TABLE `settings_audit` (
+//		`id` INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+//		`name` VARCHAR(255) NOT NULL,
+//		`old_value` TEXT NOT NULL,
+//		`new_value` TEXT NOT NULL,
+//		`changed_by` VARCHAR(255) NOT NULL,
+//		`changed_at` DATETIME NOT NULL,
+//		INDEX (`name`)
+//	);
+//
+// Check the db.Options for the available configurations.
+package db
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/patrickascher/gofw/config"
+	"github.com/patrickascher/gofw/sqlquery"
+)
+
+// TagSetting is the struct tag to define the setting name of a field.
+const TagSetting = "setting"
+
+// defaults of the db provider.
+var (
+	defaultTable      = "settings"
+	defaultAuditTable = "settings_audit"
+)
+
+// Error messages
+var (
+	ErrBuilder  = errors.New("config/db: option Builder is mandatory")
+	ErrValue    = errors.New("config/db: setting %v could not be set on field %v: %v")
+	ErrType     = errors.New("config/db: type %v is not supported")
+	ErrUser     = errors.New("config/db: user is mandatory")
+	ErrConflict = errors.New("config/db: setting %v was changed by another user")
+)
+
+// loaded state of the parsed config structs, until they are released (see config.Release).
+var loaded = struct {
+	sync.Mutex
+	configs map[interface{}]map[string]setting
+}{configs: make(map[interface{}]map[string]setting)}
+
+// init registers the db provider
+func init() {
+	_ = config.Register(config.DB, New)
+}
+
+// db config provider
+type db struct {
+	state map[string]setting
+}
+
+// Options for the db provider.
+type Options struct {
+	// Builder which is used for the queries. Mandatory.
+	Builder sqlquery.Builder
+	// Table of the settings. Default is "settings".
+	Table string
+	// AuditTable of the changes. Default is "settings_audit".
+	AuditTable string
+}
+
+// Change of a setting.
+type Change struct {
+	Name      string
+	OldValue  string
+	NewValue  string
+	ChangedBy string
+	ChangedAt time.Time
+}
+
+// field of the config struct.
+type field struct {
+	value  reflect.Value
+	path   string
+	secret bool
+}
+
+// setting is the state of a field when the config was loaded.
+type setting struct {
+	value  string // formatted field value after the environment variables and references were resolved
+	stored string // value in the table
+	exists bool   // setting exists in the table
+}
+
+// New satisfies the config.provider interface.
+func New() config.Interface {
+	return &db{}
+}
+
+// Parse reads all settings and sets them on the config struct. Settings which are not mapped are ignored.
+// The env is not used.
+// The state of the settings is added in Loaded, after the environment variables and references were resolved.
+// Error will return if the builder is not defined, the query fails or a value can not be converted.
+func (d *db) Parse(cfg interface{}, env string, options interface{}) error {
+	opt, err := defaults(options)
+	if err != nil {
+		return err
+	}
+
+	values, err := settings(&opt.Builder, opt)
+	if err != nil {
+		return err
+	}
+
+	fields := make(map[string]field)
+	walk(reflect.ValueOf(cfg), "", "", true, fields)
+	d.state = make(map[string]setting, len(fields))
+	for name, f := range fields {
+		val, ok := values[name]
+		if ok {
+			if err := config.SetValue(f.value, val); err != nil {
+				return fmt.Errorf(ErrValue.Error(), name, f.path, err)
+			}
+		}
+		d.state[name] = setting{stored: val, exists: ok}
+	}
+	return nil
+}
+
+// Loaded satisfies the config.Loader interface.
+// The field values are recorded after the environment variables and references were resolved. Like this Save only writes
+// the fields which were changed by the caller and never an environment variable or a resolved secret.
+func (d *db) Loaded(cfg interface{}) {
+	fields := make(map[string]field)
+	walk(reflect.ValueOf(cfg), "", "", false, fields)
+	state := make(map[string]setting, len(d.state))
+	for name, s := range d.state {
+		f, ok := fields[name]
+		if !ok {
+			continue
+		}
+		if formatted, err := format(f.value); err == nil {
+			s.value = formatted
+			state[name] = s
+		}
+	}
+
+	loaded.Lock()
+	loaded.configs[cfg] = state
+	loaded.Unlock()
+}
+
+// Released satisfies the config.Loader interface.
+// The state of the config is removed.
+func (d *db) Released(cfg interface{}) {
+	loaded.Lock()
+	delete(loaded.configs, cfg)
+	loaded.Unlock()
+}
+
+// Save validates the config struct and writes all changed settings back in one transaction.
+// If the config was parsed by the db provider, only the fields which were changed since then are written. Values which were
+// set by environment variables or resolved references (e.g. ${env:TOKEN}, enc:...) are not written back, unless they were changed.
+// A setting which was changed in the meantime by another user is not overwritten, instead an ErrConflict will return
+// and nothing is saved. The config has to be parsed again in that case.
+// For every change an audit row with the old and new value and the user is added. Values of fields with the tag secret:"true"
+// are stored masked in the audit table.
+// The changes will return, sorted by the setting name.
+// Error will return if the user is empty, the validation fails or a query fails.
+func Save(options Options, cfg interface{}, user string) ([]Change, error) {
+	if user == "" {
+		return nil, ErrUser
+	}
+	opt, err := defaults(options)
+	if err != nil {
+		return nil, err
+	}
+	err = config.Validate(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]field)
+	walk(reflect.ValueOf(cfg), "", "", false, fields)
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b := opt.Builder
+	err = b.Tx()
+	if err != nil {
+		return nil, err
+	}
+	loaded.Lock()
+	state := loaded.configs[cfg]
+	loaded.Unlock()
+
+	changes, err := save(&b, opt, fields, names, state, user)
+	if err != nil {
+		_ = b.Rollback()
+		return nil, err
+	}
+	err = b.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	// the saved values are the new loaded state, if the config was not released in the meantime.
+	if state != nil {
+		next := make(map[string]setting, len(state))
+		for name, s := range state {
+			next[name] = s
+		}
+		for _, c := range changes {
+			next[c.Name] = setting{value: c.NewValue, stored: c.NewValue, exists: true}
+		}
+		loaded.Lock()
+		if _, ok := loaded.configs[cfg]; ok {
+			loaded.configs[cfg] = next
+		}
+		loaded.Unlock()
+	}
+	return changes, nil
+}
+
+// History returns the changes of the given settings, the newest first.
+// If no name is given, all changes will return.
+func History(options Options, names ...string) ([]Change, error) {
+	opt, err := defaults(options)
+	if err != nil {
+		return nil, err
+	}
+
+	b := opt.Builder
+	s := b.Select(opt.AuditTable).Columns("name", "old_value", "new_value", "changed_by", "changed_at").Order("-id")
+	if len(names) > 0 {
+		s.Where(b.QuoteIdentifier("name")+" IN (?)", names)
+	}
+	rows, err := s.All()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rv []Change
+	for rows.Next() {
+		c := Change{}
+		if err := rows.Scan(&c.Name, &c.OldValue, &c.NewValue, &c.ChangedBy, &c.ChangedAt); err != nil {
+			return nil, err
+		}
+		rv = append(rv, c)
+	}
+	return rv, rows.Err()
+}
+
+// save writes the changed settings and the audit rows.
+// Fields which did not change since the config was loaded are skipped. If the setting was changed in the table since then,
+// or between reading and writing, an ErrConflict will return.
+func save(b *sqlquery.Builder, opt Options, fields map[string]field, names []string, state map[string]setting, user string) ([]Change, error) {
+	values, err := settings(b, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	now := time.Now().Truncate(time.Second)
+	for _, name := range names {
+		val, err := format(fields[name].value)
+		if err != nil {
+			return nil, fmt.Errorf(ErrValue.Error(), name, fields[name].path, err)
+		}
+		s, tracked := state[name]
+		if tracked && s.value == val {
+			continue
+		}
+		old, exists := values[name]
+		if exists && old == val {
+			continue
+		}
+		if tracked && (s.exists != exists || s.stored != old) {
+			return nil, fmt.Errorf(ErrConflict.Error(), name)
+		}
+
+		if exists {
+			// the old value is checked again, in case it was changed after the select.
+			res, err := b.Update(opt.Table).Set(map[string]interface{}{"value": val}).Where(b.QuoteIdentifier("name")+" = ? AND "+b.QuoteIdentifier("value")+" = ?", name, old).Exec()
+			if err != nil {
+				return nil, err
+			}
+			if n, err := res.RowsAffected(); err == nil && n == 0 {
+				return nil, fmt.Errorf(ErrConflict.Error(), name)
+			}
+		} else {
+			_, err = b.Insert(opt.Table).Values([]map[string]interface{}{{"name": name, "value": val}}).Exec()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		c := Change{Name: name, OldValue: old, NewValue: val, ChangedBy: user, ChangedAt: now}
+		audit := c
+		if fields[name].secret {
+			audit.OldValue, audit.NewValue = config.Mask, config.Mask
+		}
+		_, err = b.Insert(opt.AuditTable).Values([]map[string]interface{}{{"name": audit.Name, "old_value": audit.OldValue, "new_value": audit.NewValue, "changed_by": audit.ChangedBy, "changed_at": audit.ChangedAt}}).Exec()
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, nil
+}
+
+// defaults sets the default options.
+func defaults(options interface{}) (Options, error) {
+	opt := Options{}
+	if options != nil {
+		opt = options.(Options)
+	}
+	if opt.Builder.Driver() == nil {
+		return opt, ErrBuilder
+	}
+	if opt.Table == "" {
+		opt.Table = defaultTable
+	}
+	if opt.AuditTable == "" {
+		opt.AuditTable = defaultAuditTable
+	}
+	return opt, nil
+}
+
+// settings returns all rows of the settings table.
+func settings(b *sqlquery.Builder, opt Options) (map[string]string, error) {
+	rows, err := b.Select(opt.Table).Columns("name", "value").All()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rv := make(map[string]string)
+	for rows.Next() {
+		var name, val string
+		if err := rows.Scan(&name, &val); err != nil {
+			return nil, err
+		}
+		rv[name] = val
+	}
+	return rv, rows.Err()
+}
+
+// walk adds all tagged fields of the struct by their setting name.
+// If alloc is true, nil struct pointers are allocated, otherwise they are skipped.
+func walk(v reflect.Value, prefix string, path string, alloc bool, fields map[string]field) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			if !alloc || !v.CanSet() {
+				return
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get(TagSetting)
+		if f.PkgPath != "" || tag == "-" {
+			continue
+		}
+		p := strings.TrimPrefix(path+"."+f.Name, ".")
+
+		if isNested(f.Type) {
+			name := prefix
+			if tag != "" {
+				name = prefix + tag + "."
+			}
+			walk(v.Field(i), name, p, alloc, fields)
+			continue
+		}
+		if tag == "" {
+			continue
+		}
+		secret, _ := strconv.ParseBool(f.Tag.Get(config.TagSecret))
+		fields[prefix+tag] = field{value: v.Field(i), path: p, secret: secret}
+	}
+}
+
+// isNested returns true if the type is a struct or struct ptr, which is not set by text.
+func isNested(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && !reflect.PtrTo(t).Implements(reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem())
+}
+
+// format converts the value into a string. It is the counterpart of config.SetValue.
+func format(v reflect.Value) (string, error) {
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		if v.Kind() == reflect.Ptr && v.IsNil() {
+			return "", nil
+		}
+		b, err := m.MarshalText()
+		return string(b), err
+	}
+	if v.CanAddr() {
+		if m, ok := v.Addr().Interface().(encoding.TextMarshaler); ok {
+			b, err := m.MarshalText()
+			return string(b), err
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			return time.Duration(v.Int()).String(), nil
+		}
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), nil
+		}
+		parts := make([]string, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			s, err := format(v.Index(i))
+			if err != nil {
+				return "", err
+			}
+			parts[i] = s
+		}
+		return strings.Join(parts, ","), nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			return "", nil
+		}
+		return format(v.Elem())
+	}
+	return "", fmt.Errorf(ErrType.Error(), v.Type())
+}
@@ -0,0 +1,238 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db_test
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/patrickascher/gofw/config"
+	"github.com/patrickascher/gofw/config/db"
+	"github.com/patrickascher/gofw/sqlquery"
+	_ "github.com/patrickascher/gofw/sqlquery/driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+type mail struct {
+	Sender string `setting:"sender" validate:"required,email"`
+	Token  string `setting:"token" secret:"true"`
+}
+
+type grid struct {
+	PageSize int           `setting:"pageSize"`
+	Exports  []string      `setting:"exports"`
+	Timeout  time.Duration `setting:"timeout"`
+}
+
+type settings struct {
+	Mail    mail   `setting:"mail"`
+	Grid    *grid  `setting:"grid"`
+	Banner  string `setting:"maintenance.banner"`
+	Enabled bool   `setting:"maintenance.enabled"`
+	Ignored string
+}
+
+// newBuilder returns a builder with empty settings tables.
+func newBuilder(t *testing.T) sqlquery.Builder {
+	cfg := sqlquery.Config{
+		Driver:   "mysql",
+		Host:     "127.0.0.1",
+		Port:     3319,
+		Username: "root",
+		Password: "root",
+		Database: "gofw",
+	}
+	b, err := sqlquery.New(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, stmt := range []string{
+		"CREATE TABLE IF NOT EXISTS `settings` (`name` VARCHAR(255) NOT NULL PRIMARY KEY, `value` TEXT NOT NULL)",
+		"CREATE TABLE IF NOT EXISTS `settings_audit` (`id` INT NOT NULL AUTO_INCREMENT PRIMARY KEY, `name` VARCHAR(255) NOT NULL, `old_value` TEXT NOT NULL, `new_value` TEXT NOT NULL, `changed_by` VARCHAR(255) NOT NULL, `changed_at` DATETIME NOT NULL, INDEX (`name`))",
+		"DELETE FROM `settings`",
+		"DELETE FROM `settings_audit`",
+	} {
+		_, err = b.Driver().Connection().Exec(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return b
+}
+
+func TestDB_Parse(t *testing.T) {
+	test := assert.New(t)
+
+	// error: no builder
+	err := config.New(config.DB, &settings{}, db.Options{})
+	test.Equal(db.ErrBuilder, err)
+
+	b := newBuilder(t)
+	opt := db.Options{Builder: b}
+
+	// error: validation
+	err = config.New(config.DB, &settings{}, opt)
+	test.Error(err)
+
+	// ok
+	_, err = b.Insert("settings").Values([]map[string]interface{}{
+		{"name": "mail.sender", "value": "info@example.com"},
+		{"name": "grid.pageSize", "value": "25"},
+		{"name": "grid.exports", "value": "csv, pdf"},
+		{"name": "grid.timeout", "value": "1m"},
+		{"name": "maintenance.enabled", "value": "true"},
+		{"name": "unknown", "value": "foo"},
+	}).Exec()
+	test.NoError(err)
+	cfg := &settings{}
+	err = config.New(config.DB, cfg, opt)
+	test.NoError(err)
+	test.Equal(&settings{
+		Mail:    mail{Sender: "info@example.com"},
+		Grid:    &grid{PageSize: 25, Exports: []string{"csv", "pdf"}, Timeout: time.Minute},
+		Enabled: true,
+	}, cfg)
+
+	// error: invalid value
+	_, err = b.Update("settings").Set(map[string]interface{}{"value": "abc"}).Where("name = ?", "grid.pageSize").Exec()
+	test.NoError(err)
+	err = config.New(config.DB, &settings{}, opt)
+	test.Error(err)
+	test.Contains(err.Error(), fmt.Sprintf(db.ErrValue.Error(), "grid.pageSize", "Grid.PageSize", ""))
+}
+
+func TestSave(t *testing.T) {
+	test := assert.New(t)
+	opt := db.Options{Builder: newBuilder(t)}
+
+	// error: no user, validation
+	_, err := db.Save(opt, &settings{}, "")
+	test.Equal(db.ErrUser, err)
+	_, err = db.Save(opt, &settings{}, "admin")
+	test.Error(err)
+
+	// ok: all settings are added
+	cfg := &settings{Mail: mail{Sender: "info@example.com", Token: "secret"}, Grid: &grid{PageSize: 10, Exports: []string{"csv"}}, Banner: "Maintenance"}
+	changes, err := db.Save(opt, cfg, "admin")
+	test.NoError(err)
+	test.Equal(7, len(changes))
+	test.Equal("grid.exports", changes[0].Name)
+	test.Equal("", changes[0].OldValue)
+	test.Equal("csv", changes[0].NewValue)
+	test.Equal("admin", changes[0].ChangedBy)
+
+	parsed := &settings{}
+	test.NoError(config.New(config.DB, parsed, opt))
+	test.Equal(cfg, parsed)
+
+	// ok: only changed settings are written
+	parsed.Mail.Token = "new-secret"
+	parsed.Grid.PageSize = 50
+	changes, err = db.Save(opt, parsed, "john")
+	test.NoError(err)
+	test.Equal(2, len(changes))
+	test.Equal(db.Change{Name: "grid.pageSize", OldValue: "10", NewValue: "50", ChangedBy: "john", ChangedAt: changes[0].ChangedAt}, changes[0])
+	test.Equal("mail.token", changes[1].Name)
+	changes, err = db.Save(opt, parsed, "john")
+	test.NoError(err)
+	test.Equal(0, len(changes))
+
+	// ok: history, secret values are masked
+	history, err := db.History(opt, "grid.pageSize", "mail.token")
+	test.NoError(err)
+	test.Equal(4, len(history))
+	for _, h := range history {
+		if h.Name == "mail.token" {
+			test.Equal(config.Mask, h.NewValue)
+		}
+	}
+	test.Equal("john", history[0].ChangedBy)
+	history, err = db.History(opt)
+	test.NoError(err)
+	test.Equal(9, len(history))
+
+	// ok: a stale config only writes its own changes
+	admin1, admin2 := &settings{}, &settings{}
+	test.NoError(config.New(config.DB, admin1, opt))
+	test.NoError(config.New(config.DB, admin2, opt))
+	admin1.Banner = "Deploy at 10pm"
+	changes, err = db.Save(opt, admin1, "admin1")
+	test.NoError(err)
+	test.Equal(1, len(changes))
+	admin2.Grid.PageSize = 100
+	changes, err = db.Save(opt, admin2, "admin2")
+	test.NoError(err)
+	test.Equal(1, len(changes))
+	test.Equal("grid.pageSize", changes[0].Name)
+	parsed = &settings{}
+	test.NoError(config.New(config.DB, parsed, opt))
+	test.Equal("Deploy at 10pm", parsed.Banner)
+	test.Equal(100, parsed.Grid.PageSize)
+
+	// error: the setting was changed by another user
+	admin2.Banner = "Deploy at 11pm"
+	admin2.Grid.PageSize = 20
+	_, err = db.Save(opt, admin2, "admin2")
+	test.Equal(fmt.Sprintf(db.ErrConflict.Error(), "maintenance.banner"), err.Error())
+	parsed = &settings{}
+	test.NoError(config.New(config.DB, parsed, opt))
+	test.Equal("Deploy at 10pm", parsed.Banner)
+	test.Equal(100, parsed.Grid.PageSize)
+}
+
+func TestSave_Resolved(t *testing.T) {
+	test := assert.New(t)
+	opt := db.Options{Builder: newBuilder(t)}
+
+	k, err := config.GenerateKey()
+	test.NoError(err)
+	key, err := config.ParseKey(k)
+	test.NoError(err)
+	token, err := config.Encrypt("secret", key)
+	test.NoError(err)
+	test.NoError(os.Setenv("CONFIG_KEY", k))
+	test.NoError(os.Setenv("CONFIG_DB_SENDER", "info@example.com"))
+	defer os.Unsetenv("CONFIG_KEY")
+	defer os.Unsetenv("CONFIG_DB_SENDER")
+
+	_, err = opt.Builder.Insert("settings").Values([]map[string]interface{}{
+		{"name": "mail.sender", "value": "${env:CONFIG_DB_SENDER}"},
+		{"name": "mail.token", "value": token},
+		{"name": "grid.pageSize", "value": "25"},
+	}).Exec()
+	test.NoError(err)
+
+	cfg := &settings{}
+	test.NoError(config.New(config.DB, cfg, opt))
+	test.Equal("info@example.com", cfg.Mail.Sender)
+	test.Equal("secret", cfg.Mail.Token)
+
+	// ok: resolved values are not written back
+	cfg.Grid.PageSize = 50
+	changes, err := db.Save(opt, cfg, "admin")
+	test.NoError(err)
+	test.Equal(1, len(changes))
+	test.Equal("grid.pageSize", changes[0].Name)
+
+	parsed := &settings{}
+	test.NoError(config.New(config.DB, parsed, opt))
+	test.Equal(cfg, parsed)
+	row, err := opt.Builder.Select("settings").Columns("value").Where("name = ?", "mail.token").First()
+	test.NoError(err)
+	var stored string
+	test.NoError(row.Scan(&stored))
+	test.Equal(token, stored)
+
+	// ok: a changed value is written
+	parsed.Mail.Sender = "admin@example.com"
+	changes, err = db.Save(opt, parsed, "admin")
+	test.NoError(err)
+	test.Equal(1, len(changes))
+	test.Equal(db.Change{Name: "mail.sender", OldValue: "${env:CONFIG_DB_SENDER}", NewValue: "admin@example.com", ChangedBy: "admin", ChangedAt: changes[0].ChangedAt}, changes[0])
+}
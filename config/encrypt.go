@@ -0,0 +1,162 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// EncPrefix defines an encrypted string value.
+const EncPrefix = "enc:"
+
+// Environment variables of the key.
+const (
+	// KeyEnv is the environment variable of the base64 encoded key.
+	KeyEnv = "CONFIG_KEY"
+	// KeyFileEnv is the environment variable of the key file path. The file contains the base64 encoded key.
+	KeyFileEnv = "CONFIG_KEY_FILE"
+)
+
+// keySize of the generated keys (AES-256).
+const keySize = 32
+
+// encValue matches the encrypted values in a file.
+var encValue = regexp.MustCompile(regexp.QuoteMeta(EncPrefix) + `[A-Za-z0-9+/]+={0,2}`)
+
+// Error messages.
+var (
+	ErrKeyMissing = errors.New("config: encryption key is not defined, set " + KeyEnv + " or " + KeyFileEnv)
+	ErrKeyInvalid = errors.New("config: encryption key is invalid: %v")
+	ErrEncValue   = errors.New("config: encrypted value is invalid")
+)
+
+// GenerateKey returns a new random base64 encoded key.
+func GenerateKey() (string, error) {
+	key := make([]byte, keySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ParseKey decodes the base64 encoded key. The key must have 16, 24 or 32 bytes (AES-128, AES-192, AES-256).
+func ParseKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf(ErrKeyInvalid.Error(), err)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	}
+	return nil, fmt.Errorf(ErrKeyInvalid.Error(), fmt.Sprintf("size %d", len(key)))
+}
+
+// Key returns the key of the environment variable CONFIG_KEY.
+// If it is not set, the key is read from the file of CONFIG_KEY_FILE.
+// Error will return if none is defined or the key is invalid.
+func Key() ([]byte, error) {
+	if k, ok := os.LookupEnv(KeyEnv); ok && k != "" {
+		return ParseKey(k)
+	}
+	if f, ok := os.LookupEnv(KeyFileEnv); ok && f != "" {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf(ErrKeyInvalid.Error(), err)
+		}
+		return ParseKey(string(b))
+	}
+	return nil, ErrKeyMissing
+}
+
+// Encrypt encrypts the value with AES-GCM and returns it with the EncPrefix (enc:base64).
+func Encrypt(value string, key []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return EncPrefix + base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(value), nil)), nil
+}
+
+// Decrypt decrypts a value which was created by Encrypt.
+// Error will return if the EncPrefix is missing, the value is invalid or the key is wrong.
+func Decrypt(value string, key []byte) (string, error) {
+	if !strings.HasPrefix(value, EncPrefix) {
+		return "", ErrEncValue
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, EncPrefix))
+	if err != nil || len(b) < gcm.NonceSize() {
+		return "", ErrEncValue
+	}
+	plain, err := gcm.Open(nil, b[:gcm.NonceSize()], b[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrEncValue
+	}
+	return string(plain), nil
+}
+
+// Reencrypt decrypts all encrypted values of the content with the old key and encrypts them with the new key.
+// The content format does not matter (json, yaml, toml), all enc: values are replaced.
+// Error will return if a value can not be decrypted. The number of replaced values will return.
+func Reencrypt(content []byte, oldKey []byte, newKey []byte) ([]byte, int, error) {
+	var err error
+	n := 0
+	rv := encValue.ReplaceAllFunc(content, func(v []byte) []byte {
+		if err != nil {
+			return v
+		}
+		var plain, enc string
+		plain, err = Decrypt(string(v), oldKey)
+		if err != nil {
+			return v
+		}
+		enc, err = Encrypt(plain, newKey)
+		if err != nil {
+			return v
+		}
+		n++
+		return []byte(enc)
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return rv, n, nil
+}
+
+// decrypt decrypts the value with the key of the environment.
+func decrypt(value string) (string, error) {
+	key, err := Key()
+	if err != nil {
+		return "", err
+	}
+	return Decrypt(value, key)
+}
+
+// newGCM returns the AES-GCM cipher of the key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf(ErrKeyInvalid.Error(), err)
+	}
+	return cipher.NewGCM(block)
+}
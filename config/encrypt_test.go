@@ -0,0 +1,102 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/patrickascher/gofw/config"
+	"github.com/patrickascher/gofw/sqlquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncrypt(t *testing.T) {
+	test := assert.New(t)
+
+	k, err := config.GenerateKey()
+	test.NoError(err)
+	key, err := config.ParseKey(k)
+	test.NoError(err)
+	test.Equal(32, len(key))
+
+	// ok
+	enc, err := config.Encrypt("pass", key)
+	test.NoError(err)
+	test.True(strings.HasPrefix(enc, config.EncPrefix))
+	enc2, err := config.Encrypt("pass", key)
+	test.NoError(err)
+	test.NotEqual(enc, enc2)
+	plain, err := config.Decrypt(enc, key)
+	test.NoError(err)
+	test.Equal("pass", plain)
+
+	// error: wrong key, invalid values
+	k2, _ := config.GenerateKey()
+	key2, _ := config.ParseKey(k2)
+	_, err = config.Decrypt(enc, key2)
+	test.Equal(config.ErrEncValue, err)
+	_, err = config.Decrypt("pass", key)
+	test.Equal(config.ErrEncValue, err)
+	_, err = config.Decrypt(config.EncPrefix+"!!", key)
+	test.Equal(config.ErrEncValue, err)
+
+	// error: invalid keys
+	_, err = config.ParseKey("abc")
+	test.Error(err)
+	_, err = config.ParseKey("YWJj")
+	test.Equal(fmt.Sprintf(config.ErrKeyInvalid.Error(), "size 3"), err.Error())
+
+	// ok: reencrypt
+	content := []byte(fmt.Sprintf(`{"user": "root", "password": "%s", "token": "%s"}`, enc, enc2))
+	rv, n, err := config.Reencrypt(content, key, key2)
+	test.NoError(err)
+	test.Equal(2, n)
+	test.NotContains(string(rv), enc)
+	test.Contains(string(rv), `"user": "root"`)
+	_, _, err = config.Reencrypt(rv, key, key2)
+	test.Equal(config.ErrEncValue, err)
+}
+
+func TestNew_Decrypt(t *testing.T) {
+	_ = config.Register("ref", func() config.Interface { return refProvider{} })
+	test := assert.New(t)
+
+	k, _ := config.GenerateKey()
+	key, _ := config.ParseKey(k)
+	enc, err := config.Encrypt("enc-pass", key)
+	test.NoError(err)
+	// the slice and map are shared with the parsed config.
+	opt := func() secretConfig {
+		return secretConfig{Databases: []*sqlquery.Config{{Password: enc}}, Labels: map[string]string{"pw": "${config:databases.0.password}"}}
+	}
+
+	// error: no key
+	test.NoError(os.Unsetenv(config.KeyEnv))
+	test.NoError(os.Unsetenv(config.KeyFileEnv))
+	err = config.New("ref", &secretConfig{}, opt())
+	test.Equal(fmt.Sprintf(config.ErrResolve.Error(), "Databases[0].Password", config.ErrKeyMissing), err.Error())
+
+	// ok: key file
+	test.NoError(ioutil.WriteFile("config.key", []byte(k+"\n"), 0600))
+	defer os.Remove("config.key")
+	test.NoError(os.Setenv(config.KeyFileEnv, "config.key"))
+	defer os.Unsetenv(config.KeyFileEnv)
+	cfg := &secretConfig{}
+	test.NoError(config.New("ref", cfg, opt()))
+	test.Equal("enc-pass", cfg.Databases[0].Password)
+	test.Equal("enc-pass", cfg.Labels["pw"])
+	test.Equal(config.Mask, config.MaskString("enc-pass"))
+
+	// error: wrong key by env, which has priority
+	k2, _ := config.GenerateKey()
+	test.NoError(os.Setenv(config.KeyEnv, k2))
+	defer os.Unsetenv(config.KeyEnv)
+	err = config.New("ref", &secretConfig{}, opt())
+	test.Equal(fmt.Sprintf(config.ErrResolve.Error(), "Databases[0].Password", config.ErrEncValue), err.Error())
+}
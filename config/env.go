@@ -0,0 +1,261 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	fwStrings "github.com/patrickascher/gofw/strings"
+)
+
+// TagEnv is the struct tag to define the environment variable name of a field.
+const TagEnv = "env"
+
+// envPrefix for the automatic environment variable names.
+var envPrefix string
+
+// Error messages.
+var (
+	ErrEnvValue = errors.New("config: environment variable %v could not be set on field %v: %v")
+	ErrEnvType  = errors.New("config: type %v is not supported")
+	ErrEnvJSON  = errors.New("config: invalid json")
+)
+
+// SetEnvPrefix enables the automatic environment variable names with the given prefix. This must be set before New() is called.
+// The name is created by the prefix and the path of the field in upper snake case.
+// The json tag is used as field name if defined. Slice elements are added by their index.
+//
+//	Server.HTTPPort `json:"httpPort"` // APP_SERVER_HTTP_PORT
+//	Databases[0].Host                  // APP_DATABASES_0_HOST
+func SetEnvPrefix(prefix string) {
+	envPrefix = prefix
+}
+
+// EnvPrefix returns the prefix for the automatic environment variable names.
+func EnvPrefix() string {
+	return envPrefix
+}
+
+// envOverlay sets the environment variables on the config struct.
+// Fields with an env tag are always set by the defined variable. If the field is a struct or slice, the tag is used as prefix.
+// If an env prefix is set, the automatic names are used for all other fields.
+// A tag value of "-" skips the field.
+func envOverlay(config interface{}, prefix string) error {
+	v := reflect.ValueOf(config)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	return envStruct(v, prefix, "")
+}
+
+// envStruct sets the fields of the struct.
+// If the name is empty, only fields with an env tag are set.
+func envStruct(v reflect.Value, name string, path string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := f.Tag.Get(TagEnv)
+		if tag == "-" {
+			continue
+		}
+
+		key := strings.Split(f.Tag.Get("json"), ",")[0]
+		// embedded structs are flattened like encoding/json does.
+		if f.Anonymous && key == "" && tag == "" {
+			if err := envField(v.Field(i), name, path); err != nil {
+				return err
+			}
+			continue
+		}
+		if key == "" || key == "-" {
+			key = f.Name
+		}
+
+		envName := ""
+		if tag != "" {
+			envName = tag
+		} else if name != "" {
+			envName = name + "_" + strings.ToUpper(fwStrings.CamelToSnake(key))
+		}
+		if err := envField(v.Field(i), envName, strings.TrimPrefix(path+"."+f.Name, ".")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// envField sets the value by the environment variable name.
+// Structs, pointers and slices are handled recursively.
+func envField(v reflect.Value, name string, path string) error {
+	if isText(v) {
+		return envSet(v, name, path)
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			if name == "" || !envExists(name) {
+				return nil
+			}
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return envField(v.Elem(), name, path)
+	case reflect.Struct:
+		return envStruct(v, name, path)
+	case reflect.Slice:
+		if !isNested(v.Type().Elem()) {
+			return envSet(v, name, path)
+		}
+		for i := 0; i < v.Len() || (name != "" && envExists(name+"_"+strconv.Itoa(i))); i++ {
+			if i == v.Len() {
+				v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+			}
+			elemName := ""
+			if name != "" {
+				elemName = name + "_" + strconv.Itoa(i)
+			}
+			if err := envField(v.Index(i), elemName, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return envSet(v, name, path)
+}
+
+// envSet sets the value of the environment variable, if it exists.
+func envSet(v reflect.Value, name string, path string) error {
+	if name == "" {
+		return nil
+	}
+	val, ok := os.LookupEnv(name)
+	if !ok {
+		return nil
+	}
+	if err := setString(v, val); err != nil {
+		return fmt.Errorf(ErrEnvValue.Error(), name, path, err)
+	}
+	return nil
+}
+
+// envExists returns true if an environment variable with the name or the name as prefix exists.
+func envExists(name string) bool {
+	for _, e := range os.Environ() {
+		key := strings.SplitN(e, "=", 2)[0]
+		if key == name || strings.HasPrefix(key, name+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+// isText returns true if the value implements the encoding.TextUnmarshaler.
+func isText(v reflect.Value) bool {
+	if !v.CanAddr() {
+		return false
+	}
+	_, ok := v.Addr().Interface().(encoding.TextUnmarshaler)
+	return ok
+}
+
+// isNested returns true if the type is a struct or struct ptr, which is not set by text.
+func isNested(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct && !reflect.PtrTo(t).Implements(reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem())
+}
+
+// SetValue converts the string into the type of the value and sets it.
+// It can be used by providers which are reading string values (see setString).
+func SetValue(v reflect.Value, s string) error {
+	return setString(v, s)
+}
+
+// setString converts the string into the type of the value.
+// Slices are comma separated, []byte and json.RawMessage are set as they are.
+func setString(v reflect.Value, s string) error {
+	if isText(v) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		i, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(i)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.Type() == reflect.TypeOf(json.RawMessage{}) && !json.Valid([]byte(s)) {
+				return ErrEnvJSON
+			}
+			v.SetBytes([]byte(s))
+			return nil
+		}
+		parts := strings.Split(s, ",")
+		slice := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, p := range parts {
+			if err := setString(slice.Index(i), strings.TrimSpace(p)); err != nil {
+				return err
+			}
+		}
+		v.Set(slice)
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setString(v.Elem(), s)
+	default:
+		return fmt.Errorf(ErrEnvType.Error(), v.Type())
+	}
+	return nil
+}
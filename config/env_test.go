@@ -0,0 +1,109 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/patrickascher/gofw/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type envDatabase struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Password string `json:"password" env:"DB_PASSWORD"`
+}
+
+type envServer struct {
+	HTTPPort int           `json:"httpPort" validate:"required"`
+	Timeout  time.Duration `json:"timeout"`
+	Hosts    []string      `json:"hosts"`
+	Debug    *bool         `json:"debug"`
+	Secret   string        `env:"-"`
+}
+
+type envConfig struct {
+	Server    envServer       `json:"server"`
+	Databases []*envDatabase  `json:"databases"`
+	Options   json.RawMessage `json:"options"`
+	Started   time.Time       `json:"started"`
+}
+
+// noopProvider does not set any value.
+type noopProvider struct{}
+
+func (noopProvider) Parse(conf interface{}, env string, opt interface{}) error {
+	return nil
+}
+
+// setEnv sets the environment variables and returns a function to unset them.
+func setEnv(t *testing.T, vars map[string]string) func() {
+	for k, v := range vars {
+		assert.NoError(t, os.Setenv(k, v))
+	}
+	return func() {
+		for k := range vars {
+			_ = os.Unsetenv(k)
+		}
+	}
+}
+
+func TestNew_Env(t *testing.T) {
+	_ = config.Register("noop", func() config.Interface { return noopProvider{} })
+	test := assert.New(t)
+
+	// ok: only env tags are used without prefix
+	unset := setEnv(t, map[string]string{"DB_PASSWORD": "secret", "APP_SERVER_HTTP_PORT": "8080"})
+	cfg := &envConfig{Server: envServer{HTTPPort: 1}, Databases: []*envDatabase{{Host: "localhost"}}}
+	test.NoError(config.New("noop", cfg, nil))
+	test.Equal(1, cfg.Server.HTTPPort)
+	test.Equal("secret", cfg.Databases[0].Password)
+	unset()
+
+	// ok: automatic names
+	config.SetEnvPrefix("APP")
+	defer config.SetEnvPrefix("")
+	test.Equal("APP", config.EnvPrefix())
+	unset = setEnv(t, map[string]string{
+		"APP_SERVER_HTTP_PORT":   "8080",
+		"APP_SERVER_TIMEOUT":     "5s",
+		"APP_SERVER_HOSTS":       "a, b",
+		"APP_SERVER_DEBUG":       "true",
+		"APP_SERVER_SECRET":      "ignored",
+		"APP_DATABASES_0_HOST":   "db0",
+		"APP_DATABASES_1_HOST":   "db1",
+		"APP_DATABASES_1_PORT":   "3306",
+		"APP_OPTIONS":            `{"maxItems":10}`,
+		"APP_STARTED":            "2020-01-02T15:04:05Z",
+		"APP_DATABASES_X_IGNORE": "x",
+	})
+	defer unset()
+	cfg = &envConfig{Databases: []*envDatabase{{Host: "localhost", Port: 5432}}}
+	test.NoError(config.New("noop", cfg, nil))
+	debug := true
+	test.Equal(envServer{HTTPPort: 8080, Timeout: 5 * time.Second, Hosts: []string{"a", "b"}, Debug: &debug}, cfg.Server)
+	test.Equal([]*envDatabase{{Host: "db0", Port: 5432}, {Host: "db1", Port: 3306}}, cfg.Databases)
+	test.Equal(json.RawMessage(`{"maxItems":10}`), cfg.Options)
+	test.Equal(time.Date(2020, 1, 2, 15, 4, 5, 0, time.UTC), cfg.Started)
+
+	// error: invalid value, the field path is part of the error
+	unset2 := setEnv(t, map[string]string{"APP_DATABASES_1_PORT": "abc"})
+	cfg = &envConfig{}
+	err := config.New("noop", cfg, nil)
+	test.Error(err)
+	test.Contains(err.Error(), fmt.Sprintf("APP_DATABASES_1_PORT could not be set on field %v", "Databases[1].Port"))
+	unset2()
+
+	// error: validation runs after the overlay
+	unset3 := setEnv(t, map[string]string{"APP_SERVER_HTTP_PORT": "0"})
+	err = config.New("noop", &envConfig{}, nil)
+	test.Error(err)
+	unset3()
+}
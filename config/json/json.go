@@ -34,7 +34,7 @@ type json struct {
 type Options struct {
 	// The Filepath is mandatory.
 	// The given file will get decoded and marshaled into the given config struct.
-	// If a environment file exists, it will be merged with a higher priority.
+	// If a environment file exists, it will be merged with a higher priority (see config.Merge for the merge strategies).
 	// This means a common configuration could be written in conf.json and the env configuration is getting merged together.
 	// Prefix the file with the environment followed by a dot. (dev.conf.json, staging.conf.json, production.conf.json, ...)
 	Filepath string
@@ -51,9 +51,9 @@ func New() config.Interface {
 }
 
 // Parse the given file into the config struct. sync.mux is used for synchronisation.
-// File and env file are getting decoded/marshaled into the config struct (please see json.Options for more details).
+// File and env file are getting decoded and merged into the config struct (please see json.Options and config.Merge for more details).
 // If the filepath is not set, file does not exist or the json can not get decoded, an error will return.
-func (j *json) Parse(config interface{}, env string, options interface{}) error {
+func (j *json) Parse(cfg interface{}, env string, options interface{}) error {
 	// checking if the config Filepath is set
 	opt := options.(Options)
 	if opt.Filepath == "" {
@@ -64,27 +64,37 @@ func (j *json) Parse(config interface{}, env string, options interface{}) error
 	j.mux.Lock()
 	defer j.mux.Unlock()
 
-	// opening filepath and write it to the config struct
-	err := fileOpen(opt.Filepath, config)
+	// opening filepath
+	files := make([]map[string]interface{}, 0, 2)
+	m, err := fileOpen(opt.Filepath)
 	if err != nil {
 		return err
 	}
-
-	// check if an env file exists and is no dir
-	envFile := fmt.Sprintf("%v%v%v%v", filepath.Dir(opt.Filepath), string(filepath.Separator), env+".", filepath.Base(opt.Filepath))
-	if info, err := os.Stat(envFile); err == nil && !info.IsDir() {
-		//ignore error because its only the env file
-		err = fileOpen(envFile, config)
-		if err != nil {
-			return err
+	files = append(files, m)
+
+	// check if an env is set and the env file exists and is no dir
+	if env != "" {
+		envFile := fmt.Sprintf("%v%v%v%v", filepath.Dir(opt.Filepath), string(filepath.Separator), env+".", filepath.Base(opt.Filepath))
+		if info, err := os.Stat(envFile); err == nil && !info.IsDir() {
+			m, err = fileOpen(envFile)
+			if err != nil {
+				// the base file is set, even if the env file is invalid.
+				if mErr := config.Merge(cfg, files...); mErr != nil {
+					return mErr
+				}
+				return err
+			}
+			files = append(files, m)
 		}
 	}
 
-	return nil
+	// the files are merged by the merge strategies of the config struct.
+	return config.Merge(cfg, files...)
 }
 
-// fileOpen checks if a file exists and read it into the given config struct.
-func fileOpen(f string, c interface{}) (err error) {
+// fileOpen checks if a file exists and decodes it into a map.
+// Numbers are decoded as json.Number, so that the precision is kept.
+func fileOpen(f string) (m map[string]interface{}, err error) {
 	//Open the config file
 	configFile, err := os.Open(f)
 	if err != nil {
@@ -99,7 +109,9 @@ func fileOpen(f string, c interface{}) (err error) {
 		}
 	}()
 
-	//Read and convert the Json to the given struct
+	//Read and convert the Json into a map
 	jsonParser := encJson.NewDecoder(configFile)
-	return jsonParser.Decode(&c)
+	jsonParser.UseNumber()
+	err = jsonParser.Decode(&m)
+	return
 }
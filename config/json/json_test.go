@@ -101,3 +101,25 @@ func TestJson_Parse(t *testing.T) {
 		})
 	}
 }
+
+// TestJson_Merge testing if the slices of the env file are merged by the merge tag.
+func TestJson_Merge(t *testing.T) {
+	type db struct {
+		Name string
+		Host string
+		Port int
+	}
+	type cfg struct {
+		Databases []db     `json:"databases" merge:"key=name"`
+		Hosts     []string `json:"hosts"`
+	}
+
+	assert.NoError(t, ioutil.WriteFile("merge.json", []byte(`{"databases": [{"name": "main", "host": "db", "port": 3306}], "hosts": ["a", "b"]}`), 0644))
+	defer os.Remove("merge.json")
+	assert.NoError(t, ioutil.WriteFile("dev.merge.json", []byte(`{"databases": [{"name": "main", "host": "localhost"}, {"name": "log"}], "hosts": ["c"]}`), 0644))
+	defer os.Remove("dev.merge.json")
+
+	conf := &cfg{}
+	assert.NoError(t, json.New().Parse(conf, "dev", json.Options{Filepath: "merge.json"}))
+	assert.Equal(t, &cfg{Databases: []db{{Name: "main", Host: "localhost", Port: 3306}, {Name: "log"}}, Hosts: []string{"c"}}, conf)
+}
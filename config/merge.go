@@ -0,0 +1,242 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// TagMerge is the struct tag to define the merge strategy of a slice field.
+const TagMerge = "merge"
+
+// Merge strategies of slices. Maps and structs are always merged deep.
+const (
+	// MergeReplace replaces the slice by the one of the overlay file. This is the default.
+	MergeReplace = "replace"
+	// MergeAppend appends the elements of the overlay file.
+	MergeAppend = "append"
+	// MergeKey merges the elements with the same value of the key field, other elements are appended (merge:"key=name").
+	MergeKey = "key"
+)
+
+// Error messages.
+var (
+	ErrMergeTag = errors.New("config: merge tag %q of field %v is invalid")
+)
+
+// Merge merges the files in the given order and decodes the result into the config struct.
+// The files must be decoded into maps with the json keys of the struct (the file providers are using encoding/json to set the struct).
+// Structs and maps are merged deep, slices by the strategy of the merge tag. A null value removes the value of the files before.
+//
+//	Databases   []Database  `json:"databases" merge:"key=name"` // elements with the same name are merged, others appended.
+//	Directories []UrlSource `json:"directories" merge:"append"`
+//	Origins     []string    `json:"origins"`                     // replaced
+//
+// Error will return if a merge tag is invalid or the merged files can not be decoded.
+func Merge(config interface{}, files ...map[string]interface{}) error {
+	if reflect.ValueOf(config).Kind() != reflect.Ptr {
+		return ErrConfigPtr
+	}
+
+	var rv interface{}
+	var err error
+	for _, f := range files {
+		if f == nil {
+			continue
+		}
+		if rv == nil {
+			rv = map[string]interface{}{}
+		}
+		rv, err = mergeValue(reflect.TypeOf(config), "", "", rv, f)
+		if err != nil {
+			return err
+		}
+	}
+	if rv == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(rv)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, config)
+}
+
+// mergeValue merges the src into the dst by the type. If the type is nil, maps are merged and all other values are replaced.
+func mergeValue(t reflect.Type, tag string, path string, dst interface{}, src interface{}) (interface{}, error) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if src == nil || dst == nil {
+		return src, nil
+	}
+	// types which are set by text or are not defined by the struct.
+	if t != nil && (t == reflect.TypeOf(json.RawMessage{}) || t.Kind() == reflect.Interface || reflect.PtrTo(t).Implements(reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem())) {
+		t = nil
+	}
+
+	dm, dOk := dst.(map[string]interface{})
+	sm, sOk := src.(map[string]interface{})
+	if dOk && sOk {
+		if t != nil && t.Kind() == reflect.Struct {
+			return mergeStruct(t, path, dm, sm)
+		}
+		var elem reflect.Type
+		if t != nil && t.Kind() == reflect.Map {
+			elem = t.Elem()
+		}
+		for k, v := range sm {
+			merged, err := mergeValue(elem, "", fmt.Sprintf("%s[%s]", path, k), dm[k], v)
+			if err != nil {
+				return nil, err
+			}
+			dm[k] = merged
+		}
+		return dm, nil
+	}
+
+	ds, dOk := dst.([]interface{})
+	ss, sOk := src.([]interface{})
+	if dOk && sOk && t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		return mergeSlice(t, tag, path, ds, ss)
+	}
+	if tag != "" && tag != MergeReplace && tag != MergeAppend && !strings.HasPrefix(tag, MergeKey+"=") {
+		return nil, fmt.Errorf(ErrMergeTag.Error(), tag, path)
+	}
+	return src, nil
+}
+
+// mergeStruct merges the fields of the struct.
+// The keys are matched like encoding/json, an exact match is preferred over a case-insensitive match.
+func mergeStruct(t reflect.Type, path string, dst map[string]interface{}, src map[string]interface{}) (interface{}, error) {
+	fields := mergeFields(t)
+	for k, v := range src {
+		f, ok := fields[k]
+		if !ok {
+			for name, field := range fields {
+				if strings.EqualFold(name, k) {
+					f, ok = field, true
+					break
+				}
+			}
+		}
+		if !ok {
+			dst[k] = v
+			continue
+		}
+
+		// the existing key of the field.
+		key := k
+		if _, exists := dst[key]; !exists {
+			for dk := range dst {
+				if strings.EqualFold(dk, k) {
+					key = dk
+					break
+				}
+			}
+		}
+		merged, err := mergeValue(f.Type, f.Tag.Get(TagMerge), strings.TrimPrefix(path+"."+f.Name, "."), dst[key], v)
+		if err != nil {
+			return nil, err
+		}
+		delete(dst, key)
+		dst[k] = merged
+	}
+	return dst, nil
+}
+
+// mergeSlice merges the slices by the strategy of the tag.
+func mergeSlice(t reflect.Type, tag string, path string, dst []interface{}, src []interface{}) (interface{}, error) {
+	switch {
+	case tag == "" || tag == MergeReplace:
+		return src, nil
+	case tag == MergeAppend:
+		return append(dst, src...), nil
+	case strings.HasPrefix(tag, MergeKey+"="):
+		key := strings.TrimPrefix(tag, MergeKey+"=")
+		if key == "" {
+			break
+		}
+		for _, s := range src {
+			sk, ok := mergeKey(s, key)
+			if !ok {
+				dst = append(dst, s)
+				continue
+			}
+			found := false
+			for i, d := range dst {
+				if dk, ok := mergeKey(d, key); ok && dk == sk {
+					merged, err := mergeValue(t.Elem(), "", fmt.Sprintf("%s[%d]", path, i), d, s)
+					if err != nil {
+						return nil, err
+					}
+					dst[i] = merged
+					found = true
+					break
+				}
+			}
+			if !found {
+				dst = append(dst, s)
+			}
+		}
+		return dst, nil
+	}
+	return nil, fmt.Errorf(ErrMergeTag.Error(), tag, path)
+}
+
+// mergeKey returns the value of the key field as string.
+func mergeKey(v interface{}, key string) (string, bool) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	if val, ok := m[key]; ok && val != nil {
+		return fmt.Sprint(val), true
+	}
+	for k, val := range m {
+		if strings.EqualFold(k, key) && val != nil {
+			return fmt.Sprint(val), true
+		}
+	}
+	return "", false
+}
+
+// mergeFields returns the struct fields by their json key. Embedded structs are flattened like by encoding/json.
+func mergeFields(t reflect.Type) map[string]reflect.StructField {
+	rv := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := strings.Split(f.Tag.Get("json"), ",")[0]
+		if key == "-" {
+			continue
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && key == "" && ft.Kind() == reflect.Struct {
+			for k, ef := range mergeFields(ft) {
+				if _, ok := rv[k]; !ok {
+					rv[k] = ef
+				}
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if key == "" {
+			key = f.Name
+		}
+		rv[key] = f
+	}
+	return rv
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	encJson "encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/patrickascher/gofw/config"
+	"github.com/stretchr/testify/assert"
+)
+
+type mergeDB struct {
+	Name    string            `json:"name"`
+	Host    string            `json:"host"`
+	Port    int               `json:"port"`
+	Options map[string]string `json:"options"`
+}
+
+type mergeBase struct {
+	Origins []string `json:"origins" merge:"append"`
+}
+
+type mergeConfig struct {
+	mergeBase
+	Databases []mergeDB                    `json:"databases" merge:"key=name"`
+	Hosts     []string                     `json:"hosts"`
+	Replace   []mergeDB                    `json:"replace" merge:"replace"`
+	Labels    map[string]map[string]string `json:"labels"`
+	Extra     encJson.RawMessage           `json:"extra"`
+}
+
+// decode returns the json as map.
+func decode(t *testing.T, s string) map[string]interface{} {
+	var m map[string]interface{}
+	assert.NoError(t, encJson.Unmarshal([]byte(s), &m))
+	return m
+}
+
+func TestMerge(t *testing.T) {
+	test := assert.New(t)
+
+	base := `{
+		"origins": ["a"],
+		"databases": [{"name": "main", "host": "db", "port": 3306, "options": {"charset": "utf8", "tls": "false"}}, {"name": "log", "host": "log"}],
+		"hosts": ["a", "b"],
+		"replace": [{"name": "a", "host": "a"}, {"name": "b", "host": "b"}],
+		"labels": {"team": {"name": "core", "lead": "john"}},
+		"extra": {"a": {"b": 1}}
+	}`
+	env := `{
+		"Origins": ["b"],
+		"databases": [{"name": "main", "host": "localhost", "options": {"tls": "true"}}, {"name": "dev", "host": "dev"}, {"host": "nameless"}],
+		"hosts": ["c"],
+		"replace": [{"name": "c"}],
+		"labels": {"team": {"lead": "doe"}, "env": {"name": "dev"}},
+		"extra": {"a": {"c": 2}}
+	}`
+
+	// ok
+	cfg := &mergeConfig{}
+	test.NoError(config.Merge(cfg, decode(t, base), nil, decode(t, env)))
+	test.Equal([]string{"a", "b"}, cfg.Origins)
+	test.Equal([]mergeDB{
+		{Name: "main", Host: "localhost", Port: 3306, Options: map[string]string{"charset": "utf8", "tls": "true"}},
+		{Name: "log", Host: "log"},
+		{Name: "dev", Host: "dev"},
+		{Host: "nameless"},
+	}, cfg.Databases)
+	test.Equal([]string{"c"}, cfg.Hosts)
+	test.Equal([]mergeDB{{Name: "c"}}, cfg.Replace)
+	test.Equal(map[string]map[string]string{"team": {"name": "core", "lead": "doe"}, "env": {"name": "dev"}}, cfg.Labels)
+	test.JSONEq(`{"a": {"b": 1, "c": 2}}`, string(cfg.Extra))
+
+	// ok: null removes the value
+	cfg = &mergeConfig{}
+	test.NoError(config.Merge(cfg, decode(t, base), decode(t, `{"hosts": null, "labels": {"team": null}}`)))
+	test.Nil(cfg.Hosts)
+	test.Equal(map[string]map[string]string{"team": nil}, cfg.Labels)
+
+	// error: invalid tag
+	type invalid struct {
+		Hosts []string `json:"hosts" merge:"prepend"`
+	}
+	err := config.Merge(&invalid{}, decode(t, `{"hosts": ["a"]}`), decode(t, `{"hosts": ["b"]}`))
+	test.Equal(fmt.Sprintf(config.ErrMergeTag.Error(), "prepend", "Hosts"), err.Error())
+
+	// error: no ptr
+	test.Equal(config.ErrConfigPtr, config.Merge(mergeConfig{}))
+}
@@ -0,0 +1,564 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TagDescription is the struct tag to define the description of a field in Schema and Example.
+const TagDescription = "description"
+
+// SchemaDraft is the JSON Schema version of Schema.
+const SchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// formats of the validate tags.
+var schemaFormats = map[string]string{
+	"email":    "email",
+	"url":      "uri",
+	"uri":      "uri",
+	"hostname": "hostname",
+	"ipv4":     "ipv4",
+	"ipv6":     "ipv6",
+	"uuid":     "uuid",
+}
+
+// plainKey matches the yaml keys which need no quotes.
+var plainKey = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// schema is a JSON Schema node.
+type schema struct {
+	Schema               string        `json:"$schema,omitempty"`
+	Title                string        `json:"title,omitempty"`
+	Description          string        `json:"description,omitempty"`
+	Type                 string        `json:"type,omitempty"`
+	Format               string        `json:"format,omitempty"`
+	Properties           *properties   `json:"properties,omitempty"`
+	AdditionalProperties *schema       `json:"additionalProperties,omitempty"`
+	Items                *schema       `json:"items,omitempty"`
+	Required             []string      `json:"required,omitempty"`
+	Enum                 []interface{} `json:"enum,omitempty"`
+	Default              interface{}   `json:"default,omitempty"`
+	Minimum              *float64      `json:"minimum,omitempty"`
+	Maximum              *float64      `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64      `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64      `json:"exclusiveMaximum,omitempty"`
+	MinLength            *int          `json:"minLength,omitempty"`
+	MaxLength            *int          `json:"maxLength,omitempty"`
+	MinItems             *int          `json:"minItems,omitempty"`
+	MaxItems             *int          `json:"maxItems,omitempty"`
+	MinProperties        *int          `json:"minProperties,omitempty"`
+	MaxProperties        *int          `json:"maxProperties,omitempty"`
+}
+
+// properties of an object schema in the order of the struct fields.
+type properties struct {
+	keys   []string
+	values map[string]*schema
+}
+
+// add a property. An existing key is replaced.
+func (p *properties) add(key string, s *schema) {
+	if _, ok := p.values[key]; !ok {
+		p.keys = append(p.keys, key)
+	}
+	p.values[key] = s
+}
+
+// MarshalJSON encodes the properties in the order of the struct fields.
+func (p *properties) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString("{")
+	for i, k := range p.keys {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		val, err := json.Marshal(p.values[k])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteString(":")
+		b.Write(val)
+	}
+	b.WriteString("}")
+	return b.Bytes(), nil
+}
+
+// Schema returns the JSON Schema (draft-07) of the config struct.
+// The keys are defined by the json tags, the constraints by the validate tags (required, min, max, len, gt, gte, lt, lte, oneof,
+// email, url, uri, hostname, ipv4, ipv6, uuid and dive for the elements). The description and default tag are added.
+// Like this editors can autocomplete and CI can validate config files before a deploy.
+func Schema(config interface{}) ([]byte, error) {
+	s, err := schemaOf(config)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// Example returns an annotated yaml example of the config struct.
+// The values of the given config are used, empty struct slices get one example element.
+// Every key is commented with its description and the constraints of the Schema. The file can be loaded by the yaml provider.
+func Example(config interface{}) ([]byte, error) {
+	s, err := schemaOf(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// the values are encoded by json, like the providers are decoding them.
+	b, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v interface{}
+	err = dec.Decode(&v)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	out.WriteString(fmt.Sprintf("# Example of %s.\n", s.Title))
+	if m, ok := v.(map[string]interface{}); ok {
+		exampleObject(&out, s, m, 0)
+	}
+	return out.Bytes(), nil
+}
+
+// schemaOf returns the schema of the config struct.
+func schemaOf(config interface{}) (*schema, error) {
+	t := reflect.TypeOf(config)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, ErrConfigPtr
+	}
+
+	s := typeSchema(t, make(map[reflect.Type]bool))
+	s.Schema = SchemaDraft
+	s.Title = t.Name()
+	return s, nil
+}
+
+// typeSchema returns the schema of the type. Nil will return if the type can not be encoded.
+// Recursive structs are added as object without properties.
+func typeSchema(t reflect.Type, seen map[reflect.Type]bool) *schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return &schema{Type: "string", Format: "date-time"}
+	case reflect.TypeOf(json.RawMessage{}):
+		return &schema{}
+	}
+	if reflect.PtrTo(t).Implements(reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()) {
+		return &schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &schema{Type: "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &schema{Type: "integer", Minimum: float(0)}
+	case reflect.Float32, reflect.Float64:
+		return &schema{Type: "number"}
+	case reflect.String:
+		return &schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &schema{Type: "string"}
+		}
+		items := typeSchema(t.Elem(), seen)
+		if items == nil {
+			return nil
+		}
+		return &schema{Type: "array", Items: items}
+	case reflect.Map:
+		values := typeSchema(t.Elem(), seen)
+		if values == nil {
+			return nil
+		}
+		return &schema{Type: "object", AdditionalProperties: values}
+	case reflect.Struct:
+		s := &schema{Type: "object"}
+		if seen[t] {
+			return s
+		}
+		seen[t] = true
+		s.Properties = &properties{values: make(map[string]*schema)}
+		structSchema(t, s, seen)
+		delete(seen, t)
+		return s
+	case reflect.Interface:
+		return &schema{}
+	}
+	return nil
+}
+
+// structSchema adds the fields of the struct as properties.
+// Embedded structs without a json name are added to the same object.
+func structSchema(t reflect.Type, s *schema, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			structSchema(ft, s, seen)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		fs := typeSchema(f.Type, seen)
+		if fs == nil {
+			continue
+		}
+		fs.Description = f.Tag.Get(TagDescription)
+		if tag, ok := f.Tag.Lookup(TagDefault); ok {
+			v := reflect.New(f.Type).Elem()
+			if err := setString(v, tag); err == nil {
+				fs.Default = v.Interface()
+			}
+		}
+		if validateSchema(fs, f.Tag.Get("validate")) {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties.add(name, fs)
+	}
+}
+
+// validateSchema adds the constraints of the validate tag to the schema.
+// True will return if the field is required. Rules after dive are added to the elements.
+func validateSchema(s *schema, tag string) bool {
+	required := false
+	rules := strings.Split(tag, ",")
+	for i, rule := range rules {
+		if rule == "dive" {
+			if s.Items != nil {
+				validateSchema(s.Items, strings.Join(rules[i+1:], ","))
+			} else if s.AdditionalProperties != nil {
+				validateSchema(s.AdditionalProperties, strings.Join(rules[i+1:], ","))
+			}
+			break
+		}
+		// alternatives are not supported.
+		if strings.Contains(rule, "|") {
+			continue
+		}
+
+		name, param := rule, ""
+		if n := strings.Index(rule, "="); n >= 0 {
+			name, param = rule[:n], rule[n+1:]
+		}
+		switch name {
+		case "required":
+			required = true
+		case "oneof":
+			for _, e := range strings.Fields(param) {
+				if s.Type == "integer" || s.Type == "number" {
+					if f, err := strconv.ParseFloat(e, 64); err == nil {
+						s.Enum = append(s.Enum, f)
+						continue
+					}
+				}
+				s.Enum = append(s.Enum, e)
+			}
+		case "min", "max", "len", "gt", "gte", "lt", "lte":
+			f, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				continue
+			}
+			schemaLimit(s, name, f)
+		default:
+			if format, ok := schemaFormats[name]; ok {
+				s.Format = format
+			}
+		}
+	}
+	return required
+}
+
+// schemaLimit adds the limit by the schema type.
+// Strings, arrays and objects are limited by their length, numbers by their value.
+func schemaLimit(s *schema, rule string, f float64) {
+	if s.Type == "integer" || s.Type == "number" {
+		switch rule {
+		case "min", "gte":
+			s.Minimum = float(f)
+		case "max", "lte":
+			s.Maximum = float(f)
+		case "len":
+			s.Minimum, s.Maximum = float(f), float(f)
+		case "gt":
+			s.ExclusiveMinimum = float(f)
+		case "lt":
+			s.ExclusiveMaximum = float(f)
+		}
+		return
+	}
+
+	var min, max **int
+	switch s.Type {
+	case "string":
+		min, max = &s.MinLength, &s.MaxLength
+	case "array":
+		min, max = &s.MinItems, &s.MaxItems
+	case "object":
+		min, max = &s.MinProperties, &s.MaxProperties
+	default:
+		return
+	}
+	n := int(f)
+	switch rule {
+	case "min", "gte":
+		*min = &n
+	case "max", "lte":
+		*max = &n
+	case "len":
+		*min, *max = &n, &n
+	case "gt":
+		n++
+		*min = &n
+	case "lt":
+		n--
+		*max = &n
+	}
+}
+
+// float returns a pointer of the value.
+func float(f float64) *float64 {
+	return &f
+}
+
+// exampleObject writes the properties of the object with their comments.
+// Keys which are not defined in the schema (maps) are added sorted.
+func exampleObject(out *bytes.Buffer, s *schema, m map[string]interface{}, indent int) {
+	var keys []string
+	if s.Properties != nil {
+		keys = append(keys, s.Properties.keys...)
+	}
+	var other []string
+	for k := range m {
+		if s.Properties == nil || s.Properties.values[k] == nil {
+			other = append(other, k)
+		}
+	}
+	sort.Strings(other)
+	keys = append(keys, other...)
+
+	for _, k := range keys {
+		var ps *schema
+		if s.Properties != nil {
+			ps = s.Properties.values[k]
+		}
+		if ps == nil {
+			ps = s.AdditionalProperties
+		}
+		if ps == nil {
+			ps = &schema{}
+		}
+		if ps != s.AdditionalProperties {
+			exampleComment(out, ps, requiredKey(s, k), indent)
+		}
+		exampleKey(out, k, indent)
+		exampleValue(out, ps, m[k], indent)
+	}
+}
+
+// exampleValue writes the value after the key.
+func exampleValue(out *bytes.Buffer, s *schema, v interface{}, indent int) {
+	// nil values and empty struct slices are added by the schema.
+	if v == nil && s.Type != "" {
+		v = skeleton(s)
+	}
+	if a, ok := v.([]interface{}); ok && len(a) == 0 && s.Items != nil && s.Items.Properties != nil {
+		v = []interface{}{skeleton(s.Items)}
+	}
+
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if len(val) == 0 {
+			out.WriteString(" {}\n")
+			return
+		}
+		out.WriteString("\n")
+		exampleObject(out, s, val, indent+2)
+	case []interface{}:
+		if len(val) == 0 {
+			out.WriteString(" []\n")
+			return
+		}
+		out.WriteString("\n")
+		items := s.Items
+		if items == nil {
+			items = &schema{}
+		}
+		for i, e := range val {
+			out.WriteString(strings.Repeat(" ", indent+2) + "-")
+			if m, ok := e.(map[string]interface{}); ok && len(m) > 0 {
+				// the first key is written in the line of the dash.
+				var b bytes.Buffer
+				if i > 0 {
+					// the comments are only added to the first element.
+					items = &schema{Properties: items.Properties, AdditionalProperties: items.AdditionalProperties}
+					items.Properties = withoutComments(items.Properties)
+				}
+				exampleObject(&b, items, m, indent+4)
+				out.WriteString(" " + strings.TrimLeft(b.String(), " "))
+				continue
+			}
+			exampleValue(out, items, e, indent+2)
+		}
+	default:
+		out.WriteString(" " + scalar(val) + "\n")
+	}
+}
+
+// exampleKey writes the indented key.
+func exampleKey(out *bytes.Buffer, k string, indent int) {
+	if !plainKey.MatchString(k) {
+		k = scalar(k)
+	}
+	out.WriteString(strings.Repeat(" ", indent) + k + ":")
+}
+
+// exampleComment writes the description and the constraints of the schema as comment.
+func exampleComment(out *bytes.Buffer, s *schema, required bool, indent int) {
+	prefix := strings.Repeat(" ", indent) + "# "
+	if s.Description != "" {
+		out.WriteString(prefix + s.Description + "\n")
+	}
+
+	var c []string
+	if s.Type != "" {
+		c = append(c, s.Type)
+	}
+	if required {
+		c = append(c, "required")
+	}
+	if s.Format != "" {
+		c = append(c, "format: "+s.Format)
+	}
+	if len(s.Enum) > 0 {
+		e := make([]string, len(s.Enum))
+		for i := range s.Enum {
+			e[i] = fmt.Sprint(s.Enum[i])
+		}
+		c = append(c, "one of: "+strings.Join(e, ", "))
+	}
+	for _, l := range []struct {
+		name string
+		val  interface{}
+	}{
+		{"minimum", s.Minimum}, {"maximum", s.Maximum}, {"exclusive minimum", s.ExclusiveMinimum}, {"exclusive maximum", s.ExclusiveMaximum},
+		{"min length", s.MinLength}, {"max length", s.MaxLength}, {"min items", s.MinItems}, {"max items", s.MaxItems},
+		{"min properties", s.MinProperties}, {"max properties", s.MaxProperties},
+	} {
+		rv := reflect.ValueOf(l.val)
+		if !rv.IsNil() {
+			c = append(c, fmt.Sprintf("%s: %v", l.name, rv.Elem().Interface()))
+		}
+	}
+	if s.Default != nil {
+		c = append(c, "default: "+scalar(s.Default))
+	}
+	if len(c) > 0 {
+		out.WriteString(prefix + strings.Join(c, ", ") + "\n")
+	}
+}
+
+// requiredKey returns true if the key is required by the object.
+func requiredKey(s *schema, k string) bool {
+	for _, r := range s.Required {
+		if r == k {
+			return true
+		}
+	}
+	return false
+}
+
+// withoutComments returns a copy of the properties without descriptions and constraints, but with the nested structure.
+func withoutComments(p *properties) *properties {
+	if p == nil {
+		return nil
+	}
+	rv := &properties{values: make(map[string]*schema)}
+	for _, k := range p.keys {
+		s := p.values[k]
+		rv.add(k, &schema{Type: s.Type, Items: s.Items, AdditionalProperties: s.AdditionalProperties, Properties: s.Properties})
+	}
+	return rv
+}
+
+// skeleton returns an example value of the schema. The default or the zero value of the type is used.
+func skeleton(s *schema) interface{} {
+	if s.Default != nil {
+		return s.Default
+	}
+	switch s.Type {
+	case "object":
+		m := make(map[string]interface{})
+		if s.Properties != nil {
+			for _, k := range s.Properties.keys {
+				m[k] = skeleton(s.Properties.values[k])
+			}
+		}
+		return m
+	case "array":
+		return []interface{}{}
+	case "string":
+		return ""
+	case "integer", "number":
+		return 0
+	case "boolean":
+		return false
+	}
+	return nil
+}
+
+// scalar returns the value as json, which is a valid yaml scalar.
+func scalar(v interface{}) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return "null"
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,99 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	encJson "encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/patrickascher/gofw/config"
+	"github.com/patrickascher/gofw/config/yaml"
+	"github.com/stretchr/testify/assert"
+)
+
+type schemaDB struct {
+	Host string `json:"host" validate:"required,hostname"`
+	Port int    `json:"port" validate:"min=1,max=65535" default:"3306"`
+}
+
+type schemaBase struct {
+	Name string `json:"name" validate:"required" description:"Name of the application."`
+}
+
+type schemaConfig struct {
+	schemaBase
+	Mode      string            `json:"mode" validate:"oneof=dev prod"`
+	Admin     string            `json:"admin" validate:"omitempty,email"`
+	Timeout   time.Duration     `json:"timeout"`
+	Origins   []string          `json:"origins" validate:"min=1,dive,url"`
+	Databases []schemaDB        `json:"databases"`
+	Labels    map[string]string `json:"labels"`
+	Replica   *schemaDB         `json:"replica,omitempty"`
+	Options   encJson.RawMessage
+	Ignored   string `json:"-"`
+}
+
+func TestSchema(t *testing.T) {
+	test := assert.New(t)
+
+	// error: no struct
+	_, err := config.Schema("abc")
+	test.Equal(config.ErrConfigPtr, err)
+
+	// ok
+	b, err := config.Schema(&schemaConfig{})
+	test.NoError(err)
+	var s map[string]interface{}
+	test.NoError(encJson.Unmarshal(b, &s))
+	test.Equal(config.SchemaDraft, s["$schema"])
+	test.Equal("schemaConfig", s["title"])
+	test.Equal([]interface{}{"name"}, s["required"])
+
+	props := s["properties"].(map[string]interface{})
+	test.Equal(9, len(props))
+	test.Equal(map[string]interface{}{"type": "string", "description": "Name of the application."}, props["name"])
+	test.Equal(map[string]interface{}{"type": "string", "enum": []interface{}{"dev", "prod"}}, props["mode"])
+	test.Equal(map[string]interface{}{"type": "string", "format": "email"}, props["admin"])
+	test.Equal(map[string]interface{}{"type": "integer"}, props["timeout"])
+	test.Equal(map[string]interface{}{"type": "array", "minItems": float64(1), "items": map[string]interface{}{"type": "string", "format": "uri"}}, props["origins"])
+	test.Equal(map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "string"}}, props["labels"])
+	test.Equal(map[string]interface{}{}, props["Options"])
+	db := map[string]interface{}{
+		"type":     "object",
+		"required": []interface{}{"host"},
+		"properties": map[string]interface{}{
+			"host": map[string]interface{}{"type": "string", "format": "hostname"},
+			"port": map[string]interface{}{"type": "integer", "minimum": float64(1), "maximum": float64(65535), "default": float64(3306)},
+		},
+	}
+	test.Equal(map[string]interface{}{"type": "array", "items": db}, props["databases"])
+	test.Equal(db, props["replica"])
+}
+
+func TestExample(t *testing.T) {
+	test := assert.New(t)
+
+	cfg := &schemaConfig{schemaBase: schemaBase{Name: "app"}, Mode: "dev", Origins: []string{"https://example.com"}, Labels: map[string]string{"team": "core"}}
+	b, err := config.Example(cfg)
+	test.NoError(err)
+	test.Contains(string(b), "# Name of the application.\n# string, required\nname: \"app\"\n")
+	test.Contains(string(b), "# string, one of: dev, prod\nmode: \"dev\"\n")
+	test.Contains(string(b), "databases:\n  - # string, required, format: hostname\n    host: \"\"\n    # integer, minimum: 1, maximum: 65535, default: 3306\n    port: 3306\n")
+	test.Contains(string(b), "labels:\n  team: \"core\"\n")
+
+	// ok: the example can be loaded
+	test.NoError(ioutil.WriteFile("example.yaml", b, 0644))
+	defer os.Remove("example.yaml")
+	loaded := &schemaConfig{}
+	err = config.New(config.YAML, loaded, yaml.Options{Filepath: "example.yaml"})
+	test.Error(err) // the example database host is empty.
+	test.Equal("app", loaded.Name)
+	test.Equal([]string{"https://example.com"}, loaded.Origins)
+	test.Equal([]schemaDB{{Port: 3306}}, loaded.Databases)
+	test.Equal(map[string]string{"team": "core"}, loaded.Labels)
+}
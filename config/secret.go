@@ -0,0 +1,476 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Pre-defined resolvers.
+const (
+	// ResolverEnv resolves ${env:NAME} by the environment variable.
+	ResolverEnv = "env"
+	// ResolverFile resolves ${file:/path} by the file content. Trailing line breaks are removed.
+	ResolverFile = "file"
+	// ResolverConfig resolves ${config:server.domain} by another field of the config.
+	ResolverConfig = "config"
+)
+
+// TagSecret is the struct tag to mask a field in Masked.
+const TagSecret = "secret"
+
+// Mask is the replacement of secret values.
+const Mask = "******"
+
+// maxResolveDepth limits nested config references.
+const maxResolveDepth = 10
+
+// Error messages.
+var (
+	ErrNoResolver      = errors.New("config: empty scheme or resolver is nil")
+	ErrResolve         = errors.New("config: field %v could not be resolved: %v")
+	ErrResolver        = errors.New("config: resolver %v is not registered")
+	ErrResolverExists  = errors.New("config: resolver %v is already registered")
+	ErrResolveEnv      = errors.New("config: environment variable %v is not set")
+	ErrResolveConfig   = errors.New("config: path %v does not exist")
+	ErrResolveDepth    = errors.New("config: reference %v is nested too deep or cyclic")
+	ErrResolveNotClose = errors.New("config: reference %v is not closed")
+)
+
+// Resolver returns the value of the reference argument.
+// The config is passed, so that a resolver can refer to other fields.
+// If secret is true, the value is masked by MaskString and the field by Masked.
+type Resolver func(arg string, config interface{}) (value string, secret bool, err error)
+
+// resolvers by scheme.
+var resolvers = map[string]Resolver{
+	ResolverEnv:    resolveEnv,
+	ResolverFile:   resolveFile,
+	ResolverConfig: resolveConfig,
+}
+
+// secrets holds the secret values and the field paths, which contain a resolved secret, of each config.
+// The state of a config is replaced if it is resolved again and removed by Release.
+var secrets = struct {
+	sync.RWMutex
+	values map[interface{}]map[string]struct{}
+	paths  map[interface{}]map[string]struct{}
+}{values: make(map[interface{}]map[string]struct{}), paths: make(map[interface{}]map[string]struct{})}
+
+// RegisterResolver adds a resolver for the scheme (${scheme:arg}).
+// Error will return if the scheme is already registered.
+func RegisterResolver(scheme string, fn Resolver) error {
+	if scheme == "" || fn == nil {
+		return ErrNoResolver
+	}
+	if _, ok := resolvers[scheme]; ok {
+		return fmt.Errorf(ErrResolverExists.Error(), scheme)
+	}
+	resolvers[scheme] = fn
+	return nil
+}
+
+// resolve replaces all references and decrypts all encrypted values in the string fields of the config.
+// Strings in structs, pointers, slices and map values are resolved, $${ can be used to escape a reference.
+// The values of fields with the tag secret:"true" and resolved secret values are added to the secrets.
+func resolve(config interface{}) error {
+	releaseSecrets(config)
+	return resolveValue(reflect.ValueOf(config), "", config, false)
+}
+
+// releaseSecrets removes the secret values and paths of the config.
+func releaseSecrets(config interface{}) {
+	secrets.Lock()
+	delete(secrets.values, config)
+	delete(secrets.paths, config)
+	secrets.Unlock()
+}
+
+// resolveValue resolves the value recursively.
+// If secret is true, the value belongs to a field with the secret tag.
+func resolveValue(v reflect.Value, path string, config interface{}, secret bool) error {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Kind() == reflect.Interface {
+			// values of an interface are not addressable.
+			if s, ok := v.Interface().(string); ok && v.CanSet() {
+				r, err := resolveSecret(s, path, config, secret)
+				if err != nil {
+					return err
+				}
+				v.Set(reflect.ValueOf(r))
+			}
+			return nil
+		}
+		return resolveValue(v.Elem(), path, config, secret)
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			tagged, _ := strconv.ParseBool(f.Tag.Get(TagSecret))
+			if err := resolveValue(v.Field(i), strings.TrimPrefix(path+"."+f.Name, "."), config, secret || tagged); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := resolveValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i), config, secret); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			return nil
+		}
+		for _, k := range v.MapKeys() {
+			s := v.MapIndex(k).String()
+			r, err := resolveSecret(s, fmt.Sprintf("%s[%v]", path, k), config, secret)
+			if err != nil {
+				return err
+			}
+			if r != s {
+				v.SetMapIndex(k, reflect.ValueOf(r).Convert(v.Type().Elem()))
+			}
+		}
+	case reflect.String:
+		if !v.CanSet() {
+			return nil
+		}
+		r, err := resolveSecret(v.String(), path, config, secret)
+		if err != nil {
+			return err
+		}
+		v.SetString(r)
+	}
+	return nil
+}
+
+// resolveSecret resolves the string and adds it to the secrets if the field is tagged or a secret was resolved.
+// The path of a resolved secret is added to the config, like this Masked can mask the field.
+func resolveSecret(s string, path string, config interface{}, tagged bool) (string, error) {
+	r, secret, err := resolveString(s, path, config, 0)
+	if err != nil {
+		return "", err
+	}
+	if secret || tagged {
+		addSecret(config, r)
+	}
+	if secret {
+		secrets.Lock()
+		if secrets.paths[config] == nil {
+			secrets.paths[config] = make(map[string]struct{})
+		}
+		secrets.paths[config][path] = struct{}{}
+		secrets.Unlock()
+	}
+	return r, nil
+}
+
+// resolveString replaces all references of the string.
+// Encrypted values (enc:...) are decrypted with the key of the environment (see Key) and are handled as secret.
+// True will return if the string contains a secret.
+func resolveString(s string, path string, config interface{}, depth int) (string, bool, error) {
+	if strings.HasPrefix(s, EncPrefix) {
+		val, err := decrypt(s)
+		if err != nil {
+			return "", false, fmt.Errorf(ErrResolve.Error(), path, err)
+		}
+		return val, true, nil
+	}
+	if !strings.Contains(s, "${") {
+		return s, false, nil
+	}
+	if depth > maxResolveDepth {
+		return "", false, fmt.Errorf(ErrResolve.Error(), path, fmt.Errorf(ErrResolveDepth.Error(), s))
+	}
+
+	rvSecret := false
+	var b strings.Builder
+	for {
+		n := strings.Index(s, "${")
+		if n < 0 {
+			b.WriteString(s)
+			break
+		}
+		// escaped
+		if n > 0 && s[n-1] == '$' {
+			b.WriteString(s[:n-1] + "${")
+			s = s[n+2:]
+			continue
+		}
+		b.WriteString(s[:n])
+		end := strings.Index(s[n:], "}")
+		if end < 0 {
+			return "", false, fmt.Errorf(ErrResolve.Error(), path, fmt.Errorf(ErrResolveNotClose.Error(), s[n:]))
+		}
+		ref := s[n+2 : n+end]
+		s = s[n+end+1:]
+
+		// no scheme, the reference is kept.
+		sep := strings.Index(ref, ":")
+		if sep < 0 {
+			b.WriteString("${" + ref + "}")
+			continue
+		}
+		fn, ok := resolvers[ref[:sep]]
+		if !ok {
+			return "", false, fmt.Errorf(ErrResolve.Error(), path, fmt.Errorf(ErrResolver.Error(), ref[:sep]))
+		}
+		val, secret, err := fn(ref[sep+1:], config)
+		if err != nil {
+			return "", false, fmt.Errorf(ErrResolve.Error(), path, err)
+		}
+		// the value of a config reference can contain references.
+		if ref[:sep] == ResolverConfig {
+			var nested bool
+			val, nested, err = resolveString(val, path, config, depth+1)
+			if err != nil {
+				return "", false, err
+			}
+			secret = secret || nested
+		}
+		rvSecret = rvSecret || secret
+		b.WriteString(val)
+	}
+	return b.String(), rvSecret, nil
+}
+
+// resolveEnv returns the environment variable.
+// The value is not handled as secret, a field with a secret must have the tag secret:"true".
+func resolveEnv(arg string, config interface{}) (string, bool, error) {
+	val, ok := os.LookupEnv(arg)
+	if !ok {
+		return "", false, fmt.Errorf(ErrResolveEnv.Error(), arg)
+	}
+	return val, false, nil
+}
+
+// resolveFile returns the file content without trailing line breaks.
+// The value is not handled as secret, a field with a secret must have the tag secret:"true".
+func resolveFile(arg string, config interface{}) (string, bool, error) {
+	b, err := ioutil.ReadFile(arg)
+	if err != nil {
+		return "", false, err
+	}
+	return strings.TrimRight(string(b), "\r\n"), false, nil
+}
+
+// resolveConfig returns the value of the config path.
+// The path is separated by a dot, the json tag or field name can be used case-insensitive. Slice elements are defined by their index.
+// The value is handled as secret, if a field of the path has the tag secret:"true".
+func resolveConfig(arg string, config interface{}) (string, bool, error) {
+	v, secret, ok := lookupPath(reflect.ValueOf(config), strings.Split(arg, "."))
+	if !ok {
+		return "", false, fmt.Errorf(ErrResolveConfig.Error(), arg)
+	}
+	if v.Kind() == reflect.String {
+		return v.String(), secret, nil
+	}
+	return fmt.Sprint(v.Interface()), secret, nil
+}
+
+// lookupPath returns the value of the path and if a field of the path has the secret tag.
+func lookupPath(v reflect.Value, path []string) (reflect.Value, bool, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return v, false, false
+		}
+		v = v.Elem()
+	}
+	if len(path) == 0 {
+		return v, false, true
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			key := strings.Split(f.Tag.Get("json"), ",")[0]
+			if strings.EqualFold(key, path[0]) || strings.EqualFold(f.Name, path[0]) {
+				rv, secret, ok := lookupPath(v.Field(i), path[1:])
+				tagged, _ := strconv.ParseBool(f.Tag.Get(TagSecret))
+				return rv, secret || tagged, ok
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		i, err := strconv.Atoi(path[0])
+		if err == nil && i >= 0 && i < v.Len() {
+			return lookupPath(v.Index(i), path[1:])
+		}
+	case reflect.Map:
+		if v.Type().Key().Kind() == reflect.String {
+			if val := v.MapIndex(reflect.ValueOf(path[0]).Convert(v.Type().Key())); val.IsValid() {
+				return lookupPath(val, path[1:])
+			}
+		}
+	}
+	return v, false, false
+}
+
+// addSecret adds the value to the secrets of the config. Empty values are ignored.
+func addSecret(config interface{}, val string) {
+	if val == "" {
+		return
+	}
+	secrets.Lock()
+	defer secrets.Unlock()
+	if secrets.values[config] == nil {
+		secrets.values[config] = make(map[string]struct{})
+	}
+	secrets.values[config][val] = struct{}{}
+}
+
+// MaskString replaces the secret values of all configs in the string by the Mask.
+// Secret values are the values of fields with the tag secret:"true", decrypted values and values of resolvers which are returning a secret.
+// A value is only replaced if it is not part of a word, like this a short secret (e.g. "1") does not mask the digits of other values.
+// The longest values are replaced first.
+// It can be used for log messages, which may contain a secret (e.g. a database dsn). The logger can use it by the Mask option.
+func MaskString(s string) string {
+	secrets.RLock()
+	var values []string
+	for _, v := range secrets.values {
+		for val := range v {
+			values = append(values, val)
+		}
+	}
+	secrets.RUnlock()
+
+	sort.Slice(values, func(i, j int) bool {
+		return len(values[i]) > len(values[j])
+	})
+	for _, val := range values {
+		s = maskValue(s, val)
+	}
+	return s
+}
+
+// maskValue replaces all occurrences of the value, which are not preceded or followed by a letter, digit or underscore.
+func maskValue(s string, val string) string {
+	var b strings.Builder
+	for {
+		n := strings.Index(s, val)
+		if n < 0 {
+			break
+		}
+		before, _ := utf8.DecodeLastRuneInString(s[:n])
+		after, _ := utf8.DecodeRuneInString(s[n+len(val):])
+		if (n > 0 && isWord(before)) || (n+len(val) < len(s) && isWord(after)) {
+			// the rest is searched after the first rune of the match.
+			_, size := utf8.DecodeRuneInString(s[n:])
+			b.WriteString(s[:n+size])
+			s = s[n+size:]
+			continue
+		}
+		b.WriteString(s[:n] + Mask)
+		s = s[n+len(val):]
+	}
+	b.WriteString(s)
+	return b.String()
+}
+
+// isWord returns true if the rune is a letter, digit or underscore.
+func isWord(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Masked returns the config as indented json, where all fields with the tag secret:"true" and fields which contain a resolved
+// secret are masked. The fields are masked by their path, other values are not changed.
+func Masked(config interface{}) (string, error) {
+	b, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	var m interface{}
+	err = json.Unmarshal(b, &m)
+	if err != nil {
+		return "", err
+	}
+	secrets.RLock()
+	m = maskTagged(reflect.TypeOf(config), m, "", secrets.paths[config])
+	secrets.RUnlock()
+	b, err = json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// maskTagged masks the json values of all fields with the secret tag and of the given paths.
+func maskTagged(t reflect.Type, v interface{}, path string, paths map[string]struct{}) interface{} {
+	if _, ok := paths[path]; ok && v != nil {
+		return Mask
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return v
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			key := strings.Split(f.Tag.Get("json"), ",")[0]
+			if f.PkgPath != "" || key == "-" {
+				continue
+			}
+			p := strings.TrimPrefix(path+"."+f.Name, ".")
+			if f.Anonymous && key == "" {
+				maskTagged(f.Type, m, p, paths)
+				continue
+			}
+			if key == "" {
+				key = f.Name
+			}
+			if _, ok := m[key]; !ok {
+				continue
+			}
+			if secret, _ := strconv.ParseBool(f.Tag.Get(TagSecret)); secret {
+				m[key] = Mask
+				continue
+			}
+			m[key] = maskTagged(f.Type, m[key], p, paths)
+		}
+	case reflect.Slice, reflect.Array:
+		if s, ok := v.([]interface{}); ok {
+			for i := range s {
+				s[i] = maskTagged(t.Elem(), s[i], fmt.Sprintf("%s[%d]", path, i), paths)
+			}
+		}
+	case reflect.Map:
+		if m, ok := v.(map[string]interface{}); ok {
+			for k := range m {
+				m[k] = maskTagged(t.Elem(), m[k], fmt.Sprintf("%s[%v]", path, k), paths)
+			}
+		}
+	}
+	return v
+}
@@ -0,0 +1,166 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/patrickascher/gofw/config"
+	"github.com/patrickascher/gofw/sqlquery"
+	"github.com/stretchr/testify/assert"
+)
+
+type secretServer struct {
+	Domain string `json:"domain"`
+	URL    string `json:"url"`
+}
+
+type secretConfig struct {
+	Server    secretServer       `json:"server"`
+	Databases []*sqlquery.Config `json:"databases"`
+	Labels    map[string]string  `json:"labels"`
+	APIKey    string             `json:"apiKey" secret:"true"`
+	Template  string             `json:"template"`
+}
+
+// refProvider sets the config of the test.
+type refProvider struct{}
+
+func (refProvider) Parse(conf interface{}, env string, opt interface{}) error {
+	*conf.(*secretConfig) = opt.(secretConfig)
+	return nil
+}
+
+func TestNew_Resolve(t *testing.T) {
+	_ = config.Register("ref", func() config.Interface { return refProvider{} })
+	test := assert.New(t)
+
+	test.NoError(ioutil.WriteFile("db.secret", []byte("file-pass\n"), 0644))
+	defer os.Remove("db.secret")
+	test.NoError(os.Setenv("TEST_DB_USER", "env-user"))
+	defer os.Unsetenv("TEST_DB_USER")
+
+	// ok: env, file and config references
+	cfg := &secretConfig{}
+	err := config.New("ref", cfg, secretConfig{
+		Server:    secretServer{Domain: "example.com", URL: "https://${config:server.domain}/api"},
+		Databases: []*sqlquery.Config{{Username: "${env:TEST_DB_USER}", Password: "${file:db.secret}", Host: "${config:server.url}"}},
+		Labels:    map[string]string{"user": "${config:databases.0.username}"},
+		APIKey:    "plain-key",
+		Template:  "$${env:TEST_DB_USER} ${name}",
+	})
+	test.NoError(err)
+	test.Equal("https://example.com/api", cfg.Server.URL)
+	test.Equal("env-user", cfg.Databases[0].Username)
+	test.Equal("file-pass", cfg.Databases[0].Password)
+	test.Equal("https://example.com/api", cfg.Databases[0].Host)
+	test.Equal(map[string]string{"user": "env-user"}, cfg.Labels)
+	test.Equal("${env:TEST_DB_USER} ${name}", cfg.Template)
+
+	// ok: values of secret fields are masked, env values are not secret
+	test.Equal("dsn: env-user:******@tcp(localhost)", config.MaskString("dsn: env-user:file-pass@tcp(localhost)"))
+	test.Equal("example.com", config.MaskString("example.com"))
+	masked, err := config.Masked(cfg)
+	test.NoError(err)
+	test.Contains(masked, `"password": "******"`)
+	test.Contains(masked, `"apiKey": "******"`)
+	test.Contains(masked, `"domain": "example.com"`)
+	test.Contains(masked, `"username": "env-user"`)
+	test.False(strings.Contains(masked, "file-pass"))
+	test.False(strings.Contains(masked, "plain-key"))
+
+	// error: the field path is part of the error
+	var tests = []struct {
+		ref string
+		err error
+	}{
+		{ref: "${env:TEST_NOT_EXISTING}", err: fmt.Errorf(config.ErrResolveEnv.Error(), "TEST_NOT_EXISTING")},
+		{ref: "${config:server.none}", err: fmt.Errorf(config.ErrResolveConfig.Error(), "server.none")},
+		{ref: "${unknown:foo}", err: fmt.Errorf(config.ErrResolver.Error(), "unknown")},
+		{ref: "${env:TEST_DB_USER", err: fmt.Errorf(config.ErrResolveNotClose.Error(), "${env:TEST_DB_USER")},
+		{ref: "${config:databases.0.password}", err: fmt.Errorf(config.ErrResolveDepth.Error(), "${config:databases.0.password}")},
+	}
+	for _, tt := range tests {
+		err = config.New("ref", &secretConfig{}, secretConfig{Databases: []*sqlquery.Config{{Password: tt.ref}}})
+		test.Error(err)
+		test.Equal(fmt.Sprintf(config.ErrResolve.Error(), "Databases[0].Password", tt.err), err.Error())
+	}
+}
+
+func TestRegisterResolver(t *testing.T) {
+	test := assert.New(t)
+
+	// error: empty scheme or resolver
+	test.Equal(config.ErrNoResolver, config.RegisterResolver("", nil))
+
+	// error: already registered
+	test.Equal(fmt.Sprintf(config.ErrResolverExists.Error(), config.ResolverEnv), config.RegisterResolver(config.ResolverEnv, func(string, interface{}) (string, bool, error) { return "", false, nil }).Error())
+
+	// ok
+	test.NoError(config.RegisterResolver("upper", func(arg string, cfg interface{}) (string, bool, error) {
+		return strings.ToUpper(arg), false, nil
+	}))
+	cfg := &secretConfig{}
+	test.NoError(config.New("ref", cfg, secretConfig{Template: "${upper:foo}"}))
+	test.Equal("FOO", cfg.Template)
+}
+
+func TestMasked(t *testing.T) {
+	test := assert.New(t)
+	test.NoError(config.RegisterResolver("vault", func(arg string, cfg interface{}) (string, bool, error) {
+		return "localhost", true, nil
+	}))
+	test.NoError(os.Setenv("TEST_PORT", "3306"))
+	defer os.Unsetenv("TEST_PORT")
+
+	// ok: only the fields with a secret are masked, equal values of other fields are kept
+	cfg := &secretConfig{}
+	err := config.New("ref", cfg, secretConfig{
+		Server:    secretServer{Domain: "localhost", URL: "${config:apiKey}"},
+		Databases: []*sqlquery.Config{{Host: "localhost", Database: "${env:TEST_PORT}"}},
+		Labels:    map[string]string{"token": "${vault:token}", "host": "localhost", "port": "3306"},
+		APIKey:    "key-3306",
+	})
+	test.NoError(err)
+	masked, err := config.Masked(cfg)
+	test.NoError(err)
+	test.Contains(masked, `"domain": "localhost"`)
+	test.Contains(masked, `"url": "******"`)
+	test.Contains(masked, `"host": "localhost"`)
+	test.Contains(masked, `"database": "3306"`)
+	test.Contains(masked, `"token": "******"`)
+	test.Contains(masked, `"port": "3306"`)
+	test.Contains(masked, `"apiKey": "******"`)
+
+	// ok: env values are not masked
+	test.Equal("port 3306", config.MaskString("port 3306"))
+	test.Equal("key ******", config.MaskString("key key-3306"))
+}
+
+func TestMaskString(t *testing.T) {
+	_ = config.Register("ref", func() config.Interface { return refProvider{} })
+	test := assert.New(t)
+
+	// ok: only values at word boundaries are masked
+	cfg := &secretConfig{}
+	test.NoError(config.New("ref", cfg, secretConfig{APIKey: "7"}))
+	test.Equal("key=****** port=3307 id=a7 v7", config.MaskString("key=7 port=3307 id=a7 v7"))
+	test.Equal("(******)", config.MaskString("(7)"))
+
+	// ok: the secrets of a config are replaced if it is resolved again
+	test.NoError(config.New("ref", cfg, secretConfig{APIKey: "key-rotated"}))
+	test.Equal("****** 7", config.MaskString("key-rotated 7"))
+
+	// ok: the secrets are removed on release
+	config.Release(cfg)
+	test.Equal("key-rotated 7", config.MaskString("key-rotated 7"))
+	masked, err := config.Masked(cfg)
+	test.NoError(err)
+	test.Contains(masked, `"apiKey": "******"`)
+}
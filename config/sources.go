@@ -0,0 +1,232 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Pre-defined config providers, which can be used as sources in Compose.
+const (
+	// DEFAULTS sets the values of the default struct tags.
+	DEFAULTS = "defaults"
+	// ENVIRONMENT sets the environment variables (see SetEnvPrefix).
+	ENVIRONMENT = "environment"
+	// FLAGS sets the command-line flags.
+	FLAGS = "flags"
+)
+
+// TagDefault is the struct tag to define the default value of a field.
+const TagDefault = "default"
+
+// Error messages.
+var (
+	ErrDefaultValue = errors.New("config: default value of field %v could not be set: %v")
+	ErrFlagValue    = errors.New("config: flag %v could not be set: %v")
+)
+
+// init registers the pre-defined providers.
+func init() {
+	_ = Register(DEFAULTS, func() Interface { return &defaults{} })
+	_ = Register(ENVIRONMENT, func() Interface { return &environment{} })
+	_ = Register(FLAGS, func() Interface { return &flags{} })
+}
+
+// EnvOptions for the ENVIRONMENT provider.
+type EnvOptions struct {
+	// Prefix for the automatic environment variable names. If the options are nil, the prefix of SetEnvPrefix is used.
+	Prefix string
+}
+
+// FlagOptions for the FLAGS provider.
+type FlagOptions struct {
+	// Args are the command-line arguments. If the options are nil, os.Args[1:] is used.
+	Args []string
+}
+
+// defaults provider.
+type defaults struct{}
+
+// Parse sets the value of the default tag on all fields.
+// Nested structs and existing slice elements are set recursively.
+func (d *defaults) Parse(config interface{}, env string, options interface{}) error {
+	return defaultValue(reflect.ValueOf(config), "")
+}
+
+// defaultValue sets the default tags of the struct fields.
+func defaultValue(v reflect.Value, path string) error {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return defaultValue(v.Elem(), path)
+		}
+	case reflect.Slice:
+		if isNested(v.Type().Elem()) {
+			for i := 0; i < v.Len(); i++ {
+				if err := defaultValue(v.Index(i), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			p := strings.TrimPrefix(path+"."+f.Name, ".")
+			if tag, ok := f.Tag.Lookup(TagDefault); ok {
+				if err := setString(v.Field(i), tag); err != nil {
+					return fmt.Errorf(ErrDefaultValue.Error(), p, err)
+				}
+				continue
+			}
+			if err := defaultValue(v.Field(i), p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// environment provider.
+type environment struct{}
+
+// Parse sets the environment variables. See SetEnvPrefix for the naming.
+func (e *environment) Parse(config interface{}, env string, options interface{}) error {
+	if options == nil {
+		return envOverlay(config, envPrefix)
+	}
+	return envOverlay(config, options.(EnvOptions).Prefix)
+}
+
+// flags provider.
+type flags struct{}
+
+// Parse sets the command-line flags.
+// The flag name is the field path, where the json tag is used as field name if defined. Slice elements are added by their index.
+// The name is case-insensitive and the value can be separated by "=" or a space. Bool flags without value are set to true.
+// Unknown flags and positional arguments are ignored, like this the application can define its own flags.
+//
+//	-server.httpPort=8080 --databases.0.host db -server.debug
+func (f *flags) Parse(config interface{}, env string, options interface{}) error {
+	args := os.Args[1:]
+	if options != nil {
+		args = options.(FlagOptions).Args
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return nil
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		val, hasValue := "", false
+		if n := strings.Index(name, "="); n >= 0 {
+			name, val, hasValue = name[:n], name[n+1:], true
+		}
+
+		path := strings.Split(name, ".")
+		if !flagPath(reflect.TypeOf(config), path) {
+			continue
+		}
+		field, ok := flagField(reflect.ValueOf(config), path)
+		if !ok {
+			continue
+		}
+		if !hasValue {
+			if field.Kind() == reflect.Bool || (field.Kind() == reflect.Ptr && field.Type().Elem().Kind() == reflect.Bool) {
+				val = "true"
+			} else if i+1 < len(args) {
+				i++
+				val = args[i]
+			}
+		}
+		if err := setString(field, val); err != nil {
+			return fmt.Errorf(ErrFlagValue.Error(), name, err)
+		}
+	}
+	return nil
+}
+
+// flagPath returns true if the path exists in the type.
+func flagPath(t reflect.Type, path []string) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if len(path) == 0 {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			key := strings.Split(f.Tag.Get("json"), ",")[0]
+			if strings.EqualFold(key, path[0]) || strings.EqualFold(f.Name, path[0]) {
+				return flagPath(f.Type, path[1:])
+			}
+		}
+	case reflect.Slice:
+		if _, err := strconv.Atoi(path[0]); err == nil && isNested(t.Elem()) {
+			return flagPath(t.Elem(), path[1:])
+		}
+	}
+	return false
+}
+
+// flagField returns the field of the path.
+// Missing pointers and slice elements are created.
+func flagField(v reflect.Value, path []string) (reflect.Value, bool) {
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if len(path) == 0 {
+		return v, true
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			key := strings.Split(f.Tag.Get("json"), ",")[0]
+			if strings.EqualFold(key, path[0]) || strings.EqualFold(f.Name, path[0]) {
+				return flagField(v.Field(i), path[1:])
+			}
+		}
+	case reflect.Slice:
+		if !isNested(v.Type().Elem()) {
+			return v, false
+		}
+		i, err := strconv.Atoi(path[0])
+		if err != nil || i < 0 || i > v.Len() {
+			return v, false
+		}
+		if i == v.Len() {
+			v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+		}
+		return flagField(v.Index(i), path[1:])
+	}
+	return v, false
+}
@@ -0,0 +1,205 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package toml implements the config.Interface and registers a toml provider.
+// All operations are using a sync.Mutex for synchronization.
+//
+// The toml file is decoded into a map and marshaled into the config struct by encoding/json.
+// The keys are defined by the toml tag of the struct field. If no toml tag exists, the json tag (or field name) is used.
+// Like this existing config structs (e.g. server.Config) can be used without changes and the merge strategies are the same as in the json provider (see config.Merge).
+//
+// Check the toml.Options for the available configurations.
+package toml
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	tomlv1 "github.com/BurntSushi/toml"
+	"github.com/patrickascher/gofw/config"
+)
+
+// Error messages
+var (
+	ErrFilepath = errors.New("config/toml: Filepath is missing")
+)
+
+// toml config provider
+type toml struct {
+	mux sync.Mutex
+}
+
+// Options for the toml config reader
+type Options struct {
+	// The Filepath is mandatory.
+	// The given file will get decoded and marshaled into the given config struct.
+	// If a environment file exists, it will be merged with a higher priority (see config.Merge for the merge strategies).
+	// This means a common configuration could be written in conf.toml and the env configuration is getting merged together.
+	// Prefix the file with the environment followed by a dot. (dev.conf.toml, staging.conf.toml, production.conf.toml, ...)
+	Filepath string
+}
+
+// init registers the toml provider
+func init() {
+	_ = config.Register(config.TOML, New)
+}
+
+// New satisfies the config.provider interface.
+func New() config.Interface {
+	return &toml{}
+}
+
+// Parse the given file into the config struct. sync.mux is used for synchronisation.
+// File and env file are getting decoded and merged into the config struct (please see toml.Options and config.Merge for more details).
+// If the filepath is not set, file does not exist or the toml can not get decoded, an error will return.
+func (t *toml) Parse(cfg interface{}, env string, options interface{}) error {
+	// checking if the config Filepath is set
+	opt := options.(Options)
+	if opt.Filepath == "" {
+		return ErrFilepath
+	}
+
+	//sync.Mutex is getting locked.
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	// opening filepath
+	files := make([]map[string]interface{}, 0, 2)
+	m, err := fileOpen(opt.Filepath, cfg)
+	if err != nil {
+		return err
+	}
+	files = append(files, m)
+
+	// check if an env is set and the env file exists and is no dir
+	if env != "" {
+		envFile := fmt.Sprintf("%v%v%v%v", filepath.Dir(opt.Filepath), string(filepath.Separator), env+".", filepath.Base(opt.Filepath))
+		if info, err := os.Stat(envFile); err == nil && !info.IsDir() {
+			m, err = fileOpen(envFile, cfg)
+			if err != nil {
+				// the base file is set, even if the env file is invalid.
+				if mErr := config.Merge(cfg, files...); mErr != nil {
+					return mErr
+				}
+				return err
+			}
+			files = append(files, m)
+		}
+	}
+
+	// the files are merged by the merge strategies of the config struct.
+	return config.Merge(cfg, files...)
+}
+
+// fileOpen decodes the toml file into a map with the json keys of the config struct.
+func fileOpen(f string, c interface{}) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	_, err := tomlv1.DecodeFile(f, &m)
+	if err != nil {
+		return nil, err
+	}
+	return tagKeys(reflect.TypeOf(c), normalize(m)).(map[string]interface{}), nil
+}
+
+// normalize converts the arrays of tables, which are decoded as []map[string]interface{}, into []interface{}.
+// Like this the decoded toml has the same types as a decoded json or yaml and the merge strategies can be applied.
+func normalize(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k := range val {
+			val[k] = normalize(val[k])
+		}
+	case []map[string]interface{}:
+		s := make([]interface{}, len(val))
+		for i := range val {
+			s[i] = normalize(val[i])
+		}
+		return s
+	case []interface{}:
+		for i := range val {
+			val[i] = normalize(val[i])
+		}
+	}
+	return v
+}
+
+// tagKeys renames the keys of the decoded toml, which are defined by a toml tag, into the json key of the field.
+func tagKeys(t reflect.Type, v interface{}) interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return v
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			key := tagName(f.Tag.Get("json"))
+			// embedded structs are flattened by encoding/json.
+			if f.Anonymous && key == "" {
+				tagKeys(f.Type, m)
+				continue
+			}
+			if key == "-" {
+				continue
+			}
+			if key == "" {
+				key = f.Name
+			}
+			if name := tagName(f.Tag.Get("toml")); name != "" && name != "-" && name != key {
+				if val, ok := m[name]; ok {
+					delete(m, name)
+					m[key] = val
+				}
+			}
+			if k, ok := lookup(m, key); ok {
+				m[k] = tagKeys(f.Type, m[k])
+			}
+		}
+		return m
+	case reflect.Slice, reflect.Array:
+		if s, ok := v.([]interface{}); ok {
+			for i := range s {
+				s[i] = tagKeys(t.Elem(), s[i])
+			}
+		}
+	case reflect.Map:
+		if m, ok := v.(map[string]interface{}); ok {
+			for k := range m {
+				m[k] = tagKeys(t.Elem(), m[k])
+			}
+		}
+	}
+	return v
+}
+
+// tagName returns the name of the struct tag without options.
+func tagName(tag string) string {
+	return strings.Split(tag, ",")[0]
+}
+
+// lookup returns the map key which matches the given key.
+// Like encoding/json, an exact match is preferred over a case-insensitive match.
+func lookup(m map[string]interface{}, key string) (string, bool) {
+	if _, ok := m[key]; ok {
+		return key, true
+	}
+	for k := range m {
+		if strings.EqualFold(k, key) {
+			return k, true
+		}
+	}
+	return "", false
+}
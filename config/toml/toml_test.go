@@ -0,0 +1,172 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package toml_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/patrickascher/gofw/config"
+	"github.com/patrickascher/gofw/config/toml"
+	"github.com/patrickascher/gofw/server"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockServerConfig struct {
+	Ip   string `toml:"address"`
+	Port int    `json:"port"`
+}
+
+type mockUserConfig struct {
+	Name     string
+	Password string `json:"password" toml:"pw"`
+}
+
+type mockConfig struct {
+	Server mockServerConfig
+	Users  []mockUserConfig `json:"users"`
+}
+
+type mockDatabaseConfig struct {
+	Name string `json:"name"`
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+type mockMergeConfig struct {
+	Origins   []string             `json:"origins" merge:"append"`
+	Databases []mockDatabaseConfig `json:"databases" merge:"key=name"`
+}
+
+// mockFiles creates the files config.toml (correct), dev.config.toml (correct), fail.config.toml (incorrect), server.toml and merge.toml with dev.merge.toml.
+func mockFiles() {
+	files := map[string]string{
+		"config.toml":      "[server]\naddress = \"127.0.0.1\"\nport = 8080\n\n[[users]]\nname = \"root\"\npw = \"toor\"\n",
+		"dev.config.toml":  "[server]\nport = 8081\n",
+		"fail.config.toml": "[server\nport = 8081\n",
+		"merge.toml":       "origins = [\"a\"]\n\n[[databases]]\nname = \"main\"\nhost = \"db\"\nport = 3306\n",
+		"dev.merge.toml":   "origins = [\"b\"]\n\n[[databases]]\nname = \"main\"\nhost = \"localhost\"\n\n[[databases]]\nname = \"dev\"\nhost = \"dev\"\n",
+		"server.toml": `
+[server]
+domain = "localhost"
+language = "en"
+timezone = "UTC"
+httpPort = 8080
+appPath = "/app"
+
+[router]
+provider = "httprouter"
+
+[[databases]]
+driver = "mysql"
+host = "127.0.0.1"
+port = 3306
+maxOpenConnections = 10
+
+[[caches]]
+provider = "memory"
+cycle = 5
+[caches.options]
+maxItems = 100
+
+[[caches]]
+name = "short"
+provider = "memory"
+cycle = "90s"
+`,
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(name, []byte(content), 0644)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// removeMockFiles removes all test files
+func removeMockFiles() {
+	for _, name := range []string{"config.toml", "dev.config.toml", "fail.config.toml", "server.toml", "merge.toml", "dev.merge.toml"} {
+		err := os.Remove(name)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// TestToml_Parse testing if the files are getting parsed correctly into the config struct
+func TestToml_Parse(t *testing.T) {
+	mockFiles()
+	defer removeMockFiles()
+
+	tc := toml.New()
+	users := []mockUserConfig{{Name: "root", Password: "toor"}}
+
+	// table driven tests
+	var tests = []struct {
+		Error  bool
+		Env    string
+		File   string
+		Result *mockConfig
+	}{
+		{Error: false, File: "config.toml", Env: "", Result: &mockConfig{Server: mockServerConfig{Ip: "127.0.0.1", Port: 8080}, Users: users}},
+		{Error: false, File: "config.toml", Env: "dev", Result: &mockConfig{Server: mockServerConfig{Ip: "127.0.0.1", Port: 8081}, Users: users}},
+		{Error: true, File: "404.config.toml", Env: "404", Result: &mockConfig{}},
+		{Error: true, File: "config.toml", Env: "fail", Result: &mockConfig{Server: mockServerConfig{Ip: "127.0.0.1", Port: 8080}, Users: users}},
+		{Error: true, File: "", Env: "", Result: &mockConfig{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Env, func(t *testing.T) {
+			conf := &mockConfig{}
+			err := tc.Parse(conf, tt.Env, toml.Options{Filepath: tt.File})
+			if tt.Error {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.Result, conf)
+		})
+	}
+}
+
+// TestToml_Merge tests if the merge strategies are applied on arrays of tables.
+func TestToml_Merge(t *testing.T) {
+	mockFiles()
+	defer removeMockFiles()
+
+	conf := &mockMergeConfig{}
+	err := toml.New().Parse(conf, "dev", toml.Options{Filepath: "merge.toml"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, conf.Origins)
+	assert.Equal(t, []mockDatabaseConfig{{Name: "main", Host: "localhost", Port: 3306}, {Name: "dev", Host: "dev"}}, conf.Databases)
+}
+
+// TestToml_Server tests if the server configuration can be decoded.
+func TestToml_Server(t *testing.T) {
+	mockFiles()
+	defer removeMockFiles()
+
+	conf := &server.Config{}
+	err := config.New(config.TOML, conf, toml.Options{Filepath: "server.toml"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, 8080, conf.Server.HTTPPort)
+	assert.Equal(t, "/app", conf.Server.AppPath)
+	assert.Equal(t, "httprouter", conf.Router.Provider)
+	assert.Equal(t, 1, len(conf.Databases))
+	assert.Equal(t, 10, conf.Databases[0].MaxOpenConnections)
+	assert.Equal(t, 2, len(conf.CacheManager))
+	assert.Equal(t, server.Duration(5*time.Minute), conf.CacheManager[0].GCCycle)
+	// ok: duration string
+	assert.Equal(t, server.Duration(90*time.Second), conf.CacheManager[1].GCCycle)
+
+	opt := map[string]int{}
+	assert.NoError(t, json.Unmarshal(conf.CacheManager[0].Options, &opt))
+	assert.Equal(t, map[string]int{"maxItems": 100}, opt)
+}
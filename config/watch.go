@@ -0,0 +1,205 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultWatchInterval is the polling interval of the watcher.
+var defaultWatchInterval = 5 * time.Second
+
+// Error messages.
+var (
+	ErrWatchFiles = errors.New("config: no files to watch")
+)
+
+// WatchOptions for the watcher.
+type WatchOptions struct {
+	// Files which are polled for changes.
+	// If empty, the Filepath option of the sources and its environment file are used.
+	Files []string
+	// Interval of the polling. Default is 5 seconds.
+	Interval time.Duration
+	// OnError is called if a reload failed. The old config is kept.
+	OnError func(err error)
+}
+
+// Watcher reloads the config if one of the files has changed.
+// Every reload parses and validates into a new struct, which is swapped atomically.
+type Watcher struct {
+	config    atomic.Value
+	typ       reflect.Type
+	sources   []Source
+	options   WatchOptions
+	mutex     sync.Mutex
+	files     map[string]fileState
+	callbacks []func(old interface{}, new interface{})
+	closing   chan struct{}
+	done      chan struct{}
+	closed    sync.Once
+}
+
+// fileState is used to detect a file change.
+type fileState struct {
+	modTime time.Time
+	size    int64
+	exists  bool
+}
+
+// Watch parses the config by the given sources (see Compose) and starts polling the files.
+// The given config is the first config, every reload creates a new struct of the same type.
+// Error will return if the first parse fails or no files are defined.
+//
+//	w, err := config.Watch(&cfg, config.WatchOptions{Interval: time.Second},
+//		config.Source{Provider: config.JSON, Options: json.Options{Filepath: "conf.json"}, Env: config.Env()})
+//	w.OnChange(func(old, new interface{}) {
+//		// new.(*Cfg)
+//	})
+//	defer w.Close()
+func Watch(config interface{}, options WatchOptions, sources ...Source) (*Watcher, error) {
+	if reflect.ValueOf(config).Kind() != reflect.Ptr {
+		return nil, ErrConfigPtr
+	}
+	if options.Interval <= 0 {
+		options.Interval = defaultWatchInterval
+	}
+	if len(options.Files) == 0 {
+		options.Files = sourceFiles(sources)
+	}
+	if len(options.Files) == 0 {
+		return nil, ErrWatchFiles
+	}
+
+	_, err := Compose(config, sources...)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{typ: reflect.TypeOf(config).Elem(), sources: sources, options: options, closing: make(chan struct{}), done: make(chan struct{})}
+	w.config.Store(config)
+	w.files = w.stat()
+	go w.poll()
+	return w, nil
+}
+
+// Config returns the actual config. The config must not be modified.
+func (w *Watcher) Config() interface{} {
+	return w.config.Load()
+}
+
+// OnChange registers a function, which is called with the old and new config after a successful reload.
+func (w *Watcher) OnChange(fn func(old interface{}, new interface{})) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.callbacks = append(w.callbacks, fn)
+}
+
+// Reload parses and validates the sources into a new struct and swaps the config.
+// The old config is released (see Release) after the callbacks were called.
+// If an error occurs, the old config is kept, the new one is released and the error will return.
+func (w *Watcher) Reload() error {
+	w.mutex.Lock()
+	config := reflect.New(w.typ).Interface()
+	_, err := Compose(config, w.sources...)
+	if err != nil {
+		w.mutex.Unlock()
+		Release(config)
+		return err
+	}
+	old := w.config.Load()
+	w.config.Store(config)
+	callbacks := make([]func(interface{}, interface{}), len(w.callbacks))
+	copy(callbacks, w.callbacks)
+	w.mutex.Unlock()
+
+	for _, fn := range callbacks {
+		fn(old, config)
+	}
+	Release(old)
+	return nil
+}
+
+// Close stops the polling. A running reload is finished before Close returns, so it must not be called by a callback.
+func (w *Watcher) Close() error {
+	w.closed.Do(func() { close(w.closing) })
+	<-w.done
+	return nil
+}
+
+// poll checks the files in the defined interval and reloads the config on a change.
+func (w *Watcher) poll() {
+	ticker := time.NewTicker(w.options.Interval)
+	defer ticker.Stop()
+	defer close(w.done)
+
+	for {
+		select {
+		case <-w.closing:
+			return
+		case <-ticker.C:
+			// closing has priority, if both are ready.
+			select {
+			case <-w.closing:
+				return
+			default:
+			}
+			files := w.stat()
+			if reflect.DeepEqual(files, w.files) {
+				continue
+			}
+			w.files = files
+			if err := w.Reload(); err != nil && w.options.OnError != nil {
+				w.options.OnError(err)
+			}
+		}
+	}
+}
+
+// stat returns the state of all files.
+func (w *Watcher) stat() map[string]fileState {
+	rv := make(map[string]fileState, len(w.options.Files))
+	for _, f := range w.options.Files {
+		if info, err := os.Stat(f); err == nil {
+			rv[f] = fileState{modTime: info.ModTime(), size: info.Size(), exists: true}
+			continue
+		}
+		rv[f] = fileState{}
+	}
+	return rv
+}
+
+// sourceFiles returns the Filepath option of the sources and the environment file.
+func sourceFiles(sources []Source) []string {
+	var rv []string
+	for _, s := range sources {
+		if s.Options == nil {
+			continue
+		}
+		v := reflect.ValueOf(s.Options)
+		for v.Kind() == reflect.Ptr {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			continue
+		}
+		f := v.FieldByName("Filepath")
+		if !f.IsValid() || f.Kind() != reflect.String || f.String() == "" {
+			continue
+		}
+		rv = append(rv, f.String())
+		if s.Env != "" {
+			rv = append(rv, fmt.Sprintf("%v%v%v%v", filepath.Dir(f.String()), string(filepath.Separator), s.Env+".", filepath.Base(f.String())))
+		}
+	}
+	return rv
+}
@@ -0,0 +1,102 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/patrickascher/gofw/config"
+	"github.com/patrickascher/gofw/config/json"
+	"github.com/stretchr/testify/assert"
+)
+
+type watchConfig struct {
+	Level   string   `json:"level" validate:"required"`
+	Origins []string `json:"origins"`
+}
+
+// writeFile writes the content and changes the modification time, so that the change is detected.
+func writeFile(t *testing.T, name string, content string, mod time.Time) {
+	assert.NoError(t, ioutil.WriteFile(name, []byte(content), 0644))
+	assert.NoError(t, os.Chtimes(name, mod, mod))
+}
+
+func TestWatch(t *testing.T) {
+	test := assert.New(t)
+	now := time.Now()
+	writeFile(t, "watch.json", `{"level": "info", "origins": ["a"]}`, now)
+	defer os.Remove("watch.json")
+
+	var mutex sync.Mutex
+	var changes [][2]*watchConfig
+	var errs []error
+
+	cfg := &watchConfig{}
+	w, err := config.Watch(cfg, config.WatchOptions{Interval: 5 * time.Millisecond, OnError: func(err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		errs = append(errs, err)
+	}}, config.Source{Provider: config.JSON, Options: json.Options{Filepath: "watch.json"}, Env: "dev"})
+	test.NoError(err)
+	defer w.Close()
+	test.Equal(&watchConfig{Level: "info", Origins: []string{"a"}}, cfg)
+	test.Equal(cfg, w.Config())
+
+	w.OnChange(func(old, new interface{}) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		changes = append(changes, [2]*watchConfig{old.(*watchConfig), new.(*watchConfig)})
+	})
+
+	// ok: file changed
+	writeFile(t, "watch.json", `{"level": "debug"}`, now.Add(time.Second))
+	test.Eventually(func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(changes) == 1
+	}, time.Second, 5*time.Millisecond)
+	test.Equal(&watchConfig{Level: "debug"}, w.Config())
+	test.Equal([2]*watchConfig{cfg, {Level: "debug"}}, changes[0])
+
+	// ok: env file was created
+	writeFile(t, "dev.watch.json", `{"origins": ["b"]}`, now)
+	defer os.Remove("dev.watch.json")
+	test.Eventually(func() bool {
+		return len(w.Config().(*watchConfig).Origins) == 1
+	}, time.Second, 5*time.Millisecond)
+	test.Equal(&watchConfig{Level: "debug", Origins: []string{"b"}}, w.Config())
+
+	// error: invalid file, the old config is kept
+	writeFile(t, "watch.json", `{"level": ""}`, now.Add(2*time.Second))
+	test.Eventually(func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(errs) == 1
+	}, time.Second, 5*time.Millisecond)
+	writeFile(t, "watch.json", `{"level": `, now.Add(3*time.Second))
+	test.Eventually(func() bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return len(errs) == 2
+	}, time.Second, 5*time.Millisecond)
+	test.Equal(&watchConfig{Level: "debug", Origins: []string{"b"}}, w.Config())
+	test.Equal(2, len(changes))
+	test.Error(w.Reload())
+
+	// ok: closed, no reloads anymore
+	test.NoError(w.Close())
+	writeFile(t, "watch.json", `{"level": "warn"}`, now.Add(4*time.Second))
+	time.Sleep(20 * time.Millisecond)
+	test.Equal("debug", w.Config().(*watchConfig).Level)
+	test.NoError(w.Close())
+
+	// error: no files
+	_, err = config.Watch(&watchConfig{}, config.WatchOptions{}, config.Source{Provider: config.DEFAULTS})
+	test.Equal(config.ErrWatchFiles, err)
+}
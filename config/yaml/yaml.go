@@ -0,0 +1,145 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package yaml implements the config.Interface and registers a yaml provider.
+// All operations are using a sync.Mutex for synchronization.
+//
+// The yaml file is decoded into a map and marshaled into the config struct by encoding/json.
+// Like this the json tags of the config struct are used and the merge strategies are the same as in the json provider (see config.Merge).
+//
+// Check the yaml.Options for the available configurations.
+package yaml
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/patrickascher/gofw/config"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// Error messages
+var (
+	ErrFilepath = errors.New("config/yaml: Filepath is missing")
+	ErrMapping  = errors.New("config/yaml: root of %v must be a mapping")
+)
+
+// yaml config provider
+type yaml struct {
+	mux sync.Mutex
+}
+
+// Options for the yaml config reader
+type Options struct {
+	// The Filepath is mandatory.
+	// The given file will get decoded and marshaled into the given config struct.
+	// If a environment file exists, it will be merged with a higher priority (see config.Merge for the merge strategies).
+	// This means a common configuration could be written in conf.yaml and the env configuration is getting merged together.
+	// Prefix the file with the environment followed by a dot. (dev.conf.yaml, staging.conf.yaml, production.conf.yaml, ...)
+	Filepath string
+}
+
+// init registers the yaml provider
+func init() {
+	_ = config.Register(config.YAML, New)
+}
+
+// New satisfies the config.provider interface.
+func New() config.Interface {
+	return &yaml{}
+}
+
+// Parse the given file into the config struct. sync.mux is used for synchronisation.
+// File and env file are getting decoded and merged into the config struct (please see yaml.Options and config.Merge for more details).
+// If the filepath is not set, file does not exist or the yaml can not get decoded, an error will return.
+func (y *yaml) Parse(cfg interface{}, env string, options interface{}) error {
+	// checking if the config Filepath is set
+	opt := options.(Options)
+	if opt.Filepath == "" {
+		return ErrFilepath
+	}
+
+	//sync.Mutex is getting locked.
+	y.mux.Lock()
+	defer y.mux.Unlock()
+
+	// opening filepath
+	files := make([]map[string]interface{}, 0, 2)
+	m, err := fileOpen(opt.Filepath)
+	if err != nil {
+		return err
+	}
+	files = append(files, m)
+
+	// check if an env is set and the env file exists and is no dir
+	if env != "" {
+		envFile := fmt.Sprintf("%v%v%v%v", filepath.Dir(opt.Filepath), string(filepath.Separator), env+".", filepath.Base(opt.Filepath))
+		if info, err := os.Stat(envFile); err == nil && !info.IsDir() {
+			m, err = fileOpen(envFile)
+			if err != nil {
+				// the base file is set, even if the env file is invalid.
+				if mErr := config.Merge(cfg, files...); mErr != nil {
+					return mErr
+				}
+				return err
+			}
+			files = append(files, m)
+		}
+	}
+
+	// the files are merged by the merge strategies of the config struct.
+	return config.Merge(cfg, files...)
+}
+
+// fileOpen reads the yaml file and decodes it into a map.
+func fileOpen(f string) (map[string]interface{}, error) {
+	b, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+
+	var m interface{}
+	err = yamlv3.Unmarshal(b, &m)
+	if err != nil {
+		return nil, err
+	}
+	// empty file
+	if m == nil {
+		return nil, nil
+	}
+
+	rv, ok := normalize(m).(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf(ErrMapping.Error(), f)
+	}
+	return rv, nil
+}
+
+// normalize converts all map[interface{}]interface{} into map[string]interface{}, so that they can be json encoded.
+// yaml allows non-string keys (e.g. 1: foo), they are converted by fmt.
+func normalize(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			t[k] = normalize(val)
+		}
+		return t
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[fmt.Sprint(k)] = normalize(val)
+		}
+		return m
+	case []interface{}:
+		for i, val := range t {
+			t[i] = normalize(val)
+		}
+		return t
+	}
+	return v
+}
@@ -0,0 +1,131 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package yaml_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/patrickascher/gofw/config"
+	"github.com/patrickascher/gofw/config/yaml"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockServerConfig struct {
+	Ip    string
+	Port  int
+	Hosts []string
+}
+
+type mockUserConfig struct {
+	Name     string
+	Password string `json:"pw" validate:"required"`
+}
+
+type mockConfig struct {
+	Server mockServerConfig
+	User   mockUserConfig
+	Labels map[string]string
+
+	callbacks []string
+}
+
+func (c *mockConfig) BeforeParse() error {
+	c.callbacks = append(c.callbacks, config.CallbackBeforeParse)
+	return nil
+}
+
+func (c *mockConfig) AfterParse() error {
+	c.callbacks = append(c.callbacks, config.CallbackAfterParse)
+	return nil
+}
+
+// mockFiles creates the files config.yaml (correct), dev.config.yaml (correct), fail.config.yaml (incorrect) and empty.yaml.
+func mockFiles() {
+	files := map[string]string{
+		"config.yaml":      "server:\n  ip: 127.0.0.1\n  port: 8080\n  hosts: [a, b]\nuser:\n  name: root\n  pw: toor\nlabels:\n  1: one\n",
+		"dev.config.yaml":  "user:\n  name: dev\n  pw: ved\nlabels:\n  2: two\n",
+		"fail.config.yaml": "user:\n  name: dev\n\tpw: ved\n",
+		"empty.yaml":       "",
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(name, []byte(content), 0644)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// removeMockFiles removes all test files
+func removeMockFiles() {
+	for _, name := range []string{"config.yaml", "dev.config.yaml", "fail.config.yaml", "empty.yaml"} {
+		err := os.Remove(name)
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// TestYaml_Parse testing if the files are getting parsed correctly into the config struct
+func TestYaml_Parse(t *testing.T) {
+	mockFiles()
+	defer removeMockFiles()
+
+	yc := yaml.New()
+	root := mockConfig{Server: mockServerConfig{Ip: "127.0.0.1", Port: 8080, Hosts: []string{"a", "b"}}, User: mockUserConfig{Name: "root", Password: "toor"}, Labels: map[string]string{"1": "one"}}
+	dev := root
+	dev.User = mockUserConfig{Name: "dev", Password: "ved"}
+	dev.Labels = map[string]string{"1": "one", "2": "two"}
+
+	// table driven tests
+	var tests = []struct {
+		Error  bool
+		Env    string
+		File   string
+		Result *mockConfig
+	}{
+		{Error: false, File: "config.yaml", Env: "", Result: &root},
+		{Error: false, File: "config.yaml", Env: "dev", Result: &dev},
+		{Error: false, File: "empty.yaml", Env: "empty", Result: &mockConfig{}},
+		{Error: true, File: "404.config.yaml", Env: "404", Result: &mockConfig{}},
+		{Error: true, File: "config.yaml", Env: "fail", Result: &mockConfig{Server: root.Server, User: root.User, Labels: map[string]string{"1": "one"}}},
+		{Error: true, File: "", Env: "", Result: &mockConfig{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Env, func(t *testing.T) {
+			conf := &mockConfig{}
+			err := yc.Parse(conf, tt.Env, yaml.Options{Filepath: tt.File})
+			if tt.Error {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, tt.Result, conf)
+		})
+	}
+}
+
+// TestYaml_New tests the provider by the config manager.
+func TestYaml_New(t *testing.T) {
+	mockFiles()
+	defer removeMockFiles()
+
+	// ok: callbacks are called
+	conf := &mockConfig{}
+	config.SetEnv("dev")
+	defer config.SetEnv("")
+	err := config.New(config.YAML, conf, yaml.Options{Filepath: "config.yaml"})
+	assert.NoError(t, err)
+	assert.Equal(t, "dev", conf.User.Name)
+	assert.Equal(t, []string{config.CallbackBeforeParse, config.CallbackAfterParse}, conf.callbacks)
+
+	// error: validation
+	conf = &mockConfig{}
+	err = config.New(config.YAML, conf, yaml.Options{Filepath: "empty.yaml"})
+	assert.Error(t, err)
+}
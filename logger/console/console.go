@@ -12,17 +12,17 @@ package console
 
 import (
 	"fmt"
-	"path/filepath"
 	"sync"
-	"time"
 
 	"github.com/patrickascher/gofw/logger"
 )
 
 // Options of the console log provider.
 type Options struct {
-	// adding some highlights to the console
+	// adding some highlights to the console. It is only used by the default formatter.
 	Color bool
+	// Formatter of the log entry. Default is logger.TextFormatter.
+	Formatter logger.Formatter
 }
 
 type console struct {
@@ -30,34 +30,11 @@ type console struct {
 	options Options
 }
 
-// colorFormat for the logging output.
-func (c *console) colorFormat(e logger.LogEntry) string {
-	color := ""
-	switch e.Level {
-	case logger.TRACE:
-		color = "92" //green
-	case logger.DEBUG:
-		color = "96" //Blue
-	case logger.INFO:
-		color = "93" //Yellow
-	case logger.WARNING:
-		color = "95" //Lila
-	case logger.ERROR, logger.CRITICAL:
-		color = "91" //Red
-	}
-
-	return fmt.Sprintf("%s \x1b["+color+"m%s\x1b[39m %s:%d %s", e.Timestamp.In(time.UTC).Format("2006-01-02 15:04:05"), e.Level.String(), filepath.Base(e.Filename), e.Line, e.Message)
-}
-
 // Write implements the writer interface of the log.Interface.
-// It creates a simple console output.
+// The entry is formatted by the configured formatter.
 func (c *console) Write(e logger.LogEntry) {
 	c.lock.Lock()
-	if c.options.Color {
-		fmt.Println(c.colorFormat(e), e.Arguments)
-	} else {
-		fmt.Println(fmt.Sprintf("%s %s %s:%d %s", e.Timestamp.In(time.UTC).Format("2006-01-02 15:04:05"), e.Level.String(), filepath.Base(e.Filename), e.Line, e.Message), e.Arguments)
-	}
+	fmt.Println(c.options.Formatter.Format(e))
 	c.lock.Unlock()
 }
 
@@ -65,5 +42,8 @@ func (c *console) Write(e logger.LogEntry) {
 func New(options Options) (logger.Interface, error) {
 	c := console{}
 	c.options = options
+	if c.options.Formatter == nil {
+		c.options.Formatter = &logger.TextFormatter{Color: options.Color}
+	}
 	return &c, nil
 }
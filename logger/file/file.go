@@ -12,11 +12,8 @@ package file
 
 import (
 	"errors"
-	"fmt"
 	"os"
-	"path/filepath"
 	"sync"
-	"time"
 
 	"github.com/patrickascher/gofw/logger"
 )
@@ -30,6 +27,8 @@ var (
 type Options struct {
 	// The Filepath is mandatory.
 	Filepath string
+	// Formatter of the log entry. Default is logger.TextFormatter.
+	Formatter logger.Formatter
 }
 
 type file struct {
@@ -39,6 +38,7 @@ type file struct {
 
 // Write implements the log.Interface.
 // For the write process, a new go routine is spawned to avoid performance issues.
+// The entry is formatted by the configured formatter.
 // TODO: how to handle errors, error on benchmark to delete the benchmark file?
 func (c *file) Write(e logger.LogEntry) {
 	func(c *file, e logger.LogEntry) {
@@ -46,7 +46,7 @@ func (c *file) Write(e logger.LogEntry) {
 		defer c.lock.Unlock()
 
 		f, _ := os.OpenFile(c.options.Filepath, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0666)
-		f.WriteString(fmt.Sprintf("%s %s %s:%d %s", e.Timestamp.In(time.UTC).Format("2006-01-02 15:04:05"), e.Level.String(), filepath.Base(e.Filename), e.Line, e.Message) + "\n")
+		f.WriteString(c.options.Formatter.Format(e) + "\n")
 		f.Close()
 	}(c, e)
 }
@@ -60,6 +60,9 @@ func New(options Options) (*file, error) {
 	if f.options.Filepath == "" {
 		return nil, ErrFilepath
 	}
+	if f.options.Formatter == nil {
+		f.options.Formatter = &logger.TextFormatter{}
+	}
 
 	f.lock.Lock()
 	defer f.lock.Unlock()
@@ -71,4 +71,22 @@ func TestFile_Write(t *testing.T) {
 	// TODO error happens because of go routine.
 	err = os.Remove("test.log")
 	test.NoError(err)
+
+	// arguments and fields
+	e.Arguments = []interface{}{"arg"}
+	e.Fields = []logger.Field{{Key: "user", Value: 5}, {Key: "order", Value: "a b"}}
+	log.Write(e)
+	b, _ = ioutil.ReadFile("test.log")
+	test.Equal(fmt.Sprintf("%s %s %s:%d %s", e.Timestamp.In(time.UTC).Format("2006-01-02 15:04:05"), e.Level.String(), filepath.Base(e.Filename), e.Line, "Hello World [arg] user=5 order=\"a b\"")+"\n", string(b))
+	err = os.Remove("test.log")
+	test.NoError(err)
+
+	// formatter
+	log, err = file.New(file.Options{Filepath: "test.log", Formatter: &logger.LogfmtFormatter{TimeFormat: time.RFC3339}})
+	test.NoError(err)
+	log.Write(e)
+	b, _ = ioutil.ReadFile("test.log")
+	test.Equal(fmt.Sprintf("time=%s level=INFO caller=test.log:100 msg=\"Hello World\" args=[arg] user=5 order=\"a b\"\n", e.Timestamp.In(time.UTC).Format(time.RFC3339)), string(b))
+	err = os.Remove("test.log")
+	test.NoError(err)
 }
@@ -0,0 +1,201 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeFormat of the text and logfmt formatter.
+const DefaultTimeFormat = "2006-01-02 15:04:05"
+
+// reserved keys of the logfmt and json formatter.
+var reservedKeys = []string{"time", "level", "caller", "msg", "args"}
+
+// Formatter is used by the writers to convert a log entry into one line.
+type Formatter interface {
+	Format(LogEntry) string
+}
+
+// TextFormatter formats the entry as human readable line.
+//
+//	2020-01-01 10:00:00 INFO order.go:12 paid [arg1] user=5
+type TextFormatter struct {
+	// TimeFormat of the timestamp. Default is DefaultTimeFormat.
+	TimeFormat string
+	// Location of the timestamp. Default is UTC.
+	Location *time.Location
+	// Color adds a terminal color to the level.
+	Color bool
+}
+
+// Format implements the Formatter interface.
+func (f *TextFormatter) Format(e LogEntry) string {
+	lvl := e.Level.String()
+	if f.Color {
+		lvl = "\x1b[" + levelColor(e.Level) + "m" + lvl + "\x1b[39m"
+	}
+	return fmt.Sprintf("%s %s %s:%d %s", timestamp(e.Timestamp, f.TimeFormat, DefaultTimeFormat, f.Location), lvl, filepath.Base(e.Filename), e.Line, e.Text())
+}
+
+// LogfmtFormatter formats the entry as key=value pairs.
+// Spaces, =, " and non-printable characters of the field keys are replaced by an underscore.
+// Fields with a reserved key (time, level, caller, msg, args) are prefixed with "fields.", if a key is used more than once, a counter is added (user.1).
+//
+//	time="2020-01-01 10:00:00" level=INFO caller=order.go:12 msg=paid args=[arg1] user=5
+type LogfmtFormatter struct {
+	// TimeFormat of the timestamp. Default is DefaultTimeFormat.
+	TimeFormat string
+	// Location of the timestamp. Default is UTC.
+	Location *time.Location
+}
+
+// Format implements the Formatter interface.
+func (f *LogfmtFormatter) Format(e LogEntry) string {
+	var b strings.Builder
+	b.WriteString("time=" + fieldValue(timestamp(e.Timestamp, f.TimeFormat, DefaultTimeFormat, f.Location)))
+	b.WriteString(" level=" + e.Level.String())
+	b.WriteString(" caller=" + fieldValue(fmt.Sprintf("%s:%d", filepath.Base(e.Filename), e.Line)))
+	b.WriteString(" msg=" + fieldValue(e.Message))
+	if len(e.Arguments) > 0 {
+		b.WriteString(" args=" + fieldValue(fmt.Sprint(e.Arguments)))
+	}
+	keys := fieldKeys(e.Fields, logfmtKey)
+	for i, field := range e.Fields {
+		b.WriteString(" " + keys[i] + "=" + fieldValue(field.Value))
+	}
+	return b.String()
+}
+
+// JSONFormatter formats the entry as json object. The fields are added as keys of the object.
+// Fields with a reserved key (time, level, caller, msg, args) are prefixed with "fields.", if a key is used more than once, a counter is added (user.1).
+// Errors are added by their message, values which can not be marshaled as string.
+//
+//	{"time":"2020-01-01T10:00:00Z","level":"INFO","caller":"order.go:12","msg":"paid","args":["arg1"],"user":5}
+type JSONFormatter struct {
+	// TimeFormat of the timestamp. Default is time.RFC3339.
+	TimeFormat string
+	// Location of the timestamp. Default is UTC.
+	Location *time.Location
+}
+
+// Format implements the Formatter interface.
+func (f *JSONFormatter) Format(e LogEntry) string {
+	var b strings.Builder
+	b.WriteString("{\"time\":" + jsonValue(timestamp(e.Timestamp, f.TimeFormat, time.RFC3339, f.Location)))
+	b.WriteString(",\"level\":" + jsonValue(e.Level.String()))
+	b.WriteString(",\"caller\":" + jsonValue(fmt.Sprintf("%s:%d", filepath.Base(e.Filename), e.Line)))
+	b.WriteString(",\"msg\":" + jsonValue(e.Message))
+	if len(e.Arguments) > 0 {
+		args := make([]string, len(e.Arguments))
+		for i, arg := range e.Arguments {
+			args[i] = jsonValue(arg)
+		}
+		b.WriteString(",\"args\":[" + strings.Join(args, ",") + "]")
+	}
+	keys := fieldKeys(e.Fields, nil)
+	for i, field := range e.Fields {
+		b.WriteString("," + jsonValue(keys[i]) + ":" + jsonValue(field.Value))
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// levelColor returns the terminal color code of the level.
+func levelColor(lvl level) string {
+	switch lvl {
+	case TRACE:
+		return "92" //green
+	case DEBUG:
+		return "96" //Blue
+	case INFO:
+		return "93" //Yellow
+	case WARNING:
+		return "95" //Lila
+	case ERROR, CRITICAL:
+		return "91" //Red
+	}
+	return "39"
+}
+
+// timestamp returns the formatted time in the given location.
+// If the format is empty, the default format is used. If the location is nil, UTC is used.
+func timestamp(t time.Time, format string, def string, loc *time.Location) string {
+	if format == "" {
+		format = def
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	return t.In(loc).Format(format)
+}
+
+// fieldKeys returns a unique key for every field.
+// The keys are sanitized by the given function, if it is not nil. Reserved keys are prefixed with "fields.".
+// If a key is already used, a counter is added.
+func fieldKeys(fields []Field, sanitize func(string) string) []string {
+	used := make(map[string]bool, len(reservedKeys)+len(fields))
+	for _, r := range reservedKeys {
+		used[r] = true
+	}
+
+	keys := make([]string, len(fields))
+	for i, field := range fields {
+		key := field.Key
+		if sanitize != nil {
+			key = sanitize(key)
+		}
+		key = fieldKey(key)
+		unique := key
+		for n := 1; used[unique]; n++ {
+			unique = key + "." + strconv.Itoa(n)
+		}
+		used[unique] = true
+		keys[i] = unique
+	}
+	return keys
+}
+
+// fieldKey prefixes reserved keys with "fields.".
+func fieldKey(key string) string {
+	for _, r := range reservedKeys {
+		if key == r {
+			return "fields." + key
+		}
+	}
+	return key
+}
+
+// logfmtKey replaces all characters, which would need quotes, with an underscore.
+// An empty key is returned as underscore.
+func logfmtKey(key string) string {
+	if key == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		if needsQuote(r) {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+// jsonValue returns the json encoded value.
+// Errors are encoded by their message and values which can not be marshaled as string.
+func jsonValue(v interface{}) string {
+	if err, ok := v.(error); ok {
+		v = err.Error()
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(v))
+	}
+	return string(b)
+}
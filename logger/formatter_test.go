@@ -0,0 +1,92 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package logger_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/patrickascher/gofw/logger"
+	"github.com/stretchr/testify/assert"
+)
+
+// formatterEntry returns a log entry for the formatter tests.
+func formatterEntry() logger.LogEntry {
+	return logger.LogEntry{
+		Level:     logger.INFO,
+		Filename:  "/path/order.go",
+		Line:      12,
+		Timestamp: time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC),
+		Message:   "paid",
+		Arguments: []interface{}{"arg1", 2},
+		Fields:    []logger.Field{{Key: "user", Value: 5}, {Key: "name", Value: "John Doe"}, {Key: "msg", Value: "x"}, {Key: "err", Value: errors.New("failed")}},
+	}
+}
+
+func TestTextFormatter_Format(t *testing.T) {
+	test := assert.New(t)
+	e := formatterEntry()
+
+	// ok: defaults
+	f := &logger.TextFormatter{}
+	test.Equal(`2020-01-01 10:00:00 INFO order.go:12 paid [arg1 2] user=5 name="John Doe" msg=x err=failed`, f.Format(e))
+
+	// ok: color
+	f.Color = true
+	test.Equal("2020-01-01 10:00:00 \x1b[93mINFO\x1b[39m order.go:12 paid [arg1 2] user=5 name=\"John Doe\" msg=x err=failed", f.Format(e))
+
+	// ok: time format and location
+	loc := time.FixedZone("CET", 3600)
+	f = &logger.TextFormatter{TimeFormat: time.RFC3339, Location: loc}
+	test.Equal(`2020-01-01T11:00:00+01:00 INFO order.go:12 paid [arg1 2] user=5 name="John Doe" msg=x err=failed`, f.Format(e))
+}
+
+func TestLogfmtFormatter_Format(t *testing.T) {
+	test := assert.New(t)
+	e := formatterEntry()
+
+	// ok: defaults
+	f := &logger.LogfmtFormatter{}
+	test.Equal(`time="2020-01-01 10:00:00" level=INFO caller=order.go:12 msg=paid args="[arg1 2]" user=5 name="John Doe" fields.msg=x err=failed`, f.Format(e))
+
+	// ok: without arguments and custom time format
+	e.Arguments = nil
+	e.Fields = nil
+	e.Message = "order paid"
+	f = &logger.LogfmtFormatter{TimeFormat: time.Kitchen}
+	test.Equal(`time=10:00AM level=INFO caller=order.go:12 msg="order paid"`, f.Format(e))
+
+	// ok: keys are sanitized and unique
+	e.Message = "paid"
+	e.Fields = []logger.Field{{Key: "user id", Value: 5}, {Key: "a=b", Value: 1}, {Key: "", Value: 2}, {Key: "fields.msg", Value: "a"}, {Key: "msg", Value: "b"}, {Key: "user_id", Value: 6}}
+	test.Equal(`time=10:00AM level=INFO caller=order.go:12 msg=paid user_id=5 a_b=1 _=2 fields.msg=a fields.msg.1=b user_id.1=6`, f.Format(e))
+}
+
+func TestJSONFormatter_Format(t *testing.T) {
+	test := assert.New(t)
+	e := formatterEntry()
+	e.Fields = append(e.Fields, logger.Field{Key: "fn", Value: func() {}})
+
+	// ok: defaults
+	f := &logger.JSONFormatter{}
+	out := f.Format(e)
+	test.Equal(`{"time":"2020-01-01T10:00:00Z","level":"INFO","caller":"order.go:12","msg":"paid","args":["arg1",2],"user":5,"name":"John Doe","fields.msg":"x","err":"failed","fn":`, out[:strings.Index(out, `"fn":`)+5])
+	var m map[string]interface{}
+	test.NoError(json.Unmarshal([]byte(out), &m))
+	test.IsType("", m["fn"])
+
+	// ok: without arguments and custom time format and location
+	e.Arguments = nil
+	e.Fields = nil
+	f = &logger.JSONFormatter{TimeFormat: logger.DefaultTimeFormat, Location: time.FixedZone("CET", 3600)}
+	test.Equal(`{"time":"2020-01-01 11:00:00","level":"INFO","caller":"order.go:12","msg":"paid"}`, f.Format(e))
+
+	// ok: keys are unique
+	e.Fields = []logger.Field{{Key: "fields.msg", Value: "a"}, {Key: "msg", Value: "b"}, {Key: "user id", Value: 5}}
+	test.Equal(`{"time":"2020-01-01 11:00:00","level":"INFO","caller":"order.go:12","msg":"paid","fields.msg":"a","fields.msg.1":"b","user id":5}`, f.Format(e))
+}
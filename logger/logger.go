@@ -14,7 +14,11 @@ import (
 	"errors"
 	"fmt"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
 // Log levels
@@ -67,6 +71,12 @@ func (lvl level) String() string {
 	}
 }
 
+// Field is a structured key/value pair of a log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
 // LogEntry is representing the actual log message.
 type LogEntry struct {
 	Level     level
@@ -75,13 +85,47 @@ type LogEntry struct {
 	Timestamp time.Time
 	Message   string
 	Arguments []interface{}
+	Fields    []Field
+}
+
+// Text returns the message with the arguments and fields, like it is written by the console and file provider.
+// Arguments are added in brackets and fields as key=value pairs. Values with spaces, quotes or an equal sign are quoted.
+//
+//	paid [arg1 arg2] user=5 order=7
+func (e LogEntry) Text() string {
+	var b strings.Builder
+	b.WriteString(e.Message)
+	if len(e.Arguments) > 0 {
+		b.WriteString(" " + fmt.Sprint(e.Arguments))
+	}
+	for _, f := range e.Fields {
+		b.WriteString(" " + logfmtKey(f.Key) + "=" + fieldValue(f.Value))
+	}
+	return b.String()
+}
+
+// fieldValue returns the value as string. It is quoted if necessary.
+// Empty values, values with a space, = or " and values with control or non-printable characters are quoted.
+func fieldValue(v interface{}) string {
+	s := fmt.Sprint(v)
+	if s == "" || !utf8.ValidString(s) || strings.IndexFunc(s, needsQuote) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// needsQuote returns true if the rune is not allowed in an unquoted value.
+func needsQuote(r rune) bool {
+	return r == ' ' || r == '=' || r == '"' || !unicode.IsPrint(r)
 }
 
 // Config for the log instance.
 // Writer is mandatory, all others are optional.
 // If the LogLevel is empty, TRACE will be set as default.
+// Mask is called for the message, the arguments and the field values before they are passed to the writer (e.g. config.MaskString).
 type Config struct {
 	LogLevel       level
+	Mask           func(string) string
 	Writer         Interface
 	TraceWriter    Interface
 	DebugWriter    Interface
@@ -93,6 +137,8 @@ type Config struct {
 
 type Logger struct {
 	writer map[level]Interface
+	fields []Field
+	mask   func(string) string
 }
 
 // setConfig for the log.
@@ -162,6 +208,7 @@ func Register(name string, c Config) error {
 
 	// configure the log
 	t.setConfig(c)
+	t.mask = c.Mask
 
 	// adding the log to the registry
 	if registry == nil {
@@ -181,6 +228,40 @@ func Get(name string) (*Logger, error) {
 	return nil, fmt.Errorf(ErrUnknownLogger.Error(), name)
 }
 
+// With returns a child logger with the given key/value pairs as fields.
+// The child inherits the writers and fields of the logger, an existing key is overwritten.
+// If the number of arguments is odd, the value of the last key is nil.
+//
+//	log.With("user", id, "order", 7).Info("paid")
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	fields := make([]Field, len(l.fields), len(l.fields)+(len(keyvals)+1)/2)
+	copy(fields, l.fields)
+
+	for i := 0; i < len(keyvals); i += 2 {
+		f := Field{Key: fmt.Sprint(keyvals[i])}
+		if i+1 < len(keyvals) {
+			f.Value = keyvals[i+1]
+		}
+		if n := fieldIndex(fields, f.Key); n >= 0 {
+			fields[n] = f
+			continue
+		}
+		fields = append(fields, f)
+	}
+
+	return &Logger{writer: l.writer, fields: fields, mask: l.mask}
+}
+
+// fieldIndex returns the index of the key or -1 if it does not exist.
+func fieldIndex(fields []Field, key string) int {
+	for i := range fields {
+		if fields[i].Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
 // log calls the Writer.Write method
 func (l *Logger) log(lvl level, msg string, args ...interface{}) {
 
@@ -201,12 +282,46 @@ func (l *Logger) log(lvl level, msg string, args ...interface{}) {
 		Timestamp: time.Now(),
 		Message:   msg,
 		Arguments: args,
+		Fields:    l.fields,
+	}
+	if l.mask != nil {
+		entry = entry.masked(l.mask)
 	}
 
 	//call the writer
 	l.writer[lvl].Write(entry)
 }
 
+// masked returns a copy of the entry, where the message, arguments and field values are masked.
+// Arguments and field values are only replaced by the masked string if the mask has changed them.
+func (e LogEntry) masked(mask func(string) string) LogEntry {
+	e.Message = mask(e.Message)
+	if len(e.Arguments) > 0 {
+		args := make([]interface{}, len(e.Arguments))
+		for i, arg := range e.Arguments {
+			args[i] = maskValue(arg, mask)
+		}
+		e.Arguments = args
+	}
+	if len(e.Fields) > 0 {
+		fields := make([]Field, len(e.Fields))
+		for i, f := range e.Fields {
+			fields[i] = Field{Key: f.Key, Value: maskValue(f.Value, mask)}
+		}
+		e.Fields = fields
+	}
+	return e
+}
+
+// maskValue returns the masked string of the value, if the mask has changed it. Otherwise the value is returned unchanged.
+func maskValue(v interface{}, mask func(string) string) interface{} {
+	s := fmt.Sprint(v)
+	if m := mask(s); m != s {
+		return m
+	}
+	return v
+}
+
 // Trace log message
 func (l *Logger) Trace(msg string, args ...interface{}) {
 	l.log(TRACE, msg, args...)
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -227,6 +228,73 @@ func TestLogger_Log(t *testing.T) {
 	}
 }
 
+// TestLogger_With is checking if the fields are added to the LogEntry and inherited by child loggers.
+func TestLogger_With(t *testing.T) {
+	test := assert.New(t)
+	mockProvider, err := NewMockProvider()
+	test.NoError(err)
+	test.NoError(logger.Register("mock", logger.Config{Writer: mockProvider}))
+	log, err := logger.Get("mock")
+	test.NoError(err)
+
+	// ok: no fields
+	log.Info("paid")
+	test.Nil(mockLogger.Entry.Fields)
+
+	// ok: fields
+	child := log.With("user", 5, "order", 7)
+	child.Info("paid")
+	test.Equal([]logger.Field{{Key: "user", Value: 5}, {Key: "order", Value: 7}}, mockLogger.Entry.Fields)
+	test.Equal("logger_test.go", filepath.Base(mockLogger.Entry.Filename))
+
+	// ok: inherited, existing keys are overwritten, odd arguments
+	child.With("order", 8, "status").Error("failed")
+	test.Equal([]logger.Field{{Key: "user", Value: 5}, {Key: "order", Value: 8}, {Key: "status", Value: nil}}, mockLogger.Entry.Fields)
+
+	// ok: parent is not changed
+	child.Info("paid")
+	test.Equal([]logger.Field{{Key: "user", Value: 5}, {Key: "order", Value: 7}}, mockLogger.Entry.Fields)
+	log.Info("paid")
+	test.Nil(mockLogger.Entry.Fields)
+}
+
+// TestLogger_Mask is checking if the message, arguments and field values are masked.
+func TestLogger_Mask(t *testing.T) {
+	test := assert.New(t)
+	mockProvider, err := NewMockProvider()
+	test.NoError(err)
+	mask := func(s string) string { return strings.Replace(s, "s3cret", "******", -1) }
+	test.NoError(logger.Register("mock", logger.Config{Writer: mockProvider, Mask: mask}))
+	log, err := logger.Get("mock")
+	test.NoError(err)
+
+	// ok: masked values are replaced by the string, other values keep their type
+	fields := log.With("dsn", "root:s3cret@tcp", "port", 3306)
+	fields.Info("connect s3cret", "s3cret", 5, fmt.Errorf("auth s3cret"))
+	test.Equal("connect ******", mockLogger.Entry.Message)
+	test.Equal([]interface{}{"******", 5, "auth ******"}, mockLogger.Entry.Arguments)
+	test.Equal([]logger.Field{{Key: "dsn", Value: "root:******@tcp"}, {Key: "port", Value: 3306}}, mockLogger.Entry.Fields)
+}
+
+func TestLogEntry_Text(t *testing.T) {
+	test := assert.New(t)
+
+	e := logger.LogEntry{Message: "paid"}
+	test.Equal("paid", e.Text())
+
+	e.Arguments = []interface{}{"arg1", 2}
+	e.Fields = []logger.Field{{Key: "user", Value: 5}, {Key: "name", Value: "John Doe"}, {Key: "empty", Value: ""}, {Key: "err", Value: fmt.Errorf("a=b")}}
+	test.Equal(`paid [arg1 2] user=5 name="John Doe" empty="" err="a=b"`, e.Text())
+
+	// ok: control and non-printable characters are quoted
+	e.Fields = []logger.Field{{Key: "cr", Value: "a\rb"}, {Key: "esc", Value: "\x1b[31m"}, {Key: "nbsp", Value: "a\u00a0b"}, {Key: "invalid", Value: "a\xffb"}, {Key: "unicode", Value: "größe"}}
+	test.Equal(`paid [arg1 2] cr="a\rb" esc="\x1b[31m" nbsp="a\u00a0b" invalid="a\xffb" unicode=größe`, e.Text())
+
+	// ok: keys are sanitized
+	e.Fields = []logger.Field{{Key: "user id", Value: 5}, {Key: "a=b", Value: 1}}
+	test.Equal(`paid [arg1 2] user_id=5 a_b=1`, e.Text())
+}
+
 // This example demonstrate the basics of the log.Interface.
 // For more details check the documentation.
 func Example() {
@@ -0,0 +1,263 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package cache caches full HTTP responses (status, headers and body) in any cache.Interface.
+// Only GET and HEAD requests are cached. The key is created by the method, path, query and the configured Vary headers.
+//
+// Every cached response gets an ETag. If the request header If-None-Match matches, a 304 will return without body.
+// Responses with the header Cache-Control no-store or private, responses with a Set-Cookie header and responses with a not cacheable status are not stored.
+// Requests with an Authorization or Cookie header are not cached, unless Options.Credentials is set.
+//
+//	c := cache.New(memoryCache, cache.Options{TTL: time.Minute, Vary: []string{"Accept-Language"}})
+//	middleware.Add(c.MW)
+//
+//	// per route ttl
+//	router.RouteConfig{"router.GET:List", middleware.New(c.TTL(5 * time.Minute))}
+package cache
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	cm "github.com/patrickascher/gofw/cache"
+)
+
+// defaults of the middleware.
+var (
+	defaultTTL    = time.Minute
+	defaultPrefix = "__http__:"
+)
+
+// Header which is added to the response with the value HIT or MISS.
+const Header = "X-Cache"
+
+// cacheable HTTP status codes, which are cacheable by default (RFC 7231).
+var cacheable = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusNotImplemented:       true,
+}
+
+// init registers the response type, so that every codec can decode it.
+func init() {
+	_ = cm.RegisterType(response{})
+}
+
+// Cache middleware.
+type Cache struct {
+	cache   cm.Interface
+	options Options
+}
+
+// Options for the cache middleware.
+type Options struct {
+	// TTL of the cached responses. Default is 1 minute.
+	TTL time.Duration
+	// Vary headers are added to the key. Like this different representations of the same url are cached separately.
+	Vary []string
+	// Prefix is added to the keys. Default is "__http__:".
+	Prefix string
+	// Credentials enables the cache for requests with an Authorization or Cookie header.
+	// Only enable it if the responses do not depend on the user, or the credential headers are added to Vary.
+	Credentials bool
+}
+
+// response is the cached representation of a response.
+type response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// New returns a cache middleware.
+func New(c cm.Interface, options Options) *Cache {
+	if options.TTL <= 0 {
+		options.TTL = defaultTTL
+	}
+	if options.Prefix == "" {
+		options.Prefix = defaultPrefix
+	}
+	for i := range options.Vary {
+		options.Vary[i] = http.CanonicalHeaderKey(options.Vary[i])
+	}
+	sort.Strings(options.Vary)
+	return &Cache{cache: c, options: options}
+}
+
+// MW will be passed to the middleware.
+// The responses are cached for Options.TTL.
+func (c *Cache) MW(h http.HandlerFunc) http.HandlerFunc {
+	return c.TTL(c.options.TTL)(h)
+}
+
+// TTL returns a middleware, which caches the responses for the given ttl.
+// It can be used to define a ttl per route.
+func (c *Cache) TTL(ttl time.Duration) func(http.HandlerFunc) http.HandlerFunc {
+	return func(h http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if (r.Method != http.MethodGet && r.Method != http.MethodHead) || (!c.options.Credentials && credentials(r)) {
+				h(w, r)
+				return
+			}
+
+			key := c.key(r)
+			if v, err := c.cache.Get(key); err == nil {
+				if res, ok := v.Value().(response); ok {
+					res.write(w, r, "HIT")
+					return
+				}
+			}
+
+			// the response is buffered, because the ETag must be set before the body is written.
+			rec := newRecorder()
+			h(rec, r)
+			res := response{Status: rec.status, Header: rec.header, Body: rec.body.Bytes()}
+
+			if store(res) {
+				if res.Header.Get("ETag") == "" {
+					res.Header.Set("ETag", etag(res.Body))
+				}
+				if len(c.options.Vary) > 0 {
+					res.Header.Set("Vary", vary(res.Header.Values("Vary"), c.options.Vary))
+				}
+				_ = c.cache.Set(key, res, ttl)
+			}
+			res.write(w, r, "MISS")
+		}
+	}
+}
+
+// key returns the cache key of the request.
+// The query parameters are sorted, so that the order does not matter.
+func (c *Cache) key(r *http.Request) string {
+	var b strings.Builder
+	b.WriteString(c.options.Prefix)
+	b.WriteString(r.Method)
+	b.WriteString(" ")
+	b.WriteString(r.URL.Path)
+	b.WriteString("?")
+	b.WriteString(r.URL.Query().Encode())
+	for _, h := range c.options.Vary {
+		b.WriteString("|")
+		b.WriteString(h)
+		b.WriteString("=")
+		b.WriteString(strings.Join(r.Header.Values(h), ","))
+	}
+	return b.String()
+}
+
+// write the response. If the request header If-None-Match matches the ETag, a 304 will return.
+// The header values are copied, because the cached response is shared between the requests.
+func (res response) write(w http.ResponseWriter, r *http.Request, state string) {
+	for k, v := range res.Header {
+		w.Header()[k] = append([]string(nil), v...)
+	}
+	w.Header().Set(Header, state)
+
+	if tag := res.Header.Get("ETag"); tag != "" && cacheable[res.Status] && match(r.Header.Get("If-None-Match"), tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.WriteHeader(res.Status)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(res.Body)
+	}
+}
+
+// vary returns the comma separated Vary header of the existing values and the configured headers.
+// Headers which already exist are not added again.
+func vary(values []string, headers []string) string {
+	var rv []string
+	exists := make(map[string]bool)
+	for _, h := range append(strings.Split(strings.Join(values, ","), ","), headers...) {
+		h = http.CanonicalHeaderKey(strings.TrimSpace(h))
+		if h != "" && !exists[h] {
+			exists[h] = true
+			rv = append(rv, h)
+		}
+	}
+	return strings.Join(rv, ", ")
+}
+
+// credentials returns true if the request has an Authorization or Cookie header.
+func credentials(r *http.Request) bool {
+	return r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != ""
+}
+
+// store returns true if the response can be cached.
+// Responses which are setting a cookie are never stored, because the cookie would be replayed to other clients.
+func store(res response) bool {
+	if !cacheable[res.Status] || len(res.Header.Values("Set-Cookie")) > 0 {
+		return false
+	}
+	cc := strings.ToLower(res.Header.Get("Cache-Control"))
+	return !strings.Contains(cc, "no-store") && !strings.Contains(cc, "private")
+}
+
+// etag returns a strong ETag of the body.
+func etag(body []byte) string {
+	h := sha1.Sum(body)
+	return `"` + hex.EncodeToString(h[:]) + `"`
+}
+
+// match returns true if one of the If-None-Match tags matches the ETag.
+// The weak comparison is used (RFC 7232).
+func match(ifNoneMatch string, tag string) bool {
+	if ifNoneMatch == "" {
+		return false
+	}
+	tag = strings.TrimPrefix(tag, "W/")
+	for _, t := range strings.Split(ifNoneMatch, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// recorder is a response writer which buffers the status, header and body.
+type recorder struct {
+	header      http.Header
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+// newRecorder returns a new recorder.
+func newRecorder() *recorder {
+	return &recorder{header: make(http.Header), status: http.StatusOK}
+}
+
+// Header returns the response header.
+func (rec *recorder) Header() http.Header {
+	return rec.header
+}
+
+// WriteHeader sets the status, only the first call is used.
+func (rec *recorder) WriteHeader(status int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.status = status
+	rec.wroteHeader = true
+}
+
+// Write adds the bytes to the body.
+func (rec *recorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	return rec.body.Write(b)
+}
@@ -0,0 +1,226 @@
+// Copyright 2020 Patrick Ascher <pat@fullhouse-productions.com>. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cache_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	cm "github.com/patrickascher/gofw/cache"
+	"github.com/patrickascher/gofw/cache/memory"
+	"github.com/patrickascher/gofw/middleware"
+	"github.com/patrickascher/gofw/middleware/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+// handler returns a handler which counts the calls.
+func handler(calls *int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/private" {
+			w.Header().Set("Cache-Control", "private")
+		}
+		if r.URL.Path == "/login" {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: fmt.Sprint(*calls)})
+		}
+		if r.URL.Path == "/vary" {
+			w.Header().Set("Vary", "accept-language, Accept-Encoding")
+		}
+		if r.URL.Path == "/error" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		_, _ = w.Write([]byte(fmt.Sprintf(`{"lang":"%s","calls":%d}`, r.Header.Get("Accept-Language"), *calls)))
+	}
+}
+
+// request executes the handler and returns the recorder.
+func request(h http.HandlerFunc, method string, url string, header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, url, nil)
+	for k, v := range header {
+		r.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
+
+func TestCache_MW(t *testing.T) {
+	calls := 0
+	c := cache.New(memory.New(nil), cache.Options{Vary: []string{"accept-language"}})
+	h := middleware.New(c.MW).Handle(handler(&calls))
+
+	// ok: miss
+	w := request(h, http.MethodGet, "/users?a=1&b=2", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "MISS", w.Header().Get(cache.Header))
+	assert.Equal(t, `{"lang":"","calls":1}`, w.Body.String())
+	assert.Equal(t, "Accept-Language", w.Header().Get("Vary"))
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	// ok: hit, query order does not matter
+	w = request(h, http.MethodGet, "/users?b=2&a=1", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "HIT", w.Header().Get(cache.Header))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, `{"lang":"","calls":1}`, w.Body.String())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	assert.Equal(t, 1, calls)
+
+	// ok: vary header
+	w = request(h, http.MethodGet, "/users?a=1&b=2", map[string]string{"Accept-Language": "de"})
+	assert.Equal(t, "MISS", w.Header().Get(cache.Header))
+	assert.Equal(t, `{"lang":"de","calls":2}`, w.Body.String())
+
+	// ok: revalidation
+	w = request(h, http.MethodGet, "/users?a=1&b=2", map[string]string{"If-None-Match": `"foo", W/` + etag})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Equal(t, "", w.Body.String())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+
+	// ok: head
+	w = request(h, http.MethodHead, "/users", nil)
+	assert.Equal(t, "MISS", w.Header().Get(cache.Header))
+	assert.Equal(t, "", w.Body.String())
+
+	// ok: not cached methods, status and private responses
+	for _, req := range [][]string{{http.MethodPost, "/users"}, {http.MethodGet, "/error"}, {http.MethodGet, "/private"}} {
+		before := calls
+		request(h, req[0], req[1], nil)
+		w = request(h, req[0], req[1], nil)
+		assert.Equal(t, before+2, calls)
+		assert.NotEqual(t, "HIT", w.Header().Get(cache.Header))
+	}
+}
+
+func TestCache_Header(t *testing.T) {
+	calls := 0
+	c := cache.New(memory.New(nil), cache.Options{Vary: []string{"Accept-Language"}})
+	h := middleware.New(c.MW).Handle(handler(&calls))
+
+	// ok: vary headers are not duplicated
+	w := request(h, http.MethodGet, "/vary", nil)
+	assert.Equal(t, "Accept-Language, Accept-Encoding", w.Header().Get("Vary"))
+	w = request(h, http.MethodGet, "/vary", nil)
+	assert.Equal(t, "HIT", w.Header().Get(cache.Header))
+	assert.Equal(t, []string{"Accept-Language, Accept-Encoding"}, w.Header().Values("Vary"))
+
+	// ok: changes of the written header are not changing the cached response
+	w.Header()["Content-Type"][0] = "text/plain"
+	w.Header()["Vary"][0] = "Cookie"
+	w = request(h, http.MethodGet, "/vary", nil)
+	assert.Equal(t, "HIT", w.Header().Get(cache.Header))
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, "Accept-Language, Accept-Encoding", w.Header().Get("Vary"))
+	assert.Equal(t, 1, calls)
+}
+
+func TestCache_Credentials(t *testing.T) {
+	calls := 0
+	c := cache.New(memory.New(nil), cache.Options{})
+	h := middleware.New(c.MW).Handle(handler(&calls))
+
+	// ok: requests with credentials are not cached
+	for _, header := range []map[string]string{{"Authorization": "Bearer token"}, {"Cookie": "session=1"}} {
+		before := calls
+		request(h, http.MethodGet, "/users", header)
+		w := request(h, http.MethodGet, "/users", header)
+		assert.Equal(t, before+2, calls)
+		assert.Equal(t, "", w.Header().Get(cache.Header))
+	}
+	// ok: the response of a request with credentials was not stored
+	w := request(h, http.MethodGet, "/users", nil)
+	assert.Equal(t, "MISS", w.Header().Get(cache.Header))
+
+	// ok: responses with a cookie are not stored
+	before := calls
+	request(h, http.MethodGet, "/login", nil)
+	w = request(h, http.MethodGet, "/login", nil)
+	assert.Equal(t, before+2, calls)
+	assert.Equal(t, "MISS", w.Header().Get(cache.Header))
+	assert.Equal(t, fmt.Sprintf("session=%d", before+2), w.Header().Get("Set-Cookie"))
+
+	// ok: credentials are enabled
+	c = cache.New(memory.New(nil), cache.Options{Credentials: true, Vary: []string{"Authorization"}})
+	h = middleware.New(c.MW).Handle(handler(&calls))
+	request(h, http.MethodGet, "/users", map[string]string{"Authorization": "Bearer token"})
+	w = request(h, http.MethodGet, "/users", map[string]string{"Authorization": "Bearer token"})
+	assert.Equal(t, "HIT", w.Header().Get(cache.Header))
+	w = request(h, http.MethodGet, "/users", map[string]string{"Authorization": "Bearer other"})
+	assert.Equal(t, "MISS", w.Header().Get(cache.Header))
+}
+
+func TestCache_TTL(t *testing.T) {
+	calls := 0
+	mem, err := cm.New(cm.MEMORY, memory.Options{GCInterval: time.Millisecond})
+	assert.NoError(t, err)
+	defer mem.Close()
+	c := cache.New(mem, cache.Options{})
+	h := middleware.New(c.TTL(10 * time.Millisecond)).Handle(handler(&calls))
+
+	request(h, http.MethodGet, "/users", nil)
+	w := request(h, http.MethodGet, "/users", nil)
+	assert.Equal(t, "HIT", w.Header().Get(cache.Header))
+
+	// ok: expired
+	time.Sleep(20 * time.Millisecond)
+	w = request(h, http.MethodGet, "/users", nil)
+	assert.Equal(t, "MISS", w.Header().Get(cache.Header))
+	assert.Equal(t, 2, calls)
+}
+
+func TestCache_Codec(t *testing.T) {
+	calls := 0
+	c := cache.New(codecCache{Interface: memory.New(nil), codec: cm.JSON}, cache.Options{})
+	h := middleware.New(c.MW).Handle(handler(&calls))
+
+	request(h, http.MethodGet, "/users", nil)
+	w := request(h, http.MethodGet, "/users", nil)
+	assert.Equal(t, "HIT", w.Header().Get(cache.Header))
+	assert.Equal(t, `{"lang":"","calls":1}`, w.Body.String())
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+}
+
+// codecCache encodes the values like an out-of-process provider.
+type codecCache struct {
+	cm.Interface
+	codec cm.Codec
+}
+
+// Set the encoded value.
+func (c codecCache) Set(key string, value interface{}, ttl time.Duration, tags ...string) error {
+	b, err := c.codec.Encode(value)
+	if err != nil {
+		return err
+	}
+	return c.Interface.Set(key, b, ttl, tags...)
+}
+
+// Get the decoded value.
+func (c codecCache) Get(key string) (cm.Valuer, error) {
+	v, err := c.Interface.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	val, err := c.codec.Decode(v.Value().([]byte))
+	if err != nil {
+		return nil, err
+	}
+	return value{val}, nil
+}
+
+// value implements the cache.Valuer interface.
+type value struct {
+	val interface{}
+}
+
+// Value returns the value.
+func (v value) Value() interface{} {
+	return v.val
+}
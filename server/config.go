@@ -1,9 +1,12 @@
 package server
 
 import (
+	"encoding/json"
 	"errors"
 	"github.com/patrickascher/gofw/sqlquery"
 	"reflect"
+	"strconv"
+	"time"
 )
 
 var cfg *Config
@@ -15,10 +18,10 @@ var (
 )
 
 type Config struct {
-	Databases    []*sqlquery.Config `json:"databases" validate:"min=1"`
+	Databases    []*sqlquery.Config `json:"databases" validate:"min=1" merge:"key=name"`
 	Server       Server             `json:"server" validate:"required"`
 	Router       RouterProvider     `json:"router" validate:"required"`
-	CacheManager []CacheProvider    `json:"caches" validate:"min=1"`
+	CacheManager []CacheProvider    `json:"caches" validate:"min=1" merge:"key=name"`
 }
 
 type Server struct {
@@ -32,8 +35,8 @@ type Server struct {
 type RouterProvider struct {
 	Provider    string      `json:"provider" validate:"required"`
 	Favicon     string      `json:"favicon"`
-	Directories []UrlSource `json:"directories"`
-	Files       []UrlSource `json:"files"`
+	Directories []UrlSource `json:"directories" merge:"key=url"`
+	Files       []UrlSource `json:"files" merge:"key=url"`
 }
 
 type UrlSource struct {
@@ -42,8 +45,47 @@ type UrlSource struct {
 }
 
 type CacheProvider struct {
+	// Name of the cache. If it is empty, the provider name is used.
+	Name     string `json:"name"`
 	Provider string `json:"provider" validate:"required"`
-	GCCycle  int64  `json:"cycle" validate:"required"` // int * Minutes
+	// GCCycle is the interval of the garbage collector, as duration string (e.g. "5m").
+	// A number is handled as minutes.
+	GCCycle Duration `json:"cycle"`
+	// Options are decoded into the options of the provider.
+	// Durations can be set as duration string (e.g. "30s") or as number in nanoseconds.
+	Options json.RawMessage `json:"options"`
+}
+
+// Duration can be defined as duration string (e.g. "5m") or as number of minutes.
+type Duration time.Duration
+
+// UnmarshalJSON accepts a duration string or a number of minutes.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		return d.UnmarshalText([]byte(s))
+	}
+	var n int64
+	if err := json.Unmarshal(b, &n); err != nil {
+		return err
+	}
+	*d = Duration(time.Duration(n) * time.Minute)
+	return nil
+}
+
+// UnmarshalText accepts a duration string or a number of minutes.
+// It is used for environment variables.
+func (d *Duration) UnmarshalText(b []byte) error {
+	if n, err := strconv.ParseInt(string(b), 10, 64); err == nil {
+		*d = Duration(time.Duration(n) * time.Minute)
+		return nil
+	}
+	v, err := time.ParseDuration(string(b))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
 }
 
 // config returns the loaded configuration.
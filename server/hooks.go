@@ -1,10 +1,19 @@
 package server
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/patrickascher/gofw/cache/db"
+	"github.com/patrickascher/gofw/cache/file"
 	"github.com/patrickascher/gofw/cache/memory"
+	"github.com/patrickascher/gofw/cache/redis"
+	"github.com/patrickascher/gofw/cache/tiered"
+	fwConfig "github.com/patrickascher/gofw/config"
 	"github.com/patrickascher/gofw/logger/console"
 	"github.com/patrickascher/gofw/router/httprouter"
+	"reflect"
+	"strings"
 	"time"
 
 	"github.com/patrickascher/gofw/cache"
@@ -15,11 +24,24 @@ import (
 
 var (
 	cfgLogger  *logger.Logger
-	cfgCache   []cache.Interface
+	cfgCache   []namedCache
 	cfgBuilder []sqlquery.Builder
 	cfgRouter  *router.Manager
 )
 
+// Error messages
+var (
+	ErrCacheNotExist    = errors.New("server: cache %v does not exist")
+	ErrCacheName        = errors.New("server: cache name %v is used twice")
+	ErrCacheUnsupported = errors.New("server: cache provider %v can not be configured")
+)
+
+// namedCache is a configured cache with its name.
+type namedCache struct {
+	name  string
+	cache cache.Interface
+}
+
 // Logger returns the default log.
 // Logger is always defined.
 func Logger() *logger.Logger {
@@ -27,6 +49,7 @@ func Logger() *logger.Logger {
 }
 
 // initLogger is setting a console log.
+// Secret values of the config are masked (see config.MaskString).
 func initLogger() error {
 	var err error
 
@@ -35,7 +58,7 @@ func initLogger() error {
 		return err
 	}
 
-	err = logger.Register("console", logger.Config{Writer: c})
+	err = logger.Register("console", logger.Config{Writer: c, Mask: fwConfig.MaskString})
 	if err != nil {
 		return err
 	}
@@ -51,7 +74,7 @@ func initLogger() error {
 // Builder returns the configured database.
 // If no database is defined, the builder will be nil.
 func Builder(name string) (sqlquery.Builder, error) {
-	if name == DEFAULT {
+	if name == DEFAULT && len(cfgBuilder) > 0 {
 		return cfgBuilder[0], nil
 	}
 	for _, b := range cfgBuilder {
@@ -86,18 +109,23 @@ func initBuilder() error {
 	return nil
 }
 
-// Cache returns the configured cache.
-// If no cache is defined, this will be nil.
+// Cache returns the configured cache by its name.
+// The name is the configured name or the provider name, if no name is set.
+// DEFAULT returns the first configured cache.
+// Error will return if the cache does not exist.
 func Cache(name string) (cache.Interface, error) {
-	if name == DEFAULT {
-		return cfgCache[0], nil
+	if name == DEFAULT && len(cfgCache) > 0 {
+		return cfgCache[0].cache, nil
 	}
-
-	// TODO set a name/config to the cache. otherwise i can not iterate over it.
-	return nil, nil
+	for _, c := range cfgCache {
+		if c.name == name {
+			return c.cache, nil
+		}
+	}
+	return nil, fmt.Errorf(ErrCacheNotExist.Error(), name)
 }
 
-// initCache initialize the cache provider if set in the config.
+// initCache initialize the cache providers if set in the config.
 func initCache() error {
 	c, err := config()
 	if err != nil {
@@ -106,17 +134,200 @@ func initCache() error {
 
 	for _, ca := range c.CacheManager {
 		if ca.Provider != "" {
-			c, err := cache.New(ca.Provider, memory.Options{GCInterval: time.Duration(ca.GCCycle) * time.Minute})
+			name := ca.Name
+			if name == "" {
+				name = ca.Provider
+			}
+			if _, err := Cache(name); err == nil {
+				return fmt.Errorf(ErrCacheName.Error(), name)
+			}
+
+			options, err := cacheOptions(ca)
 			if err != nil {
 				return err
 			}
-			cfgCache = append(cfgCache, c)
+			c, err := cache.New(ca.Provider, options)
+			if err != nil {
+				// the invalidator is owned by the tiered cache, which was not created.
+				if opt, ok := options.(tiered.Options); ok && opt.CloseInvalidator && opt.Invalidator != nil {
+					_ = opt.Invalidator.Close()
+				}
+				return err
+			}
+			cfgCache = append(cfgCache, namedCache{name: name, cache: c})
 		}
 	}
 
 	return nil
 }
 
+// cacheOptions decodes the configured options into the options of the provider.
+// The GCCycle is used as garbage collector interval of all providers, if the options do not define one.
+// The db provider uses the builder with the configured name (default: DEFAULT), the builder hook must run before.
+// The tiered provider uses the cache with the configured remote name (default: DEFAULT), which must be defined before. If a redis invalidator
+// is configured, a redis.PubSub is created, which is closed with the tiered cache.
+func cacheOptions(ca CacheProvider) (interface{}, error) {
+	gc := time.Duration(ca.GCCycle)
+	var err error
+
+	switch ca.Provider {
+	case cache.MEMORY:
+		opt := memory.Options{}
+		err = decodeOptions(ca.Options, &opt)
+		if opt.GCInterval == 0 {
+			opt.GCInterval = gc
+		}
+		return opt, err
+	case cache.REDIS:
+		opt := redis.Options{}
+		err = decodeOptions(ca.Options, &opt)
+		if opt.GCInterval == 0 {
+			opt.GCInterval = gc
+		}
+		return opt, err
+	case cache.FILE:
+		opt := file.Options{}
+		err = decodeOptions(ca.Options, &opt)
+		if opt.GCInterval == 0 {
+			opt.GCInterval = gc
+		}
+		return opt, err
+	case cache.DB:
+		cfg := struct {
+			Builder string `json:"builder"`
+			Table   string `json:"table"`
+			GCBatch int    `json:"gcBatch"`
+		}{Builder: DEFAULT}
+		err = decodeOptions(ca.Options, &cfg)
+		if err != nil {
+			return nil, err
+		}
+		b, err := Builder(cfg.Builder)
+		if err != nil {
+			return nil, err
+		}
+		return db.Options{Builder: b, Table: cfg.Table, GCBatch: cfg.GCBatch, GCInterval: gc}, nil
+	case cache.TIERED:
+		cfg := struct {
+			Remote      string         `json:"remote"`
+			Local       memory.Options `json:"local"`
+			LocalTTL    time.Duration  `json:"localTTL"`
+			Invalidator *struct {
+				Redis   redis.Options `json:"redis"`
+				Channel string        `json:"channel"`
+			} `json:"invalidator"`
+		}{Remote: DEFAULT}
+		err = decodeOptions(ca.Options, &cfg)
+		if err != nil {
+			return nil, err
+		}
+		remote, err := Cache(cfg.Remote)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.Local.GCInterval == 0 {
+			cfg.Local.GCInterval = gc
+		}
+		opt := tiered.Options{Remote: remote, Local: cfg.Local, LocalTTL: cfg.LocalTTL}
+		if cfg.Invalidator != nil {
+			opt.Invalidator = redis.NewPubSub(cfg.Invalidator.Redis, cfg.Invalidator.Channel)
+			opt.CloseInvalidator = true
+		}
+		return opt, nil
+	}
+
+	return nil, fmt.Errorf(ErrCacheUnsupported.Error(), ca.Provider)
+}
+
+// decodeOptions decodes the json options, if they are set.
+// Durations can be set as duration string (e.g. "30s") or as number in nanoseconds.
+func decodeOptions(options json.RawMessage, v interface{}) error {
+	if len(options) == 0 {
+		return nil
+	}
+	var m interface{}
+	err := json.Unmarshal(options, &m)
+	if err != nil {
+		return err
+	}
+	m, err = durations(reflect.TypeOf(v), m)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// durations converts the duration strings of the decoded json into nanoseconds.
+// The fields are matched by their json name, like encoding/json case-insensitive.
+func durations(t reflect.Type, v interface{}) (interface{}, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == reflect.TypeOf(time.Duration(0)) {
+		if s, ok := v.(string); ok {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return nil, err
+			}
+			return int64(d), nil
+		}
+		return v, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return v, nil
+		}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get("json"), ",")[0]
+			if f.PkgPath != "" || name == "-" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			for k := range m {
+				if strings.EqualFold(k, name) {
+					val, err := durations(f.Type, m[k])
+					if err != nil {
+						return nil, err
+					}
+					m[k] = val
+				}
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		if s, ok := v.([]interface{}); ok {
+			for i := range s {
+				val, err := durations(t.Elem(), s[i])
+				if err != nil {
+					return nil, err
+				}
+				s[i] = val
+			}
+		}
+	case reflect.Map:
+		if m, ok := v.(map[string]interface{}); ok {
+			for k := range m {
+				val, err := durations(t.Elem(), m[k])
+				if err != nil {
+					return nil, err
+				}
+				m[k] = val
+			}
+		}
+	}
+	return v, nil
+}
+
 // Cache returns the configured cache.
 // If no cache is defined, this will be nil.
 func Router() *router.Manager {
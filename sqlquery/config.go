@@ -11,7 +11,7 @@ type Config struct {
 	Host               string `json:"host"`
 	Port               int    `json:"port"`
 	Username           string `json:"username"`
-	Password           string `json:"password"`
+	Password           string `json:"password" secret:"true"`
 	Database           string `json:"database"`
 	Schema             string `json:"schema"`
 	MaxOpenConnections int    `json:"maxOpenConnections"`